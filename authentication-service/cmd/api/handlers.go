@@ -1,9 +1,11 @@
 package main
 
 import (
+	"authentication/data"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 
@@ -15,27 +17,38 @@ func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
 
 	err := app.readJSON(w, r, &requestPayload)
 	if err != nil {
-		app.errorJSON(w, err, http.StatusBadRequest)
+		app.errorJSON(w, r, err, http.StatusBadRequest)
 		return
 	}
 
 	// validate the user against the database
-	user, err := app.Models.User.GetByEmail(requestPayload.Email)
+	user, err := app.Models.Users.GetByEmail(r.Context(), requestPayload.Email)
+	if errors.Is(err, data.ErrNotFound) {
+		app.errorJSON(w, r, errors.New("invalid credentials"), http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
-		app.errorJSON(w, errors.New("invalid credentials"), http.StatusBadRequest)
+		app.errorJSON(w, r, err, dataErrorStatus(err))
 		return
 	}
 
 	valid, err := user.PasswordMatches(requestPayload.Password)
 	if err != nil || !valid {
-		app.errorJSON(w, errors.New("invalid credentials"), http.StatusBadRequest)
+		app.errorJSON(w, r, errors.New("invalid credentials"), http.StatusUnauthorized)
+		return
+	}
+
+	// hand out a token the broker can check the user's permissions against
+	sess, err := app.newSession(user, time.Now())
+	if err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
 	payload := jsonResponse {
 		Error: false,
 		Message: fmt.Sprintf("Logged in user %s", user.Email),
-		Data: user,
+		Data: sess,
 	}
 
 	app.writeJSON(w, http.StatusAccepted, payload)
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"authentication/config"
+	"authentication/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate(t *testing.T) {
+	app := &Config{
+		Settings: &config.Config{
+			Storage:     "memory",
+			TokenSecret: "0123456789abcdef0123456789abcdef",
+			TokenTTL:    config.Duration(time.Hour),
+			Grants:      []config.Grant{{Email: "admin@example.com", Permissions: []string{"order:*"}}},
+		},
+		Models: data.NewMemory(),
+	}
+
+	user := data.User{Email: "admin@example.com", Password: "verysecret", Active: 1}
+	if _, err := app.Models.Users.Insert(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid", `{"email":"admin@example.com","password":"verysecret"}`, http.StatusAccepted},
+		{"wrong password", `{"email":"admin@example.com","password":"nope"}`, http.StatusUnauthorized},
+		{"unknown user", `{"email":"who@example.com","password":"verysecret"}`, http.StatusUnauthorized},
+		{"not json", `email=admin`, http.StatusBadRequest},
+	}
+
+	h := app.routes()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/authenticate", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+
+			var resp jsonResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error != (tt.status != http.StatusAccepted) {
+				t.Errorf("error = %v for status %d", resp.Error, w.Code)
+			}
+			if tt.status == http.StatusAccepted {
+				var sess struct {
+					Email       string   `json:"email"`
+					Token       string   `json:"token"`
+					Permissions []string `json:"permissions"`
+				}
+				b, _ := json.Marshal(resp.Data)
+				if err := json.Unmarshal(b, &sess); err != nil {
+					t.Fatal(err)
+				}
+				if sess.Email != "admin@example.com" || strings.Count(sess.Token, ".") != 1 {
+					t.Errorf("session = %+v", sess)
+				}
+				if len(sess.Permissions) != 1 || sess.Permissions[0] != "order:*" {
+					t.Errorf("permissions = %v, want the granted order:*", sess.Permissions)
+				}
+			}
+			if strings.Contains(w.Body.String(), "verysecret") || strings.Contains(w.Body.String(), `"password"`) {
+				t.Errorf("the answer gives the password away: %s", w.Body.String())
+			}
+		})
+	}
+}
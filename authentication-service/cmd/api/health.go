@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const healthTimeout = 2 * time.Second
+
+// healthCheck is the result of checking one dependency
+type healthCheck struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Live reports that the process is up and serving requests
+func (app *Config) Live(w http.ResponseWriter, r *http.Request) {
+	payload := jsonResponse{
+		Error:   false,
+		Message: "up",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+// Ready reports whether the service can do its job, which means its database answers
+func (app *Config) Ready(w http.ResponseWriter, r *http.Request) {
+	if app.draining.Load() {
+		app.errorJSON(w, r, errors.New("shutting down"), http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	if app.DB == nil {
+		payload := jsonResponse{
+			Error:   false,
+			Message: "ready",
+			Data:    []healthCheck{{Name: "memory", Status: "up"}},
+		}
+		_ = app.writeJSON(w, http.StatusOK, payload)
+		return
+	}
+
+	check := healthCheck{Name: "postgres", Status: "up"}
+
+	start := time.Now()
+	err := app.DB.PingContext(ctx)
+	check.LatencyMS = msSince(start)
+
+	status := http.StatusOK
+	payload := jsonResponse{
+		Error:   false,
+		Message: "ready",
+	}
+
+	if err != nil {
+		check.Status = "down"
+		check.Error = err.Error()
+
+		status = http.StatusServiceUnavailable
+		payload.Error = true
+		payload.Code = errorCode(status)
+		payload.Message = "not ready"
+	}
+
+	payload.Data = []healthCheck{check}
+
+	_ = app.writeJSON(w, status, payload)
+}
@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
+	"log/slog"
 	"net/http"
+	"authentication/data"
 )
 
 type jsonResponse struct {
 	Error bool `json:"error"`
+	Code string `json:"code,omitempty"`
 	Message string `json:"message"`
 	Data any `json:"data,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // readJSON tries to read the body of a request and converts it into JSON
@@ -58,7 +63,7 @@ func (app *Config) writeJSON(w http.ResponseWriter, status int, data any, header
 
 // errorJSON takes an error, and optionally a response status code, and generates and sends
 // a json error response
-func (app *Config) errorJSON(w http.ResponseWriter, err error, status ...int) error {
+func (app *Config) errorJSON(w http.ResponseWriter, r *http.Request, err error, status ...int) error {
 	statusCode := http.StatusBadRequest
 
 	if len(status) > 0 {
@@ -67,7 +72,62 @@ func (app *Config) errorJSON(w http.ResponseWriter, err error, status ...int) er
 
 	var payload jsonResponse
 	payload.Error = true
+	payload.Code = errorCode(statusCode)
 	payload.Message = err.Error()
+	payload.RequestID = w.Header().Get(requestIDHeader)
+
+	level := slog.LevelWarn
+	if statusCode >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	requestLogger(r).Log(r.Context(), level, "request failed",
+		"status", statusCode,
+		"code", payload.Code,
+		"error", payload.Message,
+	)
 
 	return app.writeJSON(w, statusCode, payload)
-}
\ No newline at end of file
+}
+
+// errorCode returns the machine readable code sent with an error response of the given status
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusUnprocessableEntity:
+		return "validation_failed"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	case http.StatusGatewayTimeout:
+		return "timeout"
+	case statusClientClosedRequest:
+		return "canceled"
+	default:
+		return "internal_error"
+	}
+}
+
+// statusClientClosedRequest is reported when the caller went away before we answered
+const statusClientClosedRequest = 499
+
+// dataErrorStatus picks the status a data layer error is reported with
+func dataErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, data.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,56 +1,126 @@
 package main
 
 import (
+	"authentication/config"
 	"authentication/data"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
 	_ "github.com/jackc/pgx/v4/stdlib"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-const webPort = "80"
-
 var counts int64
 
 type Config struct {
+	// Settings is the configuration the service was started with
+	Settings *config.Config
+	// DB is nil when users are kept in memory
 	DB *sql.DB
 	Models data.Models
+
+	// draining is set once shutdown has started, so that readiness checks fail
+	draining atomic.Bool
 }
 
 func main() {
-	log.Println("Starting authentication service")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		newLogger("authentication-service", "info").Error("loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		fmt.Println(cfg.Redacted())
+		return
+	}
 
-	// connect to DB
-	conn := connectToDB()
-	if conn == nil {
-		log.Panic("Can't connect to Postgres!")
+	newLogger("authentication-service", cfg.LogLevel)
+	slog.Info("configuration loaded", "config", json.RawMessage(cfg.Redacted()))
+
+	shutdownTracing, err := setupTracing(context.Background(), "authentication-service")
+	if err != nil {
+		slog.Error("setting up tracing", "error", err)
+		os.Exit(1)
 	}
 
+	slog.Info("starting authentication service", "port", cfg.WebPort)
+
 	// set up config
-	app := Config{
-		DB: conn,
-		Models: data.New(conn),
+	app := &Config{
+		Settings: cfg,
+	}
+
+	if cfg.Storage == "memory" {
+		slog.Warn("keeping users in memory, they are lost when the service stops")
+		app.Models = data.NewMemory()
+
+		if cfg.SeedEmail != "" {
+			seed := data.User{Email: cfg.SeedEmail, Password: cfg.SeedPassword, Active: 1}
+			if _, err := app.Models.Users.Insert(context.Background(), seed); err != nil {
+				slog.Error("adding the seed user", "error", err)
+				os.Exit(1)
+			}
+		}
+	} else {
+		// connect to DB
+		conn := connectToDB(cfg.DSN, cfg.ConnectRetries)
+		if conn == nil {
+			slog.Error("can't connect to postgres")
+			os.Exit(1)
+		}
+
+		app.DB = conn
+		app.Models = data.New(conn)
 	}
 
 	srv := &http.Server{
-		Addr: fmt.Sprintf(":%s", webPort),
+		Addr: fmt.Sprintf(":%d", cfg.WebPort),
 		Handler: app.routes(),
 	}
 
-	err := srv.ListenAndServe()
-	if err != nil {
-		log.Panic(err)
+	serveErr := app.serve(srv)
+	if serveErr != nil {
+		slog.Error("authentication service stopped", "error", serveErr)
+	}
+
+	// no requests are running any more: flush spans and close the connection pool
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("flushing traces", "error", err)
+	}
+
+	if app.DB != nil {
+		if err := app.DB.Close(); err != nil {
+			slog.Error("closing postgres pool", "error", err)
+		}
+	}
+
+	slog.Info("authentication service stopped")
+
+	if serveErr != nil {
+		os.Exit(1)
 	}
 }
 
 func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("pgx", dsn)
+	db, err := otelsql.Open("pgx", dsn, otelsql.WithAttributes(semconv.DBSystemPostgreSQL))
 	if err != nil {
 		return nil, err
 	}
@@ -63,25 +133,24 @@ func openDB(dsn string) (*sql.DB, error) {
 	return db, nil
 }
 
-func connectToDB() *sql.DB {
-	dsn := os.Getenv("DSN")
-
+// connectToDB waits for postgres to come up, trying up to retries more times after the first attempt
+func connectToDB(dsn string, retries int) *sql.DB {
 	for {
 		connection, err := openDB(dsn)
 		if err != nil {
-			log.Println("Postgres not yet ready ...")
+			slog.Warn("postgres not yet ready", "attempt", counts+1, "error", err)
 			counts++
 		} else {
-			log.Println("Connected to Postgres!")
+			slog.Info("connected to postgres")
 			return connection
 		}
 
-		if counts > 10 {
-			log.Println(err)
+		if counts > int64(retries) {
+			slog.Error("giving up on postgres", "error", err)
 			return nil
 		}
 
-		log.Println("Backing off for two seconds....")
+		slog.Info("backing off", "seconds", 2)
 		time.Sleep(2 * time.Second)
 		continue
 	}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// requestIDHeader carries the id that ties together the log lines of one request as it
+// travels from the broker through the services
+const requestIDHeader = "X-Request-ID"
+
+// echoRequestID sends the request id back to the caller, so that it shows up in every
+// response, including errors. It must run after middleware.RequestID.
+func echoRequestID(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(requestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// requestTimeoutHeader carries how many milliseconds the caller is still willing to wait
+// for an answer. The broker sets it from its own upstream timeout.
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// honourDeadline puts the caller's remaining time on the request context, so that database
+// calls made for the request give up once nobody is waiting for them any more
+func honourDeadline(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if ms, err := strconv.Atoi(r.Header.Get(requestTimeoutHeader)); err == nil && ms > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(ms)*time.Millisecond)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve runs srv until it fails or the process gets SIGINT or SIGTERM. On a signal it
+// reports not ready, keeps serving for the configured drain delay, then stops accepting
+// connections and waits up to the configured shutdown timeout for in-flight requests to
+// finish before returning.
+func (app *Config) serve(srv *http.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		err := srv.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		errs <- err
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownTimeout := time.Duration(app.Settings.ShutdownTimeout)
+
+	slog.Info("shutting down, draining in-flight requests", "timeout", shutdownTimeout.String())
+	app.draining.Store(true)
+
+	// keep serving while load balancers notice the failing readiness check
+	if delay := time.Duration(app.Settings.DrainDelay); delay > 0 {
+		slog.Info("waiting for load balancers to stop sending requests", "delay", delay.String())
+		time.Sleep(delay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	return <-errs
+}
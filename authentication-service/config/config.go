@@ -0,0 +1,114 @@
+// Package config holds the settings of the authentication service
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	WebPort  int    `json:"web_port" env:"WEB_PORT"`
+	LogLevel string `json:"log_level" env:"LOG_LEVEL"`
+	// Storage is postgres, or memory for tests and local demos
+	Storage        string `json:"storage" env:"STORAGE"`
+	DSN            string `json:"dsn" env:"DSN" secret:"true"`
+	ConnectRetries int    `json:"connect_retries" env:"DB_CONNECT_RETRIES"`
+	// SeedEmail and SeedPassword are a user added at start up with memory storage, which
+	// starts out without any
+	SeedEmail       string   `json:"seed_email" env:"SEED_EMAIL"`
+	SeedPassword    string   `json:"seed_password" env:"SEED_PASSWORD" secret:"true"`
+	ShutdownTimeout Duration `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// DrainDelay is how long a stopping service keeps serving after its readiness check
+	// starts failing, so that load balancers stop sending it requests first
+	DrainDelay Duration `json:"drain_delay" env:"DRAIN_DELAY"`
+	// TokenSecret signs the tokens handed out on login; the broker verifies them with the same secret
+	TokenSecret string   `json:"token_secret" env:"TOKEN_SECRET" secret:"true"`
+	TokenTTL    Duration `json:"token_ttl" env:"TOKEN_TTL"`
+	// Grants lists the permissions each user's token carries; users without a grant get none
+	Grants []Grant `json:"grants" env:"GRANTS"`
+}
+
+// Grant gives the user with Email the permissions, such as "order:read", "order:*" or "*"
+type Grant struct {
+	Email       string   `json:"email"`
+	Permissions []string `json:"permissions"`
+}
+
+// PermissionsOf returns the permissions granted to the user with the given email
+func (c *Config) PermissionsOf(email string) []string {
+	permissions := []string{}
+	for _, g := range c.Grants {
+		if strings.EqualFold(g.Email, email) {
+			permissions = append(permissions, g.Permissions...)
+		}
+	}
+
+	return permissions
+}
+
+func defaults() *Config {
+	return &Config{
+		WebPort:         80,
+		LogLevel:        "info",
+		Storage:         "postgres",
+		ConnectRetries:  10,
+		ShutdownTimeout: Duration(20 * time.Second),
+		DrainDelay:      Duration(5 * time.Second),
+		TokenTTL:        Duration(time.Hour),
+	}
+}
+
+// Validate reports every setting that is out of range, not just the first
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.WebPort < 1 || c.WebPort > 65535 {
+		errs = append(errs, fmt.Errorf("web_port %d is not a valid port", c.WebPort))
+	}
+
+	switch c.Storage {
+	case "memory":
+		if (c.SeedEmail == "") != (c.SeedPassword == "") {
+			errs = append(errs, errors.New("seed_email and seed_password are set together"))
+		}
+	case "postgres":
+		if c.DSN == "" {
+			errs = append(errs, errors.New("dsn is required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage %q must be postgres or memory", c.Storage))
+	}
+
+	if c.ConnectRetries < 0 {
+		errs = append(errs, errors.New("connect_retries must not be negative"))
+	}
+
+	switch {
+	case c.TokenSecret == "":
+		errs = append(errs, errors.New("token_secret is required: set TOKEN_SECRET, or TOKEN_SECRET_FILE to a file holding it, such as one made with openssl rand -base64 48"))
+	case len(c.TokenSecret) < 32:
+		errs = append(errs, errors.New("token_secret must be at least 32 characters"))
+	}
+
+	if c.TokenTTL <= 0 {
+		errs = append(errs, errors.New("token_ttl must be positive"))
+	}
+
+	for i, g := range c.Grants {
+		if g.Email == "" {
+			errs = append(errs, fmt.Errorf("grants[%d] has no email", i))
+		}
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+
+	if c.DrainDelay < 0 {
+		errs = append(errs, errors.New("drain_delay must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
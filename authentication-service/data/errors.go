@@ -0,0 +1,30 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when no user matches the lookup
+	ErrNotFound = errors.New("user not found")
+	// ErrTimeout is returned when the caller's deadline passed before postgres answered
+	ErrTimeout = errors.New("user storage timed out")
+)
+
+// wrapErr turns driver errors into the package's typed errors, keeping the original
+// error's text for the logs
+func wrapErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	default:
+		return err
+	}
+}
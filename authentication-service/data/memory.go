@@ -0,0 +1,178 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryUsers keeps users in a map. It is safe for concurrent use and hands out copies,
+// so callers can't change stored users behind its back.
+type MemoryUsers struct {
+	mu     sync.RWMutex
+	users  map[int]User
+	nextID int
+}
+
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{users: make(map[int]User), nextID: 1}
+}
+
+// GetAll returns every user, ordered by last name
+func (m *MemoryUsers) GetAll(ctx context.Context) ([]*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]*User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, &user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].LastName == users[j].LastName {
+			return users[i].ID < users[j].ID
+		}
+		return users[i].LastName < users[j].LastName
+	})
+
+	return users, nil
+}
+
+func (m *MemoryUsers) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (m *MemoryUsers) GetOne(ctx context.Context, id int) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &user, nil
+}
+
+func (m *MemoryUsers) Update(ctx context.Context, u User) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[u.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	user.Email = u.Email
+	user.FirstName = u.FirstName
+	user.LastName = u.LastName
+	user.Active = u.Active
+	user.UpdatedAt = time.Now()
+
+	m.users[u.ID] = user
+
+	return nil
+}
+
+func (m *MemoryUsers) DeleteByID(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(m.users, id)
+
+	return nil
+}
+
+// Insert hashes the user's password, like the postgres version, and returns the new ID
+func (m *MemoryUsers) Insert(ctx context.Context, user User) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, wrapErr(err)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.users {
+		if existing.Email == user.Email {
+			return 0, fmt.Errorf("user %s already exists", user.Email)
+		}
+	}
+
+	now := time.Now()
+
+	user.ID = m.nextID
+	user.Password = string(hashedPassword)
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	m.users[user.ID] = user
+	m.nextID++
+
+	return user.ID, nil
+}
+
+func (m *MemoryUsers) ResetPassword(ctx context.Context, id int, password string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	user.Password = string(hashedPassword)
+	m.users[id] = user
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemoryUsers(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUsers()
+
+	id, err := users.Insert(ctx, User{Email: "a@example.com", Password: "secret", Active: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.Insert(ctx, User{Email: "a@example.com", Password: "other"}); err == nil {
+		t.Error("a second user with the same email was added")
+	}
+
+	user, err := users.GetByEmail(ctx, "a@example.com")
+	if err != nil || user.ID != id {
+		t.Fatalf("GetByEmail: %v, %v", user, err)
+	}
+	if ok, _ := user.PasswordMatches("secret"); !ok {
+		t.Error("the stored password doesn't match")
+	}
+	if user.Password == "secret" {
+		t.Error("the password is stored in the clear")
+	}
+
+	if err := users.ResetPassword(ctx, id, "changed"); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = users.GetOne(ctx, id)
+	if ok, _ := user.PasswordMatches("changed"); !ok {
+		t.Error("the reset password doesn't match")
+	}
+
+	if err := users.DeleteByID(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.GetOne(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetOne after delete: %v, want ErrNotFound", err)
+	}
+}
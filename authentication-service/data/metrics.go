@@ -0,0 +1,31 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var dbOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_operation_duration_seconds",
+	Help:    "Time taken by postgres operations, by table, operation and outcome.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 15},
+}, []string{"table", "operation", "outcome"})
+
+// observe records how long a database operation that started at start took
+func observe(table, operation string, start time.Time, err error) {
+	outcome := "ok"
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		outcome = "timeout"
+	case errors.Is(err, context.Canceled):
+		outcome = "canceled"
+	case err != nil:
+		outcome = "error"
+	}
+
+	dbOperationDuration.WithLabelValues(table, operation, outcome).Observe(time.Since(start).Seconds())
+}
@@ -4,28 +4,44 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
+	"log/slog"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// dbTimeout caps every query; a shorter deadline on the caller's context wins
 const dbTimeout = time.Second * 3
 
-var db *sql.DB
-
+// UserRepository is the storage the authentication service needs. PostgresUsers keeps
+// users in postgres; MemoryUsers keeps them in memory, for tests and local demos. Every
+// method gives up once ctx is done, returning ErrTimeout when its deadline passed.
+type UserRepository interface {
+	GetAll(ctx context.Context) ([]*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetOne(ctx context.Context, id int) (*User, error)
+	Update(ctx context.Context, user User) error
+	DeleteByID(ctx context.Context, id int) error
+	Insert(ctx context.Context, user User) (int, error)
+	ResetPassword(ctx context.Context, id int, password string) error
+}
 
+// New returns models backed by the given postgres pool
 func New(dbPool *sql.DB) Models {
-	db = dbPool
-
 	return Models{
-		User: User{},
+		Users: NewPostgresUsers(dbPool),
 	}
 }
 
+// NewMemory returns models that keep everything in memory
+func NewMemory() Models {
+	return Models{
+		Users: NewMemoryUsers(),
+	}
+}
 
 type Models struct {
-	User User
+	Users UserRepository
 }
 
 type User struct {
@@ -39,16 +55,27 @@ type User struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-func (u *User) GetAll() ([]*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// PostgresUsers stores users in the users table
+type PostgresUsers struct {
+	db *sql.DB
+}
+
+func NewPostgresUsers(db *sql.DB) *PostgresUsers {
+	return &PostgresUsers{db: db}
+}
+
+func (p *PostgresUsers) GetAll(ctx context.Context) ([]*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
 	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at
 	from users order by last_name`
 
-	rows, err := db.QueryContext(ctx, query)
+	start := time.Now()
+	rows, err := p.db.QueryContext(ctx, query)
+	observe("users", "get_all", start, err)
 	if err != nil {
-		return nil, err
+		return nil, wrapErr(err)
 	}
 	defer rows.Close()
 
@@ -67,24 +94,29 @@ func (u *User) GetAll() ([]*User, error) {
 			&user.UpdatedAt,
 		)
 		if err != nil {
-			log.Println("Error scanning", err)
-			return nil, err
+			slog.Error("scanning user", "error", err)
+			return nil, wrapErr(err)
 		}
 
 		users = append(users, &user)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
 	return users, nil
 }
 
-func (u *User) GetByEmail(email string) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (p *PostgresUsers) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
 	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where email = $1`
 
 	var user User
-	row := db.QueryRowContext(ctx, query, email)
+	start := time.Now()
+	row := p.db.QueryRowContext(ctx, query, email)
 
 	err := row.Scan(
 		&user.ID,
@@ -96,22 +128,24 @@ func (u *User) GetByEmail(email string) (*User, error) {
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
+	observe("users", "get_by_email", start, err)
 
 	if err != nil {
-		return nil, err
+		return nil, wrapErr(err)
 	}
 
 	return &user, nil
 }
 
-func (u *User) GetOne(id int) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (p *PostgresUsers) GetOne(ctx context.Context, id int) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
 	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where id = $1`
 
 	var user User
-	row := db.QueryRowContext(ctx, query, id)
+	start := time.Now()
+	row := p.db.QueryRowContext(ctx, query, id)
 
 	err := row.Scan(
 		&user.ID,
@@ -123,16 +157,17 @@ func (u *User) GetOne(id int) (*User, error) {
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
+	observe("users", "get_one", start, err)
 
 	if err != nil {
-		return nil, err
+		return nil, wrapErr(err)
 	}
 
 	return &user, nil
 }
 
-func (u *User) Update() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (p *PostgresUsers) Update(ctx context.Context, u User) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
 	stmt := `update users set
@@ -144,7 +179,8 @@ func (u *User) Update() error {
 		where id = $6
 	`
 
-	_, err := db.ExecContext(ctx, stmt,
+	start := time.Now()
+	result, err := p.db.ExecContext(ctx, stmt,
 		u.Email,
 		u.FirstName,
 		u.LastName,
@@ -152,59 +188,48 @@ func (u *User) Update() error {
 		time.Now(),
 		u.ID,
 	)
+	observe("users", "update", start, err)
 
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 
-	return nil
-}
-
-// Delete deletes one user from the database, by User.ID
-func (u *User) Delete() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `delete from users where id = $1`
-
-	_, err := db.ExecContext(ctx, stmt, u.ID)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return affectedOne(result)
 }
 
 // DeleteByID deletes one user from the database, by ID
-func (u *User) DeleteByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (p *PostgresUsers) DeleteByID(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
 	stmt := `delete from users where id = $1`
 
-	_, err := db.ExecContext(ctx, stmt, id)
+	start := time.Now()
+	result, err := p.db.ExecContext(ctx, stmt, id)
+	observe("users", "delete", start, err)
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 
-	return nil
+	return affectedOne(result)
 }
 
 // Insert inserts a new user into the database, and returns the ID of the newly inserted row
-func (u *User) Insert(user User) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (p *PostgresUsers) Insert(ctx context.Context, user User) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
 	if err != nil {
-		return 0, err
+		return 0, wrapErr(err)
 	}
 
 	var newID int
 	stmt := `insert into users (email, first_name, last_name, password, user_active, created_at, updated_at)
 		values ($1, $2, $3, $4, $5, $6, $7) returning id`
 
-	err = db.QueryRowContext(ctx, stmt,
+	start := time.Now()
+	err = p.db.QueryRowContext(ctx, stmt,
 		user.Email,
 		user.FirstName,
 		user.LastName,
@@ -213,28 +238,45 @@ func (u *User) Insert(user User) (int, error) {
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
+	observe("users", "insert", start, err)
 
 	if err != nil {
-		return 0, err
+		return 0, wrapErr(err)
 	}
 
 	return newID, nil
 }
 
 // ResetPassword is the method we will use to change a user's password.
-func (u *User) ResetPassword(password string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (p *PostgresUsers) ResetPassword(ctx context.Context, id int, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 
 	stmt := `update users set password = $1 where id = $2`
-	_, err = db.ExecContext(ctx, stmt, hashedPassword, u.ID)
+	start := time.Now()
+	result, err := p.db.ExecContext(ctx, stmt, hashedPassword, id)
+	observe("users", "reset_password", start, err)
 	if err != nil {
-		return err
+		return wrapErr(err)
+	}
+
+	return affectedOne(result)
+}
+
+// affectedOne turns a statement that touched no rows into ErrNotFound
+func affectedOne(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
 	}
 
 	return nil
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ActionHandler calls the upstream service for an already decoded and validated payload.
+// It returns the status code and body to send back to the client, or an error; an *apiError
+// decides the status and code the failure is reported with.
+type ActionHandler func(r *http.Request, payload any) (int, jsonResponse, error)
+
+// Action describes a single thing the broker knows how to do
+type Action struct {
+	Name        string
+	Description string
+	Permission  string
+	Payload     func() any
+	// SchemaName names the json schema in schemas/ the raw payload must match
+	SchemaName string
+	Validate   func(payload any) error
+	Handle     ActionHandler
+	// HandleBatch is set for actions whose upstream can apply many payloads all-or-nothing
+	HandleBatch func(r *http.Request, payloads []any) (int, jsonResponse, error)
+
+	schema    *jsonschema.Schema
+	schemaDoc json.RawMessage
+}
+
+// ActionInfo is the public description of an action, as listed by GET /actions
+type ActionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Permission  string `json:"permission,omitempty"`
+	Schema      string `json:"schema,omitempty"`
+}
+
+// newAction builds an Action around a typed payload, so that handlers and validators
+// don't have to type assert their argument. The payload is checked against the schema
+// named after the action.
+func newAction[T any](name, description, permission string, validate func(*T) error, handle func(*http.Request, *T) (int, jsonResponse, error)) Action {
+	a := Action{
+		Name:        name,
+		Description: description,
+		Permission:  permission,
+		SchemaName:  name,
+		Payload:     func() any { return new(T) },
+		Handle: func(r *http.Request, payload any) (int, jsonResponse, error) {
+			return handle(r, payload.(*T))
+		},
+	}
+
+	if validate != nil {
+		a.Validate = func(payload any) error {
+			return validate(payload.(*T))
+		}
+	}
+
+	return a
+}
+
+// withBatch adds an all-or-nothing batch handler to an action built by newAction
+func withBatch[T any](a Action, handle func(*http.Request, []*T) (int, jsonResponse, error)) Action {
+	a.HandleBatch = func(r *http.Request, payloads []any) (int, jsonResponse, error) {
+		typed := make([]*T, len(payloads))
+		for i, p := range payloads {
+			typed[i] = p.(*T)
+		}
+		return handle(r, typed)
+	}
+
+	return a
+}
+
+// ActionRegistry holds every action the broker can dispatch to
+type ActionRegistry struct {
+	mu      sync.RWMutex
+	actions map[string]Action
+}
+
+func NewActionRegistry() *ActionRegistry {
+	return &ActionRegistry{
+		actions: make(map[string]Action),
+	}
+}
+
+// Register adds an action to the registry, compiling its schema if it has one. Registering
+// the same name twice is an error.
+func (reg *ActionRegistry) Register(a Action) error {
+	if a.Name == "" {
+		return errors.New("action must have a name")
+	}
+
+	if a.Payload == nil || a.Handle == nil {
+		return fmt.Errorf("action %q must have a payload and a handler", a.Name)
+	}
+
+	if a.SchemaName != "" {
+		schema, doc, err := loadSchema(a.SchemaName)
+		if err != nil {
+			return err
+		}
+		if err := checkSchemaFields(doc, reflect.TypeOf(a.Payload())); err != nil {
+			return fmt.Errorf("schema for action %q is out of date: %w", a.Name, err)
+		}
+		a.schema, a.schemaDoc = schema, doc
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, exists := reg.actions[a.Name]; exists {
+		return fmt.Errorf("action %q is already registered", a.Name)
+	}
+
+	reg.actions[a.Name] = a
+
+	return nil
+}
+
+// MustRegister is like Register but panics on error; it is meant for wiring at startup
+func (reg *ActionRegistry) MustRegister(actions ...Action) {
+	for _, a := range actions {
+		if err := reg.Register(a); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Lookup returns the action registered under name
+func (reg *ActionRegistry) Lookup(name string) (Action, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	a, ok := reg.actions[name]
+
+	return a, ok
+}
+
+// List returns the public description of every registered action, sorted by name
+func (reg *ActionRegistry) List() []ActionInfo {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	list := make([]ActionInfo, 0, len(reg.actions))
+	for _, a := range reg.actions {
+		info := ActionInfo{
+			Name:        a.Name,
+			Description: a.Description,
+			Permission:  a.Permission,
+		}
+		if a.schemaDoc != nil {
+			info.Schema = "/schemas/" + a.Name
+		}
+		list = append(list, info)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// rawPayload picks the payload of a request out of either the "payload" field or, for
+// older clients, the field named after the action, e.g. {"action": "auth", "auth": {...}}
+func (rp *RequestPayload) rawPayload(a Action) json.RawMessage {
+	if len(rp.Payload) > 0 {
+		return rp.Payload
+	}
+
+	return rp.Legacy[a.Name]
+}
+
+// decodePayload decodes the request's payload into the action's payload type
+func (rp *RequestPayload) decodePayload(a Action) (any, error) {
+	payload := a.Payload()
+
+	raw := rp.rawPayload(a)
+	if len(raw) == 0 {
+		return payload, nil
+	}
+
+	if err := json.Unmarshal(raw, payload); err != nil {
+		return nil, fmt.Errorf("invalid payload for action %q: %w", a.Name, err)
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"broker-service/config"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// sign builds a token the way the authentication service does
+func sign(t *testing.T, secret string, id identity) string {
+	t.Helper()
+
+	claims, err := json.Marshal(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyToken(t *testing.T) {
+	now := time.Now()
+	valid := identity{UserID: 7, Email: "clerk@example.com", Permissions: []string{"order:read"}, ExpiresAt: now.Add(time.Hour).Unix()}
+
+	id, err := verifyToken(testSecret, sign(t, testSecret, valid), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.UserID != 7 || id.Email != "clerk@example.com" {
+		t.Errorf("identity = %+v", id)
+	}
+
+	expired := valid
+	expired.ExpiresAt = now.Add(-time.Second).Unix()
+
+	for name, token := range map[string]string{
+		"other secret": sign(t, "another secret of thirty two chars", valid),
+		"expired":      sign(t, testSecret, expired),
+		"no signature": "eyJzdWIiOjF9",
+		"tampered":     sign(t, testSecret, valid) + "x",
+	} {
+		if _, err := verifyToken(testSecret, token, now); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestTokenPermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions []string
+		permission  string
+		status      int
+	}{
+		{"exact", []string{"order:read"}, "order:read", 0},
+		{"resource wildcard", []string{"order:*"}, "order:write", 0},
+		{"everything", []string{"*"}, "picklist:write", 0},
+		{"other permission", []string{"order:read"}, "order:write", http.StatusForbidden},
+		{"none", nil, "order:read", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := &identity{Email: "clerk@example.com", Permissions: tt.permissions}
+			r := httptest.NewRequest(http.MethodPost, "/handle", nil)
+			r = r.WithContext(withIdentity(r.Context(), id))
+
+			err := tokenPermissions(r, tt.permission)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("refused: %v", err)
+				}
+				return
+			}
+
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) || apiErr.Status != tt.status {
+				t.Fatalf("error = %v, want status %d", err, tt.status)
+			}
+		})
+	}
+
+	var apiErr *apiError
+	r := httptest.NewRequest(http.MethodPost, "/handle", nil)
+	if err := tokenPermissions(r, "order:read"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("anonymous call: %v, want status 401", err)
+	}
+}
+
+func TestIdentifySetsUserIDFromTokenOnly(t *testing.T) {
+	app := &Config{Settings: &config.Config{TokenSecret: testSecret}}
+	token := sign(t, testSecret, identity{UserID: 7, Permissions: []string{"*"}, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+
+	var seen string
+	h := app.identify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(userIDHeader)
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          string
+	}{
+		{"anonymous", "", ""},
+		{"token", "Bearer " + token, "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = "unset"
+			r := httptest.NewRequest(http.MethodPost, "/handle", nil)
+			r.Header.Set(userIDHeader, "1")
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if seen != tt.want {
+				t.Errorf("%s = %q, want %q", userIDHeader, seen, tt.want)
+			}
+		})
+	}
+}
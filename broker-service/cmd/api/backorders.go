@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+)
+
+type BackorderListPayload struct {
+	ProductID string `json:"product_id,omitempty"`
+}
+
+type BackorderAllocatePayload struct {
+	ProductID string `json:"product_id,omitempty"`
+	MaxOrders int    `json:"max_orders,omitempty"`
+}
+
+type InventoryReceivePayload struct {
+	ItemID    string `json:"item_id"`
+	Quantity  int    `json:"quantity"`
+	Reference string `json:"reference,omitempty"`
+}
+
+func (app *Config) listBackorders(r *http.Request, p *BackorderListPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/backorders"
+	if p.ProductID != "" {
+		u += "?" + url.Values{"product_id": {p.ProductID}}.Encode()
+	}
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) allocateBackorders(r *http.Request, p *BackorderAllocatePayload) (int, jsonResponse, error) {
+	jsonFromService, err := app.callService(r, "order-service", "POST", app.Settings.OrderURL+"/backorders/allocate", p, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+// receiveStock puts the units on the shelf, then hands them to the item's backorders. The
+// units are received either way; backorders that couldn't be allocated are reported and
+// left for backorder.allocate to retry.
+func (app *Config) receiveStock(r *http.Request, p *InventoryReceivePayload) (int, jsonResponse, error) {
+	u := app.Settings.InventoryURL + "/inventory/" + url.PathEscape(p.ItemID) + "/receive"
+
+	body := map[string]any{"quantity": p.Quantity, "reference": p.Reference}
+
+	received, err := app.callService(r, "inventory-service", "POST", u, body, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	data := map[string]any{"item": received.Data}
+
+	allocated, err := app.callService(r, "order-service", "POST", app.Settings.OrderURL+"/backorders/allocate",
+		BackorderAllocatePayload{ProductID: p.ItemID}, http.StatusOK)
+	if err != nil {
+		requestLogger(r).Warn("allocating backorders of received stock", "item_id", p.ItemID, "error", err)
+		return http.StatusOK, jsonResponse{
+			Message: "stock received, its backorders weren't allocated: " + err.Error(),
+			Data:    data,
+		}, nil
+	}
+	data["backorders"] = allocated.Data
+
+	return http.StatusOK, jsonResponse{Message: "stock received", Data: data}, nil
+}
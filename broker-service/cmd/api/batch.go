@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const maxBatchSize = 1000
+
+// BatchPayload is what clients post to /handle/batch. With Atomic set the whole batch is
+// applied all-or-nothing, which is only possible when every entry uses the same action and
+// that action's upstream supports batches.
+type BatchPayload struct {
+	Atomic  bool             `json:"atomic"`
+	Actions []RequestPayload `json:"actions"`
+}
+
+// batchResult is the outcome of one entry of a batch
+type batchResult struct {
+	Index  int    `json:"index"`
+	Action string `json:"action"`
+	Status int    `json:"status"`
+	jsonResponse
+}
+
+type batchSummary struct {
+	Total     int           `json:"total"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []batchResult `json:"results"`
+}
+
+// HandleBatch runs many actions in one request and reports a result per entry
+func (app *Config) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	var batch BatchPayload
+
+	err := app.readJSON(w, r, &batch)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if len(batch.Actions) == 0 {
+		app.errorJSON(w, r, newAPIError(http.StatusBadRequest, codeBadRequest, "batch must contain at least one action"))
+		return
+	}
+
+	if len(batch.Actions) > maxBatchSize {
+		app.errorJSON(w, r, newAPIError(http.StatusBadRequest, codeBadRequest, fmt.Sprintf("batch must not contain more than %d actions", maxBatchSize)))
+		return
+	}
+
+	if batch.Atomic {
+		app.handleAtomicBatch(w, r, batch)
+		return
+	}
+
+	results := make([]batchResult, len(batch.Actions))
+
+	// fan out to the upstreams, never running more than batch_concurrency calls at once
+	sem := make(chan struct{}, app.Settings.BatchConcurrency)
+	var wg sync.WaitGroup
+
+	for i, entry := range batch.Actions {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, entry RequestPayload) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = app.runBatchEntry(r, i, entry)
+		}(i, entry)
+	}
+
+	wg.Wait()
+
+	summary := summarize(results)
+
+	payload := jsonResponse{
+		Error:   summary.Failed > 0,
+		Message: fmt.Sprintf("batch processed: %d succeeded, %d failed", summary.Succeeded, summary.Failed),
+		Data:    summary,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// runBatchEntry runs a single entry of a non-atomic batch
+func (app *Config) runBatchEntry(r *http.Request, index int, entry RequestPayload) batchResult {
+	result := batchResult{Index: index, Action: entry.Action}
+
+	// every entry is a write of its own, so each gets its own key derived from the batch's
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		r = r.Clone(r.Context())
+		r.Header.Set(idempotencyKeyHeader, fmt.Sprintf("%s/%d", key, index))
+	}
+
+	action, payload, err := app.prepareAction(r, entry)
+	if err != nil {
+		return failedResult(result, err)
+	}
+
+	status, resp, err := action.Handle(r, payload)
+	if err != nil {
+		return failedResult(result, err)
+	}
+
+	result.Status = status
+	result.jsonResponse = resp
+
+	return result
+}
+
+// handleAtomicBatch validates every entry up front and then hands the whole batch to the
+// action's upstream in one call, so either every entry is applied or none is
+func (app *Config) handleAtomicBatch(w http.ResponseWriter, r *http.Request, batch BatchPayload) {
+	name := batch.Actions[0].Action
+
+	action, ok := app.Actions.Lookup(name)
+	if !ok {
+		app.errorJSON(w, r, newAPIError(http.StatusBadRequest, codeUnknownAction, "unknown action"))
+		return
+	}
+
+	if action.HandleBatch == nil {
+		app.errorJSON(w, r, newAPIError(http.StatusUnprocessableEntity, codeBadRequest, fmt.Sprintf("action %q does not support atomic batches", name)))
+		return
+	}
+
+	results := make([]batchResult, len(batch.Actions))
+	payloads := make([]any, len(batch.Actions))
+	failed := false
+
+	for i, entry := range batch.Actions {
+		results[i] = batchResult{Index: i, Action: entry.Action}
+
+		if entry.Action != name {
+			results[i] = failedResult(results[i], newAPIError(http.StatusUnprocessableEntity, codeBadRequest, "every action in an atomic batch must be the same"))
+			failed = true
+			continue
+		}
+
+		_, payload, err := app.prepareAction(r, entry)
+		if err != nil {
+			results[i] = failedResult(results[i], err)
+			failed = true
+			continue
+		}
+
+		payloads[i] = payload
+		results[i].Message = "valid"
+	}
+
+	// nothing has been sent upstream yet, so a single bad entry rejects the whole batch
+	if failed {
+		summary := summarize(results)
+		app.writeJSON(w, http.StatusUnprocessableEntity, jsonResponse{
+			Error:   true,
+			Code:    codeValidationFailed,
+			Message: fmt.Sprintf("batch rejected: %d of %d actions are invalid", summary.Failed, summary.Total),
+			Data:    summary,
+		})
+		return
+	}
+
+	status, resp, err := action.HandleBatch(r, payloads)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	for i := range results {
+		results[i].Status = status
+		results[i].Message = "applied"
+	}
+
+	summary := summarize(results)
+	resp.Data = summary
+
+	app.writeJSON(w, status, resp)
+}
+
+// failedResult fills in result from err, as errorJSON would for a single request
+func failedResult(result batchResult, err error) batchResult {
+	apiErr := asAPIError(err)
+
+	result.Status = apiErr.Status
+	result.Error = true
+	result.Code = apiErr.Code
+	if result.Code == "" {
+		result.Code = errorCode(apiErr.Status)
+	}
+	result.Message = apiErr.Error()
+	result.Details = apiErr.Details
+
+	return result
+}
+
+func summarize(results []batchResult) batchSummary {
+	summary := batchSummary{
+		Total:   len(results),
+		Results: results,
+	}
+
+	for _, res := range results {
+		if res.Error {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+	}
+
+	return summary
+}
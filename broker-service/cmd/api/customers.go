@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CustomerPayload is a customer to add or update. ID is left out to have the order service
+// number a new customer, or given to keep a client id orders already use.
+type CustomerPayload struct {
+	ID              int32            `json:"id,omitempty"`
+	Name            string           `json:"name"`
+	Company         string           `json:"company,omitempty"`
+	Email           string           `json:"email"`
+	Phone           string           `json:"phone,omitempty"`
+	Addresses       []AddressPayload `json:"addresses"`
+	TaxIDs          []TaxIDPayload   `json:"tax_ids,omitempty"`
+	DefaultShipping string           `json:"default_shipping,omitempty"`
+	DefaultBilling  string           `json:"default_billing,omitempty"`
+}
+
+// AddressPayload is one of a customer's addresses; Kinds is shipping, billing or both
+type AddressPayload struct {
+	ID         string   `json:"id,omitempty"`
+	Kinds      []string `json:"kinds"`
+	Name       string   `json:"name,omitempty"`
+	Line1      string   `json:"line1"`
+	Line2      string   `json:"line2,omitempty"`
+	City       string   `json:"city"`
+	PostalCode string   `json:"postal_code,omitempty"`
+	Region     string   `json:"region,omitempty"`
+	Country    string   `json:"country"`
+}
+
+type TaxIDPayload struct {
+	Type    string `json:"type"`
+	Value   string `json:"value"`
+	Country string `json:"country,omitempty"`
+}
+
+type CustomerGetPayload struct {
+	ID int32 `json:"id"`
+}
+
+type CustomerSearchPayload struct {
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+	PageParams
+}
+
+// CustomerOrdersPayload narrows down a customer's order history like an order search
+type CustomerOrdersPayload struct {
+	ID     int32  `json:"id"`
+	Status string `json:"status,omitempty"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	PageParams
+}
+
+func (app *Config) createCustomer(r *http.Request, p *CustomerPayload) (int, jsonResponse, error) {
+	jsonFromService, err := app.callService(r, "order-service", "POST", app.Settings.OrderURL+"/customers", p, http.StatusCreated)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusCreated, jsonFromService, nil
+}
+
+func (app *Config) getCustomer(r *http.Request, p *CustomerGetPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/customers/" + strconv.Itoa(int(p.ID))
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) updateCustomer(r *http.Request, p *CustomerPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/customers/" + strconv.Itoa(int(p.ID))
+
+	jsonFromService, err := app.callService(r, "order-service", "PUT", u, p, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) searchCustomers(r *http.Request, p *CustomerSearchPayload) (int, jsonResponse, error) {
+	q := url.Values{}
+	if p.Email != "" {
+		q.Set("email", p.Email)
+	}
+	if p.Name != "" {
+		q.Set("name", p.Name)
+	}
+	p.encode(q)
+
+	u := app.Settings.OrderURL + "/customers"
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) customerOrders(r *http.Request, p *CustomerOrdersPayload) (int, jsonResponse, error) {
+	q := url.Values{}
+	if p.Status != "" {
+		q.Set("status", p.Status)
+	}
+	if p.From != "" {
+		q.Set("from", p.From)
+	}
+	if p.To != "" {
+		q.Set("to", p.To)
+	}
+	p.encode(q)
+
+	u := app.Settings.OrderURL + "/customers/" + strconv.Itoa(int(p.ID)) + "/orders"
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
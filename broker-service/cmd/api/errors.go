@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// machine readable error codes returned in the "code" field of error responses
+const (
+	codeBadRequest          = "bad_request"
+	codeUnknownAction       = "unknown_action"
+	codeInvalidPayload      = "invalid_payload"
+	codeUnauthorized        = "unauthorized"
+	codeForbidden           = "forbidden"
+	codeNotFound            = "not_found"
+	codeConflict            = "conflict"
+	codeValidationFailed    = "validation_failed"
+	codeUpstreamError       = "upstream_error"
+	codeUpstreamUnavailable = "upstream_unavailable"
+	codeUpstreamTimeout     = "upstream_timeout"
+	codeUnavailable         = "unavailable"
+	codeInternal            = "internal_error"
+)
+
+// apiError is an error that knows how it should be reported to the client
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+	Details any
+	Err     error
+}
+
+func (e *apiError) Error() string {
+	if e.Err != nil && e.Message == "" {
+		return e.Err.Error()
+	}
+
+	return e.Message
+}
+
+func (e *apiError) Unwrap() error {
+	return e.Err
+}
+
+func newAPIError(status int, code, message string) *apiError {
+	return &apiError{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// upstreamDetails is sent back in the "details" field when an upstream service failed
+type upstreamDetails struct {
+	Service string `json:"service"`
+	Status  int    `json:"status,omitempty"`
+}
+
+// upstreamError maps the status code returned by an upstream service onto the status and
+// code the broker reports, keeping the upstream message when there is one
+func upstreamError(service string, status int, message string) *apiError {
+	e := &apiError{
+		Message: message,
+		Details: upstreamDetails{Service: service, Status: status},
+	}
+
+	switch {
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		e.Status, e.Code = http.StatusUnprocessableEntity, codeValidationFailed
+	case status == http.StatusUnauthorized:
+		e.Status, e.Code = http.StatusUnauthorized, codeUnauthorized
+	case status == http.StatusForbidden:
+		e.Status, e.Code = http.StatusForbidden, codeForbidden
+	case status == http.StatusNotFound:
+		e.Status, e.Code = http.StatusNotFound, codeNotFound
+	case status == http.StatusConflict:
+		e.Status, e.Code = http.StatusConflict, codeConflict
+	case status == http.StatusGatewayTimeout:
+		e.Status, e.Code = http.StatusGatewayTimeout, codeUpstreamTimeout
+	case status == http.StatusServiceUnavailable, status == http.StatusBadGateway:
+		e.Status, e.Code = http.StatusServiceUnavailable, codeUpstreamUnavailable
+	default:
+		e.Status, e.Code = http.StatusBadGateway, codeUpstreamError
+	}
+
+	if e.Message == "" {
+		e.Message = fmt.Sprintf("error calling %s", service)
+	}
+
+	return e
+}
+
+// unavailableError reports an upstream service that could not be reached at all
+func unavailableError(service string, err error) *apiError {
+	return &apiError{
+		Status:  http.StatusServiceUnavailable,
+		Code:    codeUpstreamUnavailable,
+		Message: fmt.Sprintf("%s is unavailable", service),
+		Details: upstreamDetails{Service: service},
+		Err:     err,
+	}
+}
+
+// timeoutError reports an upstream service that didn't answer within the upstream timeout
+func timeoutError(service string, err error) *apiError {
+	return &apiError{
+		Status:  http.StatusGatewayTimeout,
+		Code:    codeUpstreamTimeout,
+		Message: fmt.Sprintf("%s did not answer in time", service),
+		Details: upstreamDetails{Service: service},
+		Err:     err,
+	}
+}
+
+// errorCode returns the default machine readable code for a status code
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeBadRequest
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusUnprocessableEntity:
+		return codeValidationFailed
+	case http.StatusBadGateway:
+		return codeUpstreamError
+	case http.StatusServiceUnavailable:
+		return codeUpstreamUnavailable
+	case http.StatusGatewayTimeout:
+		return codeUpstreamTimeout
+	default:
+		return codeInternal
+	}
+}
+
+// asAPIError returns err as an *apiError. Plain errors become bad requests without a code,
+// so that errorJSON can derive one from whatever status it ends up using.
+func asAPIError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Message: err.Error(),
+		Err:     err,
+	}
+}
@@ -2,16 +2,47 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
 )
 
+// RequestPayload is what clients post to /handle. The action's payload goes in "payload";
+// older clients put it under a key named after the action, which ends up in Legacy.
 type RequestPayload struct {
-	Action    string           `json:"action"`
-	Auth      AuthPayload      `json:"auth,omitempty"`
-	Inventory InventoryPayload `json:"inventory,omitempty"`
-	Order     OrderPayload     `json:"order,omitempty"`
+	Action  string                     `json:"action"`
+	Payload json.RawMessage            `json:"payload,omitempty"`
+	Legacy  map[string]json.RawMessage `json:"-"`
+}
+
+func (rp *RequestPayload) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	if raw, ok := fields["action"]; ok {
+		if err := json.Unmarshal(raw, &rp.Action); err != nil {
+			return fmt.Errorf("action must be a string: %w", err)
+		}
+		delete(fields, "action")
+	}
+
+	if raw, ok := fields["payload"]; ok {
+		rp.Payload = raw
+		delete(fields, "payload")
+	}
+
+	rp.Legacy = fields
+
+	return nil
 }
 
 type AuthPayload struct {
@@ -25,21 +56,82 @@ type InventoryPayload struct {
 	Price       float32 `json:"price"`
 	Stock       int     `json:"stock"`
 	Category    string  `json:"category"`
+	SKU         string  `json:"sku,omitempty"`
+	Location    string  `json:"location,omitempty"`
 }
 
+// OrderItemPayload mirrors data.OrderItem in the order service
 type OrderItemPayload struct {
-	ItemID    string  `json:"item_id"`
-	ItemName  string  `json:"item_name"`
-	ItemPrice float32 `json:"item_price"`
-	Quantity  int16   `json:"quantity"`
+	ProductID    string  `json:"product_id"`
+	ProductName  string  `json:"product_name"`
+	ProductPrice float32 `json:"product_price"`
+	Quantity     int     `json:"quantity"`
+	Category     string  `json:"category,omitempty"`
 }
 
+// DestinationPayload is where an order goes, which picks the tax rules that apply
+type DestinationPayload struct {
+	Country string `json:"country,omitempty"`
+	Region  string `json:"region,omitempty"`
+}
+
+// OrderPayload is an order to place. TotalPrice is accepted for older clients but the
+// order service works the total out itself.
 type OrderPayload struct {
-	ClientID   int32              `json:"client_id"`
-	OrderDate  string             `json:"order_date"`
-	Status     string             `json:"status"`
-	TotalPrice float32            `json:"total_price"`
-	Items      []OrderItemPayload `json:"items"`
+	ClientID       int32              `json:"client_id"`
+	OrderDate      string             `json:"order_date,omitempty"`
+	Status         string             `json:"status"`
+	TotalPrice     float32            `json:"total_price"`
+	Items          []OrderItemPayload `json:"items"`
+	Destination    DestinationPayload `json:"destination"`
+	PromotionCodes []string           `json:"promotion_codes,omitempty"`
+	// ShippingAddressID and BillingAddressID pick the customer's addresses; its defaults
+	// are used when they are left out
+	ShippingAddressID string `json:"shipping_address_id,omitempty"`
+	BillingAddressID  string `json:"billing_address_id,omitempty"`
+}
+
+// registerActions wires every action the broker supports into app.Actions
+func (app *Config) registerActions() {
+	app.Actions.MustRegister(
+		newAction("auth", "Authenticate a user by email and password", "", nil, app.authenticate),
+		withBatch(newAction("inventory", "Add an item to the inventory", "inventory:write", nil, app.addItem), app.addItems),
+		newAction("order", "Place an order", "order:write", nil, app.addOrder),
+		newAction("order.quote", "Price an order with its discounts and tax without placing it", "order:read", nil, app.quoteOrder),
+		newAction("order.get", "Get one order by id", "order:read", nil, app.getOrder),
+		newAction("order.by_client", "List a client's orders, newest first", "order:read", nil, app.ordersByClient),
+		newAction("customer.create", "Add a customer with contact details, shipping and billing addresses and tax ids", "customer:write", nil, app.createCustomer),
+		newAction("customer.get", "Get one customer by id", "customer:read", nil, app.getCustomer),
+		newAction("customer.update", "Replace the details of a customer", "customer:write", nil, app.updateCustomer),
+		newAction("customer.search", "Search customers by email or name", "customer:read", nil, app.searchCustomers),
+		newAction("customer.orders", "List the order history of a customer, newest first", "customer:read", nil, app.customerOrders),
+		newAction("order.search", "Search orders by client, status and order date range", "order:read", nil, app.searchOrders),
+		newAction("order.cancel", "Cancel an order and release its stock", "order:write", nil, app.cancelOrder),
+		newAction("order.cancel_line", "Cancel some or all units of one order line and release their stock", "order:write", nil, app.cancelOrderLine),
+		newAction("order.allocate", "Reserve the stock of a pending order and record where to pick it from, optionally backordering what is out of stock", "order:write", nil, app.allocateOrder),
+		newAction("backorder.list", "Report the backordered units waiting for stock by product", "order:read", nil, app.listBackorders),
+		newAction("backorder.allocate", "Allocate what stock there is to the oldest backorders", "order:write", nil, app.allocateBackorders),
+		newAction("picklist.create", "Put allocated orders on a pick list grouped by location", "picklist:write", nil, app.createPickList),
+		newAction("picklist.get", "Get one pick list by id", "picklist:read", nil, app.getPickList),
+		newAction("picklist.confirm", "Confirm the picked units of a pick list, cancelling short picks", "picklist:write", nil, app.confirmPickList),
+		newAction("shipment.create", "Pack every open unit of a picked order into packages", "shipment:write", nil, app.createShipment),
+		newAction("shipment.get", "Get one shipment by id", "shipment:read", nil, app.getShipment),
+		newAction("shipment.by_order", "List the shipments of an order", "shipment:read", nil, app.shipmentsByOrder),
+		newAction("shipment.ship", "Label every package with a carrier and mark the order shipped", "shipment:write", nil, app.shipShipment),
+		newAction("shipment.track", "Fetch new tracking events and mark delivered shipments", "shipment:write", nil, app.trackShipment),
+		newAction("shipment.label", "Get the label of one package of a shipment", "shipment:read", nil, app.shipmentLabel),
+		newAction("invoice.create", "Issue the numbered invoice of a shipped order", "invoice:write", nil, app.createInvoice),
+		newAction("invoice.get", "Get one invoice by id", "invoice:read", nil, app.getInvoice),
+		newAction("invoice.by_order", "Get the invoice of an order", "invoice:read", nil, app.invoiceByOrder),
+		newAction("invoice.download", "Get an invoice as the pdf or html document it was issued as", "invoice:read", nil, app.downloadInvoice),
+		newAction("inventory.ledger", "List the latest stock movements of an item", "inventory:read", nil, app.inventoryLedger),
+		newAction("inventory.receive", "Put received units of an item on the shelf and allocate them to its backorders", "inventory:write", nil, app.receiveStock),
+		newAction("return.create", "Authorize the return of units of a shipped order", "return:write", nil, app.createReturn),
+		newAction("return.get", "Get one return by id", "return:read", nil, app.getReturn),
+		newAction("return.by_order", "List the returns of an order", "return:read", nil, app.returnsByOrder),
+		newAction("return.receive", "Record the units of a return that arrived", "return:write", nil, app.receiveReturn),
+		newAction("return.inspect", "Record inspection outcomes, restock units and work out the refund", "return:write", nil, app.inspectReturn),
+	)
 }
 
 func (app *Config) Broker(w http.ResponseWriter, r *http.Request) {
@@ -51,144 +143,211 @@ func (app *Config) Broker(w http.ResponseWriter, r *http.Request) {
 	_ = app.writeJSON(w, http.StatusOK, payload)
 }
 
+// ListActions returns the actions currently registered with the broker
+func (app *Config) ListActions(w http.ResponseWriter, r *http.Request) {
+	payload := jsonResponse{
+		Error:   false,
+		Message: "available actions",
+		Data:    app.Actions.List(),
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
 func (app *Config) HandleSubmission(w http.ResponseWriter, r *http.Request) {
 	var requestPayload RequestPayload
 
 	err := app.readJSON(w, r, &requestPayload)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	switch requestPayload.Action {
-	case "auth":
-		app.authenticate(w, requestPayload.Auth)
-	case "inventory":
-		app.addItem(w, requestPayload.Inventory)
-	case "order":
-		app.addOrder(w, requestPayload.Order)
-	default:
-		app.errorJSON(w, errors.New("unknown action"))
+	action, payload, err := app.prepareAction(r, requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
 	}
-}
 
-func (app *Config) addItem(w http.ResponseWriter, entry InventoryPayload) {
-	// create some json we'll send to the inventory microservice
-	jsonData, _ := json.MarshalIndent(entry, "", "\t")
-
-	// call the service
-	request, err := http.NewRequest("POST", "http://inventory-service/inventory", bytes.NewBuffer(jsonData))
+	status, resp, err := action.Handle(r, payload)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	request.Header.Set("Content-Type", "application/json")
+	app.writeJSON(w, status, resp)
+}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		app.errorJSON(w, err)
-		return
+// prepareAction looks up the requested action, checks the caller may run it and decodes
+// and validates its payload
+func (app *Config) prepareAction(r *http.Request, requestPayload RequestPayload) (Action, any, error) {
+	action, ok := app.Actions.Lookup(requestPayload.Action)
+	if !ok {
+		return Action{}, nil, newAPIError(http.StatusBadRequest, codeUnknownAction, "unknown action")
 	}
-	defer response.Body.Close()
 
-	// make sure we get back the correct status code
-	if response.StatusCode != http.StatusAccepted {
-		app.errorJSON(w, errors.New("error calling inventory service"))
-		return
+	if err := app.authorize(r, action.Permission); err != nil {
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) {
+			apiErr = &apiError{Status: http.StatusForbidden, Code: codeForbidden, Err: err}
+		}
+		return Action{}, nil, apiErr
 	}
 
-	// create a varabiel we'll read response.Body into
-	var jsonFromService jsonResponse
+	if err := validateSchema(action, requestPayload.rawPayload(action)); err != nil {
+		return Action{}, nil, err
+	}
 
-	// decode the json from the inventory service
-	err = json.NewDecoder(response.Body).Decode(&jsonFromService)
+	payload, err := requestPayload.decodePayload(action)
 	if err != nil {
-		app.errorJSON(w, err)
-		return
+		return Action{}, nil, &apiError{Status: http.StatusBadRequest, Code: codeInvalidPayload, Err: err}
+	}
+
+	if action.Validate != nil {
+		if err := action.Validate(payload); err != nil {
+			return Action{}, nil, &apiError{Status: http.StatusUnprocessableEntity, Code: codeValidationFailed, Err: err}
+		}
 	}
 
-	app.writeJSON(w, http.StatusAccepted, jsonFromService)
+	return action, payload, nil
 }
 
-func (app *Config) addOrder(w http.ResponseWriter, o OrderPayload) {
-	// create some json we'll send to the order microservice
-	jsonData, _ := json.MarshalIndent(o, "", "\t")
+// authorize checks the caller holds permission; actions without a permission are open to everyone
+func (app *Config) authorize(r *http.Request, permission string) error {
+	if permission == "" || app.Authorize == nil {
+		return nil
+	}
+
+	return app.Authorize(r, permission)
+}
+
+// callService sends payload as JSON to an upstream service, or no body at all when payload
+// is nil, and decodes the json it sends back. Anything but the expected status code is turned into an *apiError that keeps the
+// upstream message and maps the upstream status onto the one we report.
+func (app *Config) callService(r *http.Request, service, method, url string, payload any, expected int) (jsonResponse, error) {
+	var jsonFromService jsonResponse
+
+	// create some json we'll send to the service
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.MarshalIndent(payload, "", "\t")
+		if err != nil {
+			return jsonFromService, err
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	// give up on the service after the upstream timeout, or sooner if the client goes away
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(app.Settings.UpstreamTimeout))
+	defer cancel()
 
 	// call the service
-	request, err := http.NewRequest("POST", "http://order-service/order", bytes.NewBuffer(jsonData))
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-		app.errorJSON(w, err)
-		return
+		return jsonFromService, err
 	}
 
-	request.Header.Set("Content-Type", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		request.Header.Set(requestTimeoutHeader, strconv.FormatInt(time.Until(deadline).Milliseconds(), 10))
+	}
+	request.Header.Set(requestIDHeader, middleware.GetReqID(r.Context()))
+	// only writes are made idempotent; reads are safe to repeat anyway
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" && method != http.MethodGet {
+		request.Header.Set(idempotencyKeyHeader, key)
+	}
+	// only a verified token says who the request is made for, never the client
+	if id := identityFrom(r); id != nil {
+		request.Header.Set(userIDHeader, strconv.Itoa(id.UserID))
+	}
+
+	logger := requestLogger(r).With("upstream", service, "method", method, "url", url)
+	start := time.Now()
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := upstreamClient.Do(request)
 	if err != nil {
-		app.errorJSON(w, err)
-		return
+		observeUpstream(service, 0, start)
+		logger.Error("upstream call failed", "error", err, "latency_ms", msSince(start))
+		if errors.Is(err, context.DeadlineExceeded) {
+			return jsonFromService, timeoutError(service, err)
+		}
+		return jsonFromService, unavailableError(service, err)
 	}
 	defer response.Body.Close()
 
+	observeUpstream(service, response.StatusCode, start)
+
+	logger.Debug("upstream call", "status", response.StatusCode, "latency_ms", msSince(start))
+
+	// decode whatever the service sent back; error responses carry the upstream message
+	decodeErr := json.NewDecoder(response.Body).Decode(&jsonFromService)
+
 	// make sure we get back the correct status code
-	if response.StatusCode != http.StatusAccepted {
-		app.errorJSON(w, errors.New("error calling order service"))
-		return
+	if response.StatusCode != expected {
+		message := ""
+		if decodeErr == nil {
+			message = jsonFromService.Message
+		}
+		return jsonFromService, upstreamError(service, response.StatusCode, message)
 	}
 
-	// create a varabiel we'll read response.Body into
-	var jsonFromService jsonResponse
+	if decodeErr != nil && decodeErr != io.EOF {
+		return jsonFromService, &apiError{
+			Status:  http.StatusBadGateway,
+			Code:    codeUpstreamError,
+			Message: fmt.Sprintf("invalid response from %s", service),
+			Details: upstreamDetails{Service: service, Status: response.StatusCode},
+			Err:     decodeErr,
+		}
+	}
 
-	jsonFromService.Error = false
-	jsonFromService.Message = "Order added!"
+	if jsonFromService.Error {
+		return jsonFromService, upstreamError(service, response.StatusCode, jsonFromService.Message)
+	}
 
-	app.writeJSON(w, http.StatusAccepted, jsonFromService)
+	return jsonFromService, nil
 }
 
-func (app *Config) authenticate(w http.ResponseWriter, a AuthPayload) {
-	// create some json we'll send to the auth microservice
-	jsonData, _ := json.MarshalIndent(a, "", "\t")
-
-	// call the service
-	request, err := http.NewRequest("POST", "http://authentication-service/authenticate", bytes.NewBuffer(jsonData))
+func (app *Config) addItem(r *http.Request, entry *InventoryPayload) (int, jsonResponse, error) {
+	jsonFromService, err := app.callService(r, "inventory-service", "POST", app.Settings.InventoryURL+"/inventory", entry, http.StatusAccepted)
 	if err != nil {
-		app.errorJSON(w, err)
-		return
+		return 0, jsonResponse{}, err
 	}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		app.errorJSON(w, err)
-		return
-	}
-	defer response.Body.Close()
+	return http.StatusAccepted, jsonFromService, nil
+}
 
-	// make sure we get back the correct status code
-	if response.StatusCode == http.StatusUnauthorized {
-		app.errorJSON(w, errors.New("invalid credentials"))
-		return
-	} else if response.StatusCode != http.StatusAccepted {
-		app.errorJSON(w, errors.New("error calling auth service"))
-		return
+// addItems adds many items in one call; the inventory service stores all of them or none
+func (app *Config) addItems(r *http.Request, entries []*InventoryPayload) (int, jsonResponse, error) {
+	jsonFromService, err := app.callService(r, "inventory-service", "POST", app.Settings.InventoryURL+"/inventory/batch", entries, http.StatusAccepted)
+	if err != nil {
+		return 0, jsonResponse{}, err
 	}
 
-	// create a varabiel we'll read response.Body into
-	var jsonFromService jsonResponse
+	return http.StatusAccepted, jsonFromService, nil
+}
 
-	// decode the json from the auth service
-	err = json.NewDecoder(response.Body).Decode(&jsonFromService)
+// addOrder places the order and passes on its id and the pricing the order service gave it
+func (app *Config) addOrder(r *http.Request, o *OrderPayload) (int, jsonResponse, error) {
+	jsonFromService, err := app.callService(r, "order-service", "POST", app.Settings.OrderURL+"/order", o, http.StatusAccepted)
 	if err != nil {
-		app.errorJSON(w, err)
-		return
+		return 0, jsonResponse{}, err
 	}
 
-	if jsonFromService.Error {
-		app.errorJSON(w, err, http.StatusUnauthorized)
-		return
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Order added!"
+	payload.Data = jsonFromService.Data
+
+	return http.StatusAccepted, payload, nil
+}
+
+func (app *Config) authenticate(r *http.Request, a *AuthPayload) (int, jsonResponse, error) {
+	jsonFromService, err := app.callService(r, "authentication-service", "POST", app.Settings.AuthURL+"/authenticate", a, http.StatusAccepted)
+	if err != nil {
+		return 0, jsonResponse{}, err
 	}
 
 	var payload jsonResponse
@@ -196,5 +355,5 @@ func (app *Config) authenticate(w http.ResponseWriter, a AuthPayload) {
 	payload.Message = "Authenticated!"
 	payload.Data = jsonFromService.Data
 
-	app.writeJSON(w, http.StatusAccepted, payload)
+	return http.StatusAccepted, payload, nil
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const healthTimeout = 3 * time.Second
+
+// upstreamServices returns the base url of every service the broker talks to, by name
+func (app *Config) upstreamServices() map[string]string {
+	return map[string]string{
+		"authentication-service": app.Settings.AuthURL,
+		"inventory-service":      app.Settings.InventoryURL,
+		"order-service":          app.Settings.OrderURL,
+	}
+}
+
+// serviceHealth is the readiness of one upstream service as seen from the broker
+type serviceHealth struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	Checks    any     `json:"checks,omitempty"`
+}
+
+// systemHealth is the health of the whole warehouse system
+type systemHealth struct {
+	Status   string          `json:"status"`
+	Services []serviceHealth `json:"services"`
+}
+
+// Live reports that the broker process is up and serving requests
+func (app *Config) Live(w http.ResponseWriter, r *http.Request) {
+	payload := jsonResponse{
+		Error:   false,
+		Message: "up",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+// Ready reports whether the broker should get traffic. It has no database of its own,
+// so it is ready for as long as it isn't shutting down.
+func (app *Config) Ready(w http.ResponseWriter, r *http.Request) {
+	if app.draining.Load() {
+		app.errorJSON(w, r, newAPIError(http.StatusServiceUnavailable, codeUnavailable, "shutting down"))
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "ready",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+// Health asks every upstream service whether it is ready, all at once, and reports the
+// health of the whole system. It answers 503 when any service is down.
+func (app *Config) Health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	upstreams := app.upstreamServices()
+	results := make([]serviceHealth, 0, len(upstreams))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, url := range upstreams {
+		wg.Add(1)
+		go func(name, url string) {
+			defer wg.Done()
+
+			res := checkService(ctx, middleware.GetReqID(r.Context()), name, url)
+
+			mu.Lock()
+			results = append(results, res)
+			mu.Unlock()
+		}(name, url)
+	}
+
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	health := systemHealth{Status: "up", Services: results}
+	for _, res := range results {
+		if res.Status != "up" {
+			health.Status = "degraded"
+		}
+	}
+
+	status := http.StatusOK
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("system is %s", health.Status),
+		Data:    health,
+	}
+
+	if health.Status != "up" {
+		status = http.StatusServiceUnavailable
+		payload.Error = true
+		payload.Code = codeUpstreamUnavailable
+	}
+
+	_ = app.writeJSON(w, status, payload)
+}
+
+// checkService calls a service's readiness endpoint and times the round trip
+func checkService(ctx context.Context, requestID, name, url string) serviceHealth {
+	res := serviceHealth{Name: name, Status: "up"}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url+"/health/ready", nil)
+	if err != nil {
+		res.Status, res.Error = "down", err.Error()
+		return res
+	}
+
+	request.Header.Set(requestIDHeader, requestID)
+
+	start := time.Now()
+
+	response, err := upstreamClient.Do(request)
+	res.LatencyMS = msSince(start)
+	if err != nil {
+		observeUpstream(name, 0, start)
+		res.Status, res.Error = "down", err.Error()
+		return res
+	}
+	defer response.Body.Close()
+
+	observeUpstream(name, response.StatusCode, start)
+
+	var jsonFromService jsonResponse
+	if err := json.NewDecoder(response.Body).Decode(&jsonFromService); err == nil {
+		res.Checks = jsonFromService.Data
+	}
+
+	if response.StatusCode != http.StatusOK {
+		res.Status = "down"
+		res.Error = jsonFromService.Message
+		if res.Error == "" {
+			res.Error = fmt.Sprintf("readiness check returned %d", response.StatusCode)
+		}
+	}
+
+	return res
+}
@@ -4,13 +4,17 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log/slog"
 	"net/http"
 )
 
 type jsonResponse struct {
 	Error bool `json:"error"`
+	Code string `json:"code,omitempty"`
 	Message string `json:"message"`
 	Data any `json:"data,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Details any `json:"details,omitempty"`
 }
 
 // readJSON tries to read the body of a request and converts it into JSON
@@ -57,17 +61,38 @@ func (app *Config) writeJSON(w http.ResponseWriter, status int, data any, header
 }
 
 // errorJSON takes an error, and optionally a response status code, and generates and sends
-// a json error response
-func (app *Config) errorJSON(w http.ResponseWriter, err error, status ...int) error {
-	statusCode := http.StatusBadRequest
+// a json error response. An *apiError carries its own status and code; a status passed
+// explicitly takes precedence over both.
+func (app *Config) errorJSON(w http.ResponseWriter, r *http.Request, err error, status ...int) error {
+	apiErr := asAPIError(err)
+
+	statusCode := apiErr.Status
+	code := apiErr.Code
 
 	if len(status) > 0 {
 		statusCode = status[0]
 	}
 
+	if code == "" {
+		code = errorCode(statusCode)
+	}
+
 	var payload jsonResponse
 	payload.Error = true
-	payload.Message = err.Error()
+	payload.Code = code
+	payload.Message = apiErr.Error()
+	payload.RequestID = w.Header().Get(requestIDHeader)
+	payload.Details = apiErr.Details
+
+	level := slog.LevelWarn
+	if statusCode >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	requestLogger(r).Log(r.Context(), level, "request failed",
+		"status", statusCode,
+		"code", payload.Code,
+		"error", payload.Message,
+	)
 
 	return app.writeJSON(w, statusCode, payload)
 }
\ No newline at end of file
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+)
+
+type InvoiceCreatePayload struct {
+	OrderID string `json:"order_id"`
+}
+
+type InvoiceGetPayload struct {
+	ID string `json:"id"`
+}
+
+type InvoiceByOrderPayload struct {
+	OrderID string `json:"order_id"`
+}
+
+type InvoiceDownloadPayload struct {
+	ID     string `json:"id"`
+	Format string `json:"format,omitempty"`
+}
+
+func (app *Config) createInvoice(r *http.Request, p *InvoiceCreatePayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/order/" + url.PathEscape(p.OrderID) + "/invoice"
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, nil, http.StatusCreated)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusCreated, jsonFromService, nil
+}
+
+func (app *Config) getInvoice(r *http.Request, p *InvoiceGetPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/invoices/" + url.PathEscape(p.ID)
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) invoiceByOrder(r *http.Request, p *InvoiceByOrderPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/order/" + url.PathEscape(p.OrderID) + "/invoice"
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) downloadInvoice(r *http.Request, p *InvoiceDownloadPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/invoices/" + url.PathEscape(p.ID) + "/document"
+	if p.Format != "" {
+		u += "?" + url.Values{"format": {p.Format}}.Encode()
+	}
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
@@ -1,29 +1,86 @@
 package main
 
 import (
+	"broker-service/config"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
 )
 
-const webPort = "80"
+type Config struct {
+	// Settings is the configuration the broker was started with
+	Settings *config.Config
+	Actions  *ActionRegistry
+	// Authorize decides whether a request may run an action that requires the given
+	// permission; an *apiError it returns is reported as it is
+	Authorize func(r *http.Request, permission string) error
 
-type Config struct {}
+	// draining is set once shutdown has started, so that readiness checks fail
+	draining atomic.Bool
+}
 
 func main() {
-	app := Config{}
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Parse()
 
-	log.Printf("Starting broker service on port %s\n", webPort)
+	cfg, err := config.Load()
+	if err != nil {
+		newLogger("broker-service", "info").Error("loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		fmt.Println(cfg.Redacted())
+		return
+	}
+
+	newLogger("broker-service", cfg.LogLevel)
+	slog.Info("configuration loaded", "config", json.RawMessage(cfg.Redacted()))
+
+	shutdownTracing, err := setupTracing(context.Background(), "broker-service")
+	if err != nil {
+		slog.Error("setting up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	app := &Config{
+		Settings: cfg,
+		Actions: NewActionRegistry(),
+		Authorize: tokenPermissions,
+	}
+	app.registerActions()
+
+	slog.Info("starting broker service", "port", cfg.WebPort)
 
 	// define http server
 	srv := &http.Server{
-		Addr: fmt.Sprintf(":%s", webPort),
+		Addr: fmt.Sprintf(":%d", cfg.WebPort),
 		Handler: app.routes(),
 	}
 
 	// start the server
-	err := srv.ListenAndServe()
-	if err != nil {
-		log.Panic(err)
+	serveErr := app.serve(srv)
+	if serveErr != nil {
+		slog.Error("broker service stopped", "error", serveErr)
+	}
+
+	// no requests are running any more: flush spans
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("flushing traces", "error", err)
+	}
+
+	slog.Info("broker service stopped")
+
+	if serveErr != nil {
+		os.Exit(1)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// requestIDHeader carries the id that ties together the log lines of one request as it
+// travels from the broker through the services
+const requestIDHeader = "X-Request-ID"
+
+// requestTimeoutHeader tells an upstream service how many milliseconds the broker will
+// wait for its answer, so that it can stop working on requests the broker gave up on
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// echoRequestID sends the request id back to the caller, so that it shows up in every
+// response, including errors. It must run after middleware.RequestID.
+func echoRequestID(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(requestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// idempotencyKeyHeader lets clients retry writes safely. The broker passes the key on to
+// the service doing the write, which replays its first response for a repeated key.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength leaves room for the entry index the broker appends to the key
+// of every entry of a batch; the services accept keys of up to 255 characters
+const maxIdempotencyKeyLength = 200
+
+// internalKeyPrefix starts the idempotency keys the services make up for their calls to
+// one another; clients can't use it, so they can't take or replay those keys
+const internalKeyPrefix = "internal/"
+
+// checkIdempotencyKey rejects idempotency keys the services would not accept
+func (app *Config) checkIdempotencyKey(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if len(key) > maxIdempotencyKeyLength {
+			app.errorJSON(w, r, newAPIError(http.StatusBadRequest, codeBadRequest,
+				fmt.Sprintf("%s must not be longer than %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength)))
+			return
+		}
+		if strings.HasPrefix(key, internalKeyPrefix) {
+			app.errorJSON(w, r, newAPIError(http.StatusBadRequest, codeBadRequest,
+				fmt.Sprintf("%s must not start with %q, it is kept for the services", idempotencyKeyHeader, internalKeyPrefix)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
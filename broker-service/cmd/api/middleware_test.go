@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckIdempotencyKey(t *testing.T) {
+	app := &Config{}
+	h := app.checkIdempotencyKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		key    string
+		status int
+	}{
+		{"none", "", http.StatusOK},
+		{"client key", "order/42/cancel", http.StatusOK},
+		{"internal key", internalKeyPrefix + "order/42/cancellation/0", http.StatusBadRequest},
+		{"too long", strings.Repeat("k", maxIdempotencyKeyLength+1), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/handle", nil)
+			if tt.key != "" {
+				r.Header.Set(idempotencyKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
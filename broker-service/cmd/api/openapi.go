@@ -0,0 +1,334 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// OpenAPI serves an OpenAPI 3.1 description of the broker. It is built from the action
+// registry and the Go types of the responses every time, so it can't drift from the code.
+func (app *Config) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	out, err := json.MarshalIndent(app.openAPIDocument(), "", "  ")
+	if err != nil {
+		app.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(out)
+}
+
+// Docs serves a small page that renders the OpenAPI document
+func (app *Config) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(docsPage)
+}
+
+type object = map[string]any
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema object) object {
+	return object{"application/json": object{"schema": schema}}
+}
+
+func response(description string, schema object) object {
+	return object{"description": description, "content": jsonContent(schema)}
+}
+
+func (app *Config) openAPIDocument() object {
+	schemas := object{
+		"Response":     schemaFor(reflect.TypeOf(jsonResponse{})),
+		"FieldError":   schemaFor(reflect.TypeOf(fieldError{})),
+		"ActionInfo":   schemaFor(reflect.TypeOf(ActionInfo{})),
+		"BatchResult":  schemaFor(reflect.TypeOf(batchResult{})),
+		"BatchSummary": schemaFor(reflect.TypeOf(batchSummary{})),
+	}
+
+	// every action gets its payload schema and a request schema wrapping it
+	actions := app.Actions.List()
+	requests := make([]any, 0, len(actions))
+	mapping := object{}
+
+	for _, info := range actions {
+		a, _ := app.Actions.Lookup(info.Name)
+
+		payloadName := schemaName(a.Name) + "Payload"
+		requestName := schemaName(a.Name) + "Request"
+
+		payload := object{}
+		if a.schemaDoc != nil {
+			_ = json.Unmarshal(a.schemaDoc, &payload)
+			delete(payload, "$schema")
+			delete(payload, "$id")
+		} else {
+			payload = schemaFor(reflect.TypeOf(a.Payload()).Elem())
+		}
+		schemas[payloadName] = payload
+
+		schemas[requestName] = object{
+			"type":        "object",
+			"description": a.Description,
+			"required":    []string{"action", "payload"},
+			"properties": object{
+				"action":  object{"type": "string", "const": a.Name},
+				"payload": ref(payloadName),
+			},
+		}
+
+		requests = append(requests, ref(requestName))
+		mapping[a.Name] = "#/components/schemas/" + requestName
+	}
+
+	schemas["ActionRequest"] = object{
+		"oneOf":         requests,
+		"discriminator": object{"propertyName": "action", "mapping": mapping},
+	}
+
+	schemas["BatchRequest"] = object{
+		"type":     "object",
+		"required": []string{"actions"},
+		"properties": object{
+			"atomic":  object{"type": "boolean", "description": "apply every action or none; all actions must be the same and support batches"},
+			"actions": object{"type": "array", "maxItems": maxBatchSize, "items": ref("ActionRequest")},
+		},
+	}
+
+	schemas["ErrorResponse"] = object{
+		"allOf": []any{
+			ref("Response"),
+			object{
+				"properties": object{
+					"error":   object{"const": true},
+					"code":    object{"type": "string"},
+					"details": object{"description": "a list of FieldError for validation failures, or the upstream service and status"},
+				},
+				"required": []string{"code"},
+			},
+		},
+	}
+
+	errorResponse := func(description string) object {
+		return response(description, ref("ErrorResponse"))
+	}
+
+	idempotencyKey := object{
+		"name":        idempotencyKeyHeader,
+		"in":          "header",
+		"description": "retrying a write with the same key replays the first response instead of writing again; keys expire after a day, and keys starting with " + internalKeyPrefix + " are kept for the services",
+		"schema":      object{"type": "string", "maxLength": maxIdempotencyKeyLength},
+	}
+
+	return object{
+		"openapi": "3.1.0",
+		"info": object{
+			"title":       "Warehouse broker API",
+			"version":     "1.0.0",
+			"description": "Single entry point to the warehouse services. Every operation is an action posted to /handle.",
+		},
+		"paths": object{
+			"/": object{
+				"post": object{
+					"summary":   "Check the broker is up",
+					"responses": object{"200": response("broker is up", ref("Response"))},
+				},
+			},
+			"/handle": object{
+				"post": object{
+					"summary":     "Run an action",
+					"parameters":  []any{idempotencyKey},
+					"security":    []any{object{}, object{"bearer": []any{}}},
+					"requestBody": object{"required": true, "content": jsonContent(ref("ActionRequest"))},
+					"responses": object{
+						"200": response("action done", ref("Response")),
+						"201": response("action created a resource", ref("Response")),
+						"202": response("action accepted by the upstream service", ref("Response")),
+						"400": errorResponse("malformed request or unknown action"),
+						"401": errorResponse("invalid credentials, or a missing, invalid or expired bearer token"),
+						"403": errorResponse("the bearer token lacks the action's permission"),
+						"404": errorResponse("upstream resource not found"),
+						"409": errorResponse("upstream conflict, or a request with the same idempotency key is still running"),
+						"422": errorResponse("payload failed validation, or the idempotency key was used for a different request"),
+						"502": errorResponse("upstream service failed"),
+						"503": errorResponse("upstream service unavailable"),
+						"504": errorResponse("upstream service did not answer in time"),
+					},
+				},
+			},
+			"/handle/batch": object{
+				"post": object{
+					"summary":     "Run many actions in one request",
+					"parameters":  []any{idempotencyKey},
+					"security":    []any{object{}, object{"bearer": []any{}}},
+					"requestBody": object{"required": true, "content": jsonContent(ref("BatchRequest"))},
+					"responses": object{
+						"200": response("per action results", ref("Response")),
+						"202": response("atomic batch applied", ref("Response")),
+						"400": errorResponse("malformed batch"),
+						"422": errorResponse("atomic batch rejected"),
+					},
+				},
+			},
+			"/health/live": object{
+				"get": object{
+					"summary":   "Check the broker process is up",
+					"responses": object{"200": response("broker is up", ref("Response"))},
+				},
+			},
+			"/health": object{
+				"get": object{
+					"summary": "Check the readiness of every upstream service",
+					"responses": object{
+						"200": response("every service is ready", ref("Response")),
+						"503": response("at least one service is down", ref("Response")),
+					},
+				},
+			},
+			"/actions": object{
+				"get": object{
+					"summary":   "List the registered actions",
+					"responses": object{"200": response("registered actions", ref("Response"))},
+				},
+			},
+			"/schemas": object{
+				"get": object{
+					"summary":   "Get the payload schema of every action",
+					"responses": object{"200": response("schemas keyed by action", ref("Response"))},
+				},
+			},
+			"/schemas/{action}": object{
+				"get": object{
+					"summary": "Get the payload schema of one action",
+					"parameters": []any{
+						object{"name": "action", "in": "path", "required": true, "schema": object{"type": "string"}},
+					},
+					"responses": object{
+						"200": object{"description": "the json schema", "content": object{"application/schema+json": object{"schema": object{"type": "object"}}}},
+						"404": errorResponse("no such action"),
+					},
+				},
+			},
+		},
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"bearer": object{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "the token the auth action answers with; actions with a permission need it",
+				},
+			},
+		},
+	}
+}
+
+// schemaName turns an action name like "inventory.adjust" into "InventoryAdjust"
+func schemaName(action string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(action, func(r rune) bool { return r == '.' || r == '_' || r == '-' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+
+	return b.String()
+}
+
+// schemaFor describes a Go type as a json schema, following its json tags
+func schemaFor(t reflect.Type) object {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(json.RawMessage{}):
+		return object{}
+	case reflect.TypeOf(time.Time{}):
+		return object{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	case reflect.Struct:
+		properties := object{}
+		var required []string
+		for _, f := range jsonFields(t) {
+			properties[f.name] = schemaFor(f.typ)
+			if !f.omitempty {
+				required = append(required, f.name)
+			}
+		}
+		s := object{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	default:
+		// interfaces can hold anything
+		return object{}
+	}
+}
+
+type jsonField struct {
+	name      string
+	typ       reflect.Type
+	omitempty bool
+}
+
+// jsonFields lists the fields encoding/json would use for a struct, flattening embedded structs
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(f.Type)...)
+			continue
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields = append(fields, jsonField{
+			name:      name,
+			typ:       f.Type,
+			omitempty: strings.Contains(opts, "omitempty"),
+		})
+	}
+
+	return fields
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// PageParams picks one page of a list; the order service fills in whatever is left out
+type PageParams struct {
+	Page     int `json:"page,omitempty"`
+	PageSize int `json:"page_size,omitempty"`
+}
+
+func (p PageParams) encode(q url.Values) {
+	if p.Page > 0 {
+		q.Set("page", strconv.Itoa(p.Page))
+	}
+	if p.PageSize > 0 {
+		q.Set("page_size", strconv.Itoa(p.PageSize))
+	}
+}
+
+type OrderGetPayload struct {
+	ID string `json:"id"`
+}
+
+type OrdersByClientPayload struct {
+	ClientID int32 `json:"client_id"`
+	PageParams
+}
+
+// OrderSearchPayload filters orders; From and To are RFC 3339 times or plain dates
+type OrderSearchPayload struct {
+	ClientID int32  `json:"client_id,omitempty"`
+	Status   string `json:"status,omitempty"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	PageParams
+}
+
+func (app *Config) getOrder(r *http.Request, p *OrderGetPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/order/" + url.PathEscape(p.ID)
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) ordersByClient(r *http.Request, p *OrdersByClientPayload) (int, jsonResponse, error) {
+	q := url.Values{}
+	p.encode(q)
+
+	u := app.Settings.OrderURL + "/clients/" + strconv.Itoa(int(p.ClientID)) + "/orders"
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) searchOrders(r *http.Request, p *OrderSearchPayload) (int, jsonResponse, error) {
+	q := url.Values{}
+	if p.ClientID != 0 {
+		q.Set("client_id", strconv.Itoa(int(p.ClientID)))
+	}
+	if p.Status != "" {
+		q.Set("status", p.Status)
+	}
+	if p.From != "" {
+		q.Set("from", p.From)
+	}
+	if p.To != "" {
+		q.Set("to", p.To)
+	}
+	p.encode(q)
+
+	u := app.Settings.OrderURL + "/orders"
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+type OrderCancelPayload struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// OrderCancelLinePayload cancels Quantity units of a line, or all of its open units when
+// Quantity is left out
+type OrderCancelLinePayload struct {
+	ID       string `json:"id"`
+	Line     int    `json:"line"`
+	Quantity int    `json:"quantity,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func (app *Config) cancelOrder(r *http.Request, p *OrderCancelPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/order/" + url.PathEscape(p.ID) + "/cancel"
+
+	body := map[string]any{"reason": p.Reason}
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, body, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) cancelOrderLine(r *http.Request, p *OrderCancelLinePayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/order/" + url.PathEscape(p.ID) + "/lines/" + strconv.Itoa(p.Line) + "/cancel"
+
+	body := map[string]any{"reason": p.Reason, "quantity": p.Quantity}
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, body, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) quoteOrder(r *http.Request, p *OrderPayload) (int, jsonResponse, error) {
+	jsonFromService, err := app.callService(r, "order-service", "POST", app.Settings.OrderURL+"/order/quote", p, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
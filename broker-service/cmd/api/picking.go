@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// OrderAllocatePayload allocates a pending or backordered order. With Backorder the units
+// that are out of stock are split off into a backorder instead of refusing the order.
+type OrderAllocatePayload struct {
+	ID        string `json:"id"`
+	Backorder bool   `json:"backorder,omitempty"`
+}
+
+type PickListCreatePayload struct {
+	OrderIDs  []string `json:"order_ids,omitempty"`
+	MaxOrders int      `json:"max_orders,omitempty"`
+}
+
+type PickListGetPayload struct {
+	ID string `json:"id"`
+}
+
+// PickConfirmationPayload is the number of units picked for one order line
+type PickConfirmationPayload struct {
+	OrderID string `json:"order_id"`
+	Line    int    `json:"line"`
+	Picked  int    `json:"picked"`
+}
+
+type PickListConfirmPayload struct {
+	ID    string                    `json:"id"`
+	Lines []PickConfirmationPayload `json:"lines"`
+}
+
+type InventoryLedgerPayload struct {
+	ItemID string `json:"item_id"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+func (app *Config) allocateOrder(r *http.Request, p *OrderAllocatePayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/order/" + url.PathEscape(p.ID) + "/allocate"
+
+	body := map[string]any{"backorder": p.Backorder}
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, body, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) createPickList(r *http.Request, p *PickListCreatePayload) (int, jsonResponse, error) {
+	jsonFromService, err := app.callService(r, "order-service", "POST", app.Settings.OrderURL+"/picklists", p, http.StatusCreated)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusCreated, jsonFromService, nil
+}
+
+func (app *Config) getPickList(r *http.Request, p *PickListGetPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/picklists/" + url.PathEscape(p.ID)
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) confirmPickList(r *http.Request, p *PickListConfirmPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/picklists/" + url.PathEscape(p.ID) + "/confirm"
+
+	body := map[string]any{"lines": p.Lines}
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, body, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) inventoryLedger(r *http.Request, p *InventoryLedgerPayload) (int, jsonResponse, error) {
+	u := app.Settings.InventoryURL + "/inventory/" + url.PathEscape(p.ItemID) + "/ledger"
+	if p.Limit > 0 {
+		u += "?limit=" + strconv.Itoa(p.Limit)
+	}
+
+	jsonFromService, err := app.callService(r, "inventory-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// ReturnLinePayload is a number of units of one order line
+type ReturnLinePayload struct {
+	Line     int `json:"line"`
+	Quantity int `json:"quantity"`
+}
+
+// InspectionPayload says what becomes of the received units of one order line
+type InspectionPayload struct {
+	Line      int `json:"line"`
+	Restock   int `json:"restock"`
+	Refurbish int `json:"refurbish"`
+	Scrap     int `json:"scrap"`
+}
+
+type ReturnCreatePayload struct {
+	OrderID string              `json:"order_id"`
+	Reason  string              `json:"reason"`
+	Lines   []ReturnLinePayload `json:"lines"`
+}
+
+type ReturnGetPayload struct {
+	ID string `json:"id"`
+}
+
+type ReturnsByOrderPayload struct {
+	OrderID string `json:"order_id"`
+}
+
+type ReturnReceivePayload struct {
+	ID    string              `json:"id"`
+	Lines []ReturnLinePayload `json:"lines"`
+}
+
+type ReturnInspectPayload struct {
+	ID    string              `json:"id"`
+	Lines []InspectionPayload `json:"lines"`
+}
+
+func (app *Config) createReturn(r *http.Request, p *ReturnCreatePayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/order/" + url.PathEscape(p.OrderID) + "/returns"
+
+	body := map[string]any{"reason": p.Reason, "lines": p.Lines}
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, body, http.StatusCreated)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusCreated, jsonFromService, nil
+}
+
+func (app *Config) getReturn(r *http.Request, p *ReturnGetPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/returns/" + url.PathEscape(p.ID)
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) returnsByOrder(r *http.Request, p *ReturnsByOrderPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/order/" + url.PathEscape(p.OrderID) + "/returns"
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) receiveReturn(r *http.Request, p *ReturnReceivePayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/returns/" + url.PathEscape(p.ID) + "/receive"
+
+	body := map[string]any{"lines": p.Lines}
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, body, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) inspectReturn(r *http.Request, p *ReturnInspectPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/returns/" + url.PathEscape(p.ID) + "/inspect"
+
+	body := map[string]any{"lines": p.Lines}
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, body, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
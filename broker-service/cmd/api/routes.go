@@ -6,6 +6,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func (app *Config) routes() http.Handler {
@@ -15,17 +16,50 @@ func (app *Config) routes() http.Handler {
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"https://*", "http://*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders: []string{"Link"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key", "X-Request-ID", "X-Request-Timeout"},
+		ExposedHeaders: []string{"Link", "X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge: 300,
 	}))
 
 	mux.Use(middleware.Heartbeat("/ping"))
 
+	// continue the caller's trace, or start a new one
+	mux.Use(traceRequests("broker-service"))
+	mux.Use(nameSpan)
+
+	// accept the caller's X-Request-ID or assign one, and log every request with it
+	mux.Use(middleware.RequestID)
+	mux.Use(echoRequestID)
+	mux.Use(accessLog)
+	mux.Use(instrument)
+
+	// check the bearer token of callers that send one
+	mux.Use(app.identify)
+
+	mux.Handle("/metrics", promhttp.Handler())
+
+	mux.Get("/health/live", app.Live)
+
+	mux.Get("/health/ready", app.Ready)
+
+	mux.Get("/health", app.Health)
+
 	mux.Post("/", app.Broker)
 
-	mux.Post("/handle", app.HandleSubmission)
+	mux.With(app.checkIdempotencyKey).Post("/handle", app.HandleSubmission)
+
+	mux.With(app.checkIdempotencyKey).Post("/handle/batch", app.HandleBatch)
+
+	mux.Get("/actions", app.ListActions)
+
+	mux.Get("/schemas", app.ListSchemas)
+
+	mux.Get("/schemas/{action}", app.GetSchema)
+
+	mux.Get("/openapi.json", app.OpenAPI)
+
+	mux.Get("/docs", app.Docs)
 
 	return mux
 }
\ No newline at end of file
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// the json schema of every action's payload lives in schemas/<action>.json
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// fieldError is one entry of the field level error list sent back when a payload
+// doesn't match its schema. Field is a JSON pointer into the payload, e.g. /items/0/quantity.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validationError reports every field of a payload that failed schema validation
+type validationError struct {
+	Fields []fieldError
+}
+
+func (e *validationError) Error() string {
+	if len(e.Fields) == 1 {
+		return fmt.Sprintf("%s: %s", e.Fields[0].Field, e.Fields[0].Message)
+	}
+
+	return fmt.Sprintf("payload has %d invalid fields", len(e.Fields))
+}
+
+// loadSchema reads and compiles the schema with the given name from the embedded schema files
+func loadSchema(name string) (*jsonschema.Schema, json.RawMessage, error) {
+	file := name + ".json"
+
+	doc, err := schemaFiles.ReadFile(path.Join("schemas", file))
+	if err != nil {
+		return nil, nil, fmt.Errorf("no schema for %q: %w", name, err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+
+	if err := compiler.AddResource(file, bytes.NewReader(doc)); err != nil {
+		return nil, nil, fmt.Errorf("invalid schema for %q: %w", name, err)
+	}
+
+	schema, err := compiler.Compile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid schema for %q: %w", name, err)
+	}
+
+	return schema, json.RawMessage(doc), nil
+}
+
+// checkSchemaFields makes sure a schema describes exactly the json fields of the Go type
+// its payload is decoded into, so the schemas served to clients can't drift from the code
+func checkSchemaFields(doc json.RawMessage, t reflect.Type) error {
+	var schema map[string]any
+	if err := json.Unmarshal(doc, &schema); err != nil {
+		return err
+	}
+
+	return compareFields("", schema, t)
+}
+
+func compareFields(at string, schema map[string]any, t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			return nil
+		}
+		return compareFields(at+"/items", items, t.Elem())
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	properties, ok := schema["properties"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	fields := make(map[string]reflect.Type)
+	for _, f := range jsonFields(t) {
+		fields[f.name] = f.typ
+	}
+
+	for name := range properties {
+		if _, ok := fields[name]; !ok {
+			return fmt.Errorf("schema property %s/%s has no field in %s", at, name, t.Name())
+		}
+	}
+
+	for name, typ := range fields {
+		property, ok := properties[name].(map[string]any)
+		if !ok {
+			return fmt.Errorf("field %s.%s is missing from the schema at %s", t.Name(), name, at)
+		}
+		if err := compareFields(at+"/"+name, property, typ); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateSchema checks a raw payload against the action's schema and turns any failure into
+// a list of field errors
+func validateSchema(a Action, raw json.RawMessage) error {
+	if a.schema == nil {
+		return nil
+	}
+
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Code: codeInvalidPayload, Err: err}
+	}
+
+	err := a.schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+
+	verr := &validationError{Fields: leafErrors(ve)}
+
+	return &apiError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    codeValidationFailed,
+		Message: verr.Error(),
+		Details: verr.Fields,
+		Err:     verr,
+	}
+}
+
+// leafErrors flattens a validation error into the errors that actually point at a field,
+// skipping the "doesn't validate with" wrappers around them
+func leafErrors(ve *jsonschema.ValidationError) []fieldError {
+	if len(ve.Causes) == 0 {
+		field := ve.InstanceLocation
+		if field == "" {
+			field = "/"
+		}
+		return []fieldError{{Field: field, Message: ve.Message}}
+	}
+
+	var fields []fieldError
+	for _, cause := range ve.Causes {
+		fields = append(fields, leafErrors(cause)...)
+	}
+
+	return fields
+}
+
+// ListSchemas returns the payload schema of every action, keyed by action name
+func (app *Config) ListSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas := make(map[string]json.RawMessage)
+
+	for _, info := range app.Actions.List() {
+		a, _ := app.Actions.Lookup(info.Name)
+		if a.schemaDoc != nil {
+			schemas[a.Name] = a.schemaDoc
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "action schemas",
+		Data:    schemas,
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetSchema serves the raw json schema for one action's payload
+func (app *Config) GetSchema(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "action")
+
+	a, ok := app.Actions.Lookup(name)
+	if !ok || a.schemaDoc == nil {
+		app.errorJSON(w, r, newAPIError(http.StatusNotFound, codeNotFound, fmt.Sprintf("no schema for action %q", name)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(a.schemaDoc)
+}
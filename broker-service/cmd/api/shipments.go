@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// PackageSpecPayload is one package as the packer made it up
+type PackageSpecPayload struct {
+	WeightKg float64             `json:"weight_kg"`
+	LengthCm float64             `json:"length_cm"`
+	WidthCm  float64             `json:"width_cm"`
+	HeightCm float64             `json:"height_cm"`
+	Lines    []ReturnLinePayload `json:"lines"`
+}
+
+type ShipmentCreatePayload struct {
+	OrderID  string               `json:"order_id"`
+	Packages []PackageSpecPayload `json:"packages"`
+}
+
+type ShipmentGetPayload struct {
+	ID string `json:"id"`
+}
+
+type ShipmentsByOrderPayload struct {
+	OrderID string `json:"order_id"`
+}
+
+type ShipmentShipPayload struct {
+	ID      string `json:"id"`
+	Carrier string `json:"carrier,omitempty"`
+	Service string `json:"service,omitempty"`
+}
+
+type ShipmentLabelPayload struct {
+	ID      string `json:"id"`
+	Package int    `json:"package"`
+}
+
+func (app *Config) createShipment(r *http.Request, p *ShipmentCreatePayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/order/" + url.PathEscape(p.OrderID) + "/shipments"
+
+	body := map[string]any{"packages": p.Packages}
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, body, http.StatusCreated)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusCreated, jsonFromService, nil
+}
+
+func (app *Config) getShipment(r *http.Request, p *ShipmentGetPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/shipments/" + url.PathEscape(p.ID)
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) shipmentsByOrder(r *http.Request, p *ShipmentsByOrderPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/order/" + url.PathEscape(p.OrderID) + "/shipments"
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) shipShipment(r *http.Request, p *ShipmentShipPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/shipments/" + url.PathEscape(p.ID) + "/ship"
+
+	body := map[string]any{"carrier": p.Carrier, "service": p.Service}
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, body, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) trackShipment(r *http.Request, p *ShipmentGetPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/shipments/" + url.PathEscape(p.ID) + "/track"
+
+	jsonFromService, err := app.callService(r, "order-service", "POST", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
+
+func (app *Config) shipmentLabel(r *http.Request, p *ShipmentLabelPayload) (int, jsonResponse, error) {
+	u := app.Settings.OrderURL + "/shipments/" + url.PathEscape(p.ID) + "/packages/" + strconv.Itoa(p.Package) + "/label"
+
+	jsonFromService, err := app.callService(r, "order-service", "GET", u, nil, http.StatusOK)
+	if err != nil {
+		return 0, jsonResponse{}, err
+	}
+
+	return http.StatusOK, jsonFromService, nil
+}
@@ -0,0 +1,81 @@
+// Package config holds the settings of the broker service
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type Config struct {
+	WebPort         int      `json:"web_port" env:"WEB_PORT"`
+	LogLevel        string   `json:"log_level" env:"LOG_LEVEL"`
+	AuthURL         string   `json:"auth_url" env:"AUTH_SERVICE_URL"`
+	InventoryURL    string   `json:"inventory_url" env:"INVENTORY_SERVICE_URL"`
+	OrderURL        string   `json:"order_url" env:"ORDER_SERVICE_URL"`
+	UpstreamTimeout Duration `json:"upstream_timeout" env:"UPSTREAM_TIMEOUT"`
+	// BatchConcurrency caps the upstream calls a single batch makes at once
+	BatchConcurrency int      `json:"batch_concurrency" env:"BATCH_CONCURRENCY"`
+	ShutdownTimeout  Duration `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// DrainDelay is how long a stopping service keeps serving after its readiness check
+	// starts failing, so that load balancers stop sending it requests first
+	DrainDelay Duration `json:"drain_delay" env:"DRAIN_DELAY"`
+	// TokenSecret checks the tokens the authentication service signs with the same secret
+	TokenSecret string `json:"token_secret" env:"TOKEN_SECRET" secret:"true"`
+}
+
+func defaults() *Config {
+	return &Config{
+		WebPort:          80,
+		LogLevel:         "info",
+		AuthURL:          "http://authentication-service",
+		InventoryURL:     "http://inventory-service",
+		OrderURL:         "http://order-service",
+		UpstreamTimeout:  Duration(10 * time.Second),
+		BatchConcurrency: 8,
+		ShutdownTimeout:  Duration(20 * time.Second),
+		DrainDelay:       Duration(5 * time.Second),
+	}
+}
+
+// Validate reports every setting that is out of range, not just the first
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.WebPort < 1 || c.WebPort > 65535 {
+		errs = append(errs, fmt.Errorf("web_port %d is not a valid port", c.WebPort))
+	}
+
+	for name, u := range map[string]string{"auth_url": c.AuthURL, "inventory_url": c.InventoryURL, "order_url": c.OrderURL} {
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("%s %q is not an absolute url", name, u))
+		}
+	}
+
+	if c.UpstreamTimeout <= 0 {
+		errs = append(errs, errors.New("upstream_timeout must be positive"))
+	}
+
+	if c.BatchConcurrency < 1 {
+		errs = append(errs, errors.New("batch_concurrency must be at least 1"))
+	}
+
+	switch {
+	case c.TokenSecret == "":
+		errs = append(errs, errors.New("token_secret is required: set TOKEN_SECRET, or TOKEN_SECRET_FILE to a file holding it, such as one made with openssl rand -base64 48"))
+	case len(c.TokenSecret) < 32:
+		errs = append(errs, errors.New("token_secret must be at least 32 characters"))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+
+	if c.DrainDelay < 0 {
+		errs = append(errs, errors.New("drain_delay must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
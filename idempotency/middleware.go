@@ -0,0 +1,158 @@
+// Package idempotency lets callers retry writes safely. A request sent with an
+// Idempotency-Key stores its response, and later requests with the same key get that
+// response back instead of writing a second time.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// KeyHeader carries the key a caller sends with a request it may retry
+const KeyHeader = "Idempotency-Key"
+
+// ReplayedHeader is set on responses replayed for a repeated key
+const ReplayedHeader = "Idempotent-Replayed"
+
+// UserHeader identifies the caller. Keys are kept per caller, so that one caller can
+// neither replay nor block the requests of another by sending the same key.
+const UserHeader = "X-User-ID"
+
+// MaxKeyLength is the longest key a caller may send
+const MaxKeyLength = 255
+
+// statusClientClosedRequest is reported when the caller went away before it was answered
+const statusClientClosedRequest = 499
+
+// Middleware stores the response to every request sent with an Idempotency-Key and
+// replays it for later requests of the same caller with the same key until the key
+// expires. A key reused for a different request is rejected, and so is a repeat that
+// arrives while the first request is still running. Failures on the service's side
+// aren't stored, so that they can be retried.
+type Middleware struct {
+	Store Store
+	// TTL is how long a key is kept
+	TTL time.Duration
+	// Error answers a request the middleware refuses. status is 0 when the store failed,
+	// which leaves it to the service to pick the status for err.
+	Error func(w http.ResponseWriter, r *http.Request, err error, status int)
+	// Logger returns the logger of a request
+	Logger func(r *http.Request) *slog.Logger
+}
+
+// Handler wraps next in the middleware
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(KeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > MaxKeyLength {
+			m.Error(w, r, fmt.Errorf("%s must not be longer than %d characters", KeyHeader, MaxKeyLength), http.StatusBadRequest)
+			return
+		}
+
+		// the body is part of the fingerprint, so it is read here and handed on in a new reader
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+		if err != nil {
+			m.Error(w, r, err, http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		user := r.Header.Get(UserHeader)
+		now := time.Now()
+		record := Record{
+			Key:         StorageKey(user, key),
+			Fingerprint: Fingerprint(r, user, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(m.TTL),
+		}
+
+		existing, err := m.Store.Reserve(r.Context(), record)
+		if errors.Is(err, ErrKeyInUse) {
+			m.replay(w, r, key, existing, record.Fingerprint)
+			return
+		}
+		if err != nil {
+			m.Error(w, r, err, 0)
+			return
+		}
+
+		var out bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&out)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		// the request's own deadline may have passed by now, but the outcome still has to be kept
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+		defer cancel()
+
+		logger := m.Logger(r).With("idempotency_key", key)
+
+		if status >= http.StatusInternalServerError || status == statusClientClosedRequest {
+			if err := m.Store.Release(ctx, record.Key); err != nil {
+				logger.Error("releasing idempotency key", "error", err)
+			}
+			return
+		}
+
+		if err := m.Store.Complete(ctx, record.Key, status, out.Bytes()); err != nil {
+			logger.Error("storing idempotent response", "error", err)
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// replay answers a request whose key is already taken
+func (m *Middleware) replay(w http.ResponseWriter, r *http.Request, key string, existing *Record, fingerprint string) {
+	switch {
+	case existing.Fingerprint != fingerprint:
+		m.Error(w, r, fmt.Errorf("%s has already been used for a different request", KeyHeader), http.StatusUnprocessableEntity)
+	case !existing.Done():
+		m.Error(w, r, fmt.Errorf("a request with this %s is still being processed", KeyHeader), http.StatusConflict)
+	default:
+		m.Logger(r).Info("replaying idempotent response", "idempotency_key", key, "status", existing.Status)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(existing.Status)
+		_, _ = w.Write(existing.Body)
+	}
+}
+
+// StorageKey is the key a record is stored under: the caller's key within the caller's
+// scope. The user is escaped, so that the first slash always ends it; requests without a
+// user, such as the services' calls to each other, share the empty scope.
+func StorageKey(user, key string) string {
+	return url.PathEscape(user) + "/" + key
+}
+
+// Fingerprint identifies a request by its caller, method, path and body
+func Fingerprint(r *http.Request, user string, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %s %s\n", user, r.Method, r.URL.Path)
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
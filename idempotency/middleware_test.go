@@ -0,0 +1,146 @@
+package idempotency
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// counter answers every request it lets through with the number of requests so far
+func counter() (http.Handler, *int) {
+	n := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strconv.Itoa(n)))
+	})
+
+	return h, &n
+}
+
+func newHandler(next http.Handler) http.Handler {
+	m := &Middleware{
+		Store: NewMemoryStore(),
+		TTL:   time.Hour,
+		Error: func(w http.ResponseWriter, r *http.Request, err error, status int) {
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			http.Error(w, err.Error(), status)
+		},
+		Logger: func(r *http.Request) *slog.Logger { return slog.Default() },
+	}
+
+	return m.Handler(next)
+}
+
+type call struct {
+	user, key, body string
+	// status and body of the answer; a replayed answer repeats an earlier body
+	status   int
+	answer   string
+	replayed bool
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{"a repeated key replays", []call{
+			{"7", "k", "{}", http.StatusCreated, "1", false},
+			{"7", "k", "{}", http.StatusCreated, "1", true},
+		}},
+		{"requests without a key always run", []call{
+			{"7", "", "{}", http.StatusCreated, "1", false},
+			{"7", "", "{}", http.StatusCreated, "2", false},
+		}},
+		{"users have keys of their own", []call{
+			{"7", "k", "{}", http.StatusCreated, "1", false},
+			{"8", "k", "{}", http.StatusCreated, "2", false},
+			{"", "k", "{}", http.StatusCreated, "3", false},
+			{"8", "k", "{}", http.StatusCreated, "2", true},
+		}},
+		{"a user can't reach into another's scope", []call{
+			{"7", "k/k", "{}", http.StatusCreated, "1", false},
+			{"", "7/k/k", "{}", http.StatusCreated, "2", false},
+			{"7/k", "k", "{}", http.StatusCreated, "3", false},
+		}},
+		{"a key reused for another request is refused", []call{
+			{"7", "k", `{"a":1}`, http.StatusCreated, "1", false},
+			{"7", "k", `{"a":2}`, http.StatusUnprocessableEntity, "", false},
+		}},
+		{"a key that is too long is refused", []call{
+			{"7", strings.Repeat("k", MaxKeyLength+1), "{}", http.StatusBadRequest, "", false},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, _ := counter()
+			h := newHandler(next)
+
+			for i, c := range tt.calls {
+				r := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(c.body))
+				if c.key != "" {
+					r.Header.Set(KeyHeader, c.key)
+				}
+				if c.user != "" {
+					r.Header.Set(UserHeader, c.user)
+				}
+				w := httptest.NewRecorder()
+
+				h.ServeHTTP(w, r)
+
+				if w.Code != c.status {
+					t.Fatalf("call %d: status %d, want %d", i, w.Code, c.status)
+				}
+				if c.answer != "" && w.Body.String() != c.answer {
+					t.Errorf("call %d: answer %q, want %q", i, w.Body.String(), c.answer)
+				}
+				if replayed := w.Header().Get(ReplayedHeader) == "true"; replayed != c.replayed {
+					t.Errorf("call %d: replayed %v, want %v", i, replayed, c.replayed)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareForgetsFailures(t *testing.T) {
+	failures := 1
+	h := newHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	for _, want := range []int{http.StatusBadGateway, http.StatusCreated, http.StatusCreated} {
+		r := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader("{}"))
+		r.Header.Set(KeyHeader, "k")
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, r)
+
+		if w.Code != want {
+			t.Errorf("status %d, want %d", w.Code, want)
+		}
+	}
+}
+
+func TestStorageKey(t *testing.T) {
+	seen := make(map[string]string)
+	for _, scope := range [][2]string{{"", "7/k/k"}, {"7", "k/k"}, {"7/k", "k"}, {"7%2Fk", "k"}, {"", "%2F"}} {
+		key := StorageKey(scope[0], scope[1])
+		if other, ok := seen[key]; ok {
+			t.Errorf("%q and %q are both stored as %q", other, scope, key)
+		}
+		seen[key] = scope[0] + " " + scope[1]
+	}
+}
@@ -0,0 +1,206 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrKeyInUse is returned when an idempotency key has already been used
+var ErrKeyInUse = errors.New("idempotency key already used")
+
+// Record remembers the response to a request sent with an Idempotency-Key, so that a
+// retry of the same request gets the same response instead of a second write. Status is
+// zero while the first request is still running.
+type Record struct {
+	Key         string    `bson:"_id"`
+	Fingerprint string    `bson:"fingerprint"`
+	Status      int       `bson:"status"`
+	Body        []byte    `bson:"body,omitempty"`
+	CreatedAt   time.Time `bson:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// Done reports whether the request the record belongs to has finished
+func (r *Record) Done() bool {
+	return r.Status != 0
+}
+
+// Store keeps records until they expire
+type Store interface {
+	// Reserve claims rec.Key for a new request. When the key is already taken by a record
+	// that hasn't expired it returns that record and ErrKeyInUse.
+	Reserve(ctx context.Context, rec Record) (*Record, error)
+	// Complete stores the response of the request that reserved key
+	Complete(ctx context.Context, key string, status int, body []byte) error
+	// Release forgets key, so that the request can be tried again
+	Release(ctx context.Context, key string) error
+}
+
+// Hooks let a service treat the calls of a MongoStore like its own database calls
+type Hooks struct {
+	// Observe is called after every database call, for metrics
+	Observe func(collection, operation string, start time.Time, err error)
+	// Wrap turns driver errors into the service's own
+	Wrap func(err error) error
+}
+
+func (h Hooks) observe(collection, operation string, start time.Time, err error) {
+	if h.Observe != nil {
+		h.Observe(collection, operation, start, err)
+	}
+}
+
+func (h Hooks) wrap(err error) error {
+	if h.Wrap == nil || err == nil {
+		return err
+	}
+
+	return h.Wrap(err)
+}
+
+// MongoStore keeps records in a collection, which a TTL index on expires_at keeps clean
+type MongoStore struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+	hooks      Hooks
+}
+
+// NewMongoStore returns a store on collection whose calls each take at most timeout
+func NewMongoStore(collection *mongo.Collection, timeout time.Duration, hooks Hooks) *MongoStore {
+	return &MongoStore{collection: collection, timeout: timeout, hooks: hooks}
+}
+
+func (m *MongoStore) Reserve(ctx context.Context, rec Record) (*Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	name := m.collection.Name()
+
+	// mongo only sweeps expired documents once a minute, so an expired record may still
+	// be in the way; it is dropped and the insert tried once more
+	for attempt := 0; attempt < 2; attempt++ {
+		start := time.Now()
+		_, err := m.collection.InsertOne(ctx, rec)
+		m.hooks.observe(name, "reserve", start, err)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, m.hooks.wrap(err)
+		}
+
+		var existing Record
+		start = time.Now()
+		err = m.collection.FindOne(ctx, bson.M{"_id": rec.Key}).Decode(&existing)
+		m.hooks.observe(name, "find_one", start, err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, m.hooks.wrap(err)
+		}
+
+		if existing.ExpiresAt.After(time.Now()) {
+			return &existing, ErrKeyInUse
+		}
+
+		start = time.Now()
+		_, err = m.collection.DeleteOne(ctx, bson.M{"_id": rec.Key, "expires_at": existing.ExpiresAt})
+		m.hooks.observe(name, "delete", start, err)
+		if err != nil {
+			return nil, m.hooks.wrap(err)
+		}
+	}
+
+	return nil, ErrKeyInUse
+}
+
+func (m *MongoStore) Complete(ctx context.Context, key string, status int, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": key}, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "status", Value: status}, {Key: "body", Value: body}}},
+	})
+	m.hooks.observe(m.collection.Name(), "complete", start, err)
+
+	return m.hooks.wrap(err)
+}
+
+func (m *MongoStore) Release(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": key})
+	m.hooks.observe(m.collection.Name(), "delete", start, err)
+
+	return m.hooks.wrap(err)
+}
+
+// MemoryStore keeps records in a map, dropping expired ones as it comes across them
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+func (m *MemoryStore) Reserve(ctx context.Context, rec Record) (*Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.records[rec.Key]; ok && existing.ExpiresAt.After(time.Now()) {
+		return &existing, ErrKeyInUse
+	}
+
+	m.records[rec.Key] = rec
+
+	return nil, nil
+}
+
+func (m *MemoryStore) Complete(ctx context.Context, key string, status int, body []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// like the mongo update, completing a key that has expired meanwhile is a no-op
+	rec, ok := m.records[key]
+	if !ok {
+		return nil
+	}
+
+	rec.Status = status
+	rec.Body = append([]byte(nil), body...)
+	m.records[key] = rec
+
+	return nil
+}
+
+func (m *MemoryStore) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"inventory-service/data"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// bootstrapTimeout bounds building indexes, which can take a while on a big collection
+const bootstrapTimeout = 2 * time.Minute
+
+// bootstrapMongo applies the declared validators and indexes, or with apply unset only
+// compares the indexes with their declaration, and logs any drift. It reports whether
+// drift remains.
+func bootstrapMongo(db *mongo.Database, apply bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bootstrapTimeout)
+	defer cancel()
+
+	check := data.CheckIndexes
+	if apply {
+		check = data.Bootstrap
+	}
+
+	drifts, err := check(ctx, db)
+	if err != nil {
+		return false, err
+	}
+
+	drifted := false
+	for _, drift := range drifts {
+		if drift.None() {
+			slog.Info("indexes match their declaration", "collection", drift.Collection)
+			continue
+		}
+
+		drifted = true
+		slog.Warn("indexes differ from their declaration",
+			"collection", drift.Collection,
+			"missing", drift.Missing,
+			"changed", drift.Changed,
+			"unexpected", drift.Unexpected,
+		)
+	}
+
+	return drifted, nil
+}
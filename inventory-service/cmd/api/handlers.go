@@ -1,8 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"inventory-service/data"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 type JSONPayload struct {
@@ -11,12 +16,18 @@ type JSONPayload struct {
 	Price       float32 `json:"price"`
 	Stock       int     `json:"stock"`
 	Category    string  `json:"category"`
+	SKU         string  `json:"sku,omitempty"`
+	Location    string  `json:"location,omitempty"`
 }
 
 func (app *Config) WriteProduct(w http.ResponseWriter, r *http.Request) {
 	// read json into var
 	var requestPayload JSONPayload
-	_ = app.readJSON(w, r, &requestPayload)
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
 
 	// insert data
 	event := data.InventoryItemEntry{
@@ -25,18 +36,82 @@ func (app *Config) WriteProduct(w http.ResponseWriter, r *http.Request) {
 		Price:       requestPayload.Price,
 		Stock:       requestPayload.Stock,
 		Category:    requestPayload.Category,
+		SKU:         requestPayload.SKU,
+		Location:    requestPayload.Location,
+		RequestID:   middleware.GetReqID(r.Context()),
 	}
 
-	err := app.Models.InventoryItemEntry.Insert(event)
+	id, err := app.Models.Inventory.Insert(r.Context(), event)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorJSON(w, r, err, dataErrorStatus(err))
 		return
 	}
 
 	resp := jsonResponse{
 		Error:   false,
 		Message: "item added",
+		Data:    map[string]string{"id": id},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, resp)
+}
+
+// WriteProducts stores a batch of products; either all of them are added or none are
+func (app *Config) WriteProducts(w http.ResponseWriter, r *http.Request) {
+	var requestPayload []JSONPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if len(requestPayload) == 0 {
+		app.errorJSON(w, r, errors.New("no items to add"))
+		return
+	}
+
+	entries := make([]data.InventoryItemEntry, len(requestPayload))
+	for i, p := range requestPayload {
+		entries[i] = data.InventoryItemEntry{
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Stock:       p.Stock,
+			Category:    p.Category,
+			SKU:         p.SKU,
+			Location:    p.Location,
+			RequestID:   middleware.GetReqID(r.Context()),
+		}
+	}
+
+	ids, err := app.Models.Inventory.InsertMany(r.Context(), entries)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d items added", len(ids)),
+		Data:    ids,
 	}
 
 	app.writeJSON(w, http.StatusAccepted, resp)
 }
+
+// GetProduct returns the item with the id in the path, with its catalog price
+func (app *Config) GetProduct(w http.ResponseWriter, r *http.Request) {
+	entry, err := app.Models.Inventory.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "item found",
+		Data:    entry,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
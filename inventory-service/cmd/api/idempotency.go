@@ -0,0 +1,25 @@
+package main
+
+import (
+	"idempotency"
+	"net/http"
+	"time"
+)
+
+// idempotent stores the response to every request sent with an Idempotency-Key and replays
+// it for later requests of the same user with the same key; see package idempotency
+func (app *Config) idempotent(next http.Handler) http.Handler {
+	m := &idempotency.Middleware{
+		Store: app.Models.Idempotency,
+		TTL:   time.Duration(app.Settings.IdempotencyTTL),
+		Error: func(w http.ResponseWriter, r *http.Request, err error, status int) {
+			if status == 0 {
+				status = dataErrorStatus(err)
+			}
+			app.errorJSON(w, r, err, status)
+		},
+		Logger: requestLogger,
+	}
+
+	return m.Handler(next)
+}
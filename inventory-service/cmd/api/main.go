@@ -2,84 +2,175 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"inventory-service/config"
 	"inventory-service/data"
 	"net/http"
+	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
-	webPort  = "80"
 	rpcPort  = "5001"
-	mongoURL = "mongodb://mongo:27017"
 	gRpcPort = "50001"
 )
 
-var client *mongo.Client
-
 type Config struct {
-	Models data.Models
+	// Settings is the configuration the service was started with
+	Settings *config.Config
+	// Mongo is nil when data is kept in memory
+	Mongo    *mongo.Client
+	Models   data.Models
+
+	// draining is set once shutdown has started, so that readiness checks fail
+	draining atomic.Bool
 }
 
 func main() {
-	// connect to mongo
-	mongoClient, err := connectToMongo()
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	bootstrap := flag.Bool("bootstrap", false, "create the declared mongo validators and indexes, report drift and exit")
+	checkIndexes := flag.Bool("check-indexes", false, "report drift between the declared and actual mongo indexes and exit, failing on drift")
+	flag.Parse()
+
+	cfg, err := config.Load()
 	if err != nil {
-		log.Panic(err)
+		newLogger("inventory-service", "info").Error("loading configuration", "error", err)
+		os.Exit(1)
 	}
-	client = mongoClient
 
-	// create a context in order to disconnect
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+	if *printConfig {
+		fmt.Println(cfg.Redacted())
+		return
+	}
+
+	newLogger("inventory-service", cfg.LogLevel)
+	slog.Info("configuration loaded", "config", json.RawMessage(cfg.Redacted()))
+
+	if *bootstrap || *checkIndexes {
+		os.Exit(runBootstrapCommand(cfg, *bootstrap))
+	}
+
+	shutdownTracing, err := setupTracing(context.Background(), "inventory-service")
+	if err != nil {
+		slog.Error("setting up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	app := &Config{
+		Settings: cfg,
+	}
 
-	// close connection
-	defer func() {
-		if err = client.Disconnect(ctx); err != nil {
-			panic(err)
+	if cfg.Storage == "memory" {
+		slog.Warn("keeping data in memory, it is lost when the service stops")
+		app.Models = data.NewMemory()
+	} else {
+		// connect to mongo
+		client, err := connectToMongo(cfg)
+		if err != nil {
+			os.Exit(1)
 		}
-	}()
 
-	app := Config{
-		Models: data.New(client),
+		app.Mongo = client
+		app.Models = data.New(client, cfg.MongoDatabase)
+
+		// a failed bootstrap isn't fatal: the service works without indexes, only slower
+		if cfg.MongoBootstrap {
+			if _, err := bootstrapMongo(client.Database(cfg.MongoDatabase), true); err != nil {
+				slog.Error("bootstrapping mongo", "error", err)
+			}
+		}
 	}
 
+	prometheus.MustRegister(newStockCollector(app.Models))
+
 	// start web server
-	// go app.serve()
-	log.Println("Starting service on port", webPort)
+	slog.Info("starting inventory service", "port", cfg.WebPort)
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%s", webPort),
+		Addr:    fmt.Sprintf(":%d", cfg.WebPort),
 		Handler: app.routes(),
 	}
 
-	err = srv.ListenAndServe()
-	if err != nil {
-		log.Panic()
+	serveErr := app.serve(srv)
+	if serveErr != nil {
+		slog.Error("inventory service stopped", "error", serveErr)
 	}
 
+	// no requests are running any more: flush spans and close the connection pool
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("flushing traces", "error", err)
+	}
+
+	if app.Mongo != nil {
+		if err := app.Mongo.Disconnect(ctx); err != nil {
+			slog.Error("disconnecting from mongo", "error", err)
+		}
+	}
+
+	slog.Info("inventory service stopped")
+
+	if serveErr != nil {
+		os.Exit(1)
+	}
 }
 
+// runBootstrapCommand runs -bootstrap or -check-indexes and returns the exit code
+func runBootstrapCommand(cfg *config.Config, apply bool) int {
+	if cfg.Storage != "mongo" {
+		slog.Error("bootstrapping needs mongo storage", "storage", cfg.Storage)
+		return 1
+	}
 
-func connectToMongo() (*mongo.Client, error) {
+	c, err := connectToMongo(cfg)
+	if err != nil {
+		return 1
+	}
+	defer c.Disconnect(context.Background())
+
+	drifted, err := bootstrapMongo(c.Database(cfg.MongoDatabase), apply)
+	if err != nil {
+		slog.Error("bootstrapping mongo", "error", err)
+		return 1
+	}
+
+	// only a check fails on drift; after a bootstrap the remaining drift needs a human
+	if drifted && !apply {
+		return 1
+	}
+
+	return 0
+}
+
+func connectToMongo(cfg *config.Config) (*mongo.Client, error) {
 	// create connection options
-	clientOptions := options.Client().ApplyURI(mongoURL)
-	clientOptions.SetAuth(options.Credential{
-		Username: "root",
-		Password: "password",
-	})
+	clientOptions := options.Client().ApplyURI(cfg.MongoURL)
+	clientOptions.SetMonitor(otelmongo.NewMonitor())
+	if cfg.MongoUsername != "" {
+		clientOptions.SetAuth(options.Credential{
+			Username: cfg.MongoUsername,
+			Password: cfg.MongoPassword,
+		})
+	}
 
 	// connect
 	c, err := mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
-		log.Println("Error connecting:", err)
+		slog.Error("connecting to mongo", "error", err)
 		return nil, err
 	}
 
-	log.Println("Connected to mongo!")
+	slog.Info("connected to mongo")
 
 	return c, nil
 }
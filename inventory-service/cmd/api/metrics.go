@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"inventory-service/data"
+)
+
+// scrapeTimeout bounds the database query a scrape triggers
+const scrapeTimeout = 5 * time.Second
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+// instrument records the count and latency of every request under its chi route pattern,
+// so that /orders/{id} is one series rather than one per order
+func instrument(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		labels := prometheus.Labels{"route": route, "method": r.Method, "status": strconv.Itoa(status)}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// stockCollector reports the size of the inventory, read from mongo at scrape time
+type stockCollector struct {
+	models data.Models
+	items  *prometheus.Desc
+	units  *prometheus.Desc
+}
+
+func newStockCollector(models data.Models) *stockCollector {
+	return &stockCollector{
+		models: models,
+		items:  prometheus.NewDesc("inventory_items", "Distinct items in the inventory.", nil, nil),
+		units:  prometheus.NewDesc("inventory_stock_units", "Units in stock across all items.", nil, nil),
+	}
+}
+
+func (c *stockCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.items
+	ch <- c.units
+}
+
+func (c *stockCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	totals, err := c.models.Inventory.Totals(ctx)
+	if err != nil {
+		slog.Error("collecting stock metrics", "error", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.items, prometheus.GaugeValue, float64(totals.Items))
+	ch <- prometheus.MustNewConstMetric(c.units, prometheus.GaugeValue, float64(totals.Units))
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func (app *Config) routes() http.Handler {
@@ -15,15 +16,49 @@ func (app *Config) routes() http.Handler {
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"https://*", "http://*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders: []string{"Link"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key", "X-Request-ID", "X-Request-Timeout", "X-User-ID"},
+		ExposedHeaders: []string{"Link", "Idempotent-Replayed", "X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge: 300,
 	}))
 
 	mux.Use(middleware.Heartbeat("/ping"))
 
-	mux.Post("/inventory", app.WriteProduct)
+	// continue the caller's trace, or start a new one
+	mux.Use(traceRequests("inventory-service"))
+	mux.Use(nameSpan)
+
+	// accept the caller's X-Request-ID or assign one, and log every request with it
+	mux.Use(middleware.RequestID)
+	mux.Use(echoRequestID)
+	mux.Use(accessLog)
+	mux.Use(instrument)
+
+	// stop working on requests the broker has already given up on
+	mux.Use(honourDeadline)
+
+	mux.Handle("/metrics", promhttp.Handler())
+
+	mux.Get("/health/live", app.Live)
+
+	mux.Get("/health/ready", app.Ready)
+
+	// writes sent with an Idempotency-Key are applied once, retries get the first response
+	mux.With(app.idempotent).Post("/inventory", app.WriteProduct)
+
+	mux.With(app.idempotent).Post("/inventory/batch", app.WriteProducts)
+
+	mux.With(app.idempotent).Post("/inventory/release", app.ReleaseStock)
+
+	mux.With(app.idempotent).Post("/inventory/allocate", app.AllocateStock)
+
+	mux.With(app.idempotent).Post("/inventory/pick", app.PickStock)
+
+	mux.With(app.idempotent).Post("/inventory/{id}/receive", app.ReceiveStock)
+
+	mux.Get("/inventory/{id}", app.GetProduct)
+
+	mux.Get("/inventory/{id}/ledger", app.ItemLedger)
 
 	return mux
 }
\ No newline at end of file
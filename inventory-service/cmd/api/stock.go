@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"inventory-service/data"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// defaultLedgerLimit and maxLedgerLimit bound the entries returned for an item's ledger
+const (
+	defaultLedgerLimit = 50
+	maxLedgerLimit     = 500
+)
+
+// ReleasePayload is sent by the order service when an order no longer needs stock it held
+type ReleasePayload struct {
+	OrderID string              `json:"order_id"`
+	Lines   []data.StockRelease `json:"lines"`
+}
+
+// ReleaseStock puts picked units back on the shelf and drops reservations. Items it
+// doesn't know are reported back rather than failing the release, since the order may
+// reference products that were never in the inventory.
+func (app *Config) ReleaseStock(w http.ResponseWriter, r *http.Request) {
+	var requestPayload ReleasePayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if len(requestPayload.Lines) == 0 {
+		app.errorJSON(w, r, errors.New("no lines to release"))
+		return
+	}
+
+	for i, line := range requestPayload.Lines {
+		if line.ItemID == "" || line.Quantity < 1 {
+			app.errorJSON(w, r, fmt.Errorf("line %d needs an item_id and a positive quantity", i), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	unknown, err := app.Models.Inventory.Release(r.Context(), requestPayload.Lines)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	if len(unknown) > 0 {
+		requestLogger(r).Warn("released stock of unknown items", "order_id", requestPayload.OrderID, "items", unknown)
+	}
+
+	var entries []data.LedgerEntry
+	for _, line := range requestPayload.Lines {
+		kind := data.LedgerUnreserve
+		if line.Restock {
+			kind = data.LedgerRestock
+		}
+		entries = append(entries, ledgerEntry(r, line.ItemID, kind, line.Quantity, "order/"+requestPayload.OrderID))
+	}
+	app.recordLedger(r, entries, unknown)
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "stock released",
+		Data:    map[string]any{"released": len(requestPayload.Lines) - len(unknown), "unknown": unknown},
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// AllocatePayload is sent by the order service to reserve the stock of an order. Partial
+// takes what stock there is for each line instead of refusing the order.
+type AllocatePayload struct {
+	OrderID string           `json:"order_id"`
+	Lines   []data.StockLine `json:"lines"`
+	Partial bool             `json:"partial,omitempty"`
+}
+
+// ReceivePayload puts new units of an item on the shelf. Reference names where they came
+// from, such as a purchase order or delivery note.
+type ReceivePayload struct {
+	Quantity  int    `json:"quantity"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// PickPayload is sent by the order service once the units of an order were picked.
+// PickListID is the pick list they were picked for.
+type PickPayload struct {
+	OrderID    string           `json:"order_id"`
+	PickListID string           `json:"pick_list_id"`
+	Lines      []data.StockPick `json:"lines"`
+}
+
+// AllocateStock reserves the stock of every line of an order and says where to pick each
+// line from. Either every line is reserved or none is, unless the order asked for a
+// partial allocation.
+func (app *Config) AllocateStock(w http.ResponseWriter, r *http.Request) {
+	var requestPayload AllocatePayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if len(requestPayload.Lines) == 0 {
+		app.errorJSON(w, r, errors.New("no lines to allocate"))
+		return
+	}
+
+	for i, line := range requestPayload.Lines {
+		if line.ItemID == "" || line.Quantity < 1 {
+			app.errorJSON(w, r, fmt.Errorf("line %d needs an item_id and a positive quantity", i), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	allocate := app.Models.Inventory.Allocate
+	if requestPayload.Partial {
+		allocate = app.Models.Inventory.AllocateAvailable
+	}
+
+	allocations, err := allocate(r.Context(), requestPayload.Lines)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	var entries []data.LedgerEntry
+	for _, allocation := range allocations {
+		if allocation.Quantity > 0 {
+			entries = append(entries, ledgerEntry(r, allocation.ItemID, data.LedgerReserve, allocation.Quantity, "order/"+requestPayload.OrderID))
+		}
+	}
+	app.recordLedger(r, entries, nil)
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "stock allocated",
+		Data:    map[string]any{"allocations": allocations},
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// PickStock takes picked units off the shelf and drops the reservations they were picked
+// against, including the reservation of units the picker didn't find
+func (app *Config) PickStock(w http.ResponseWriter, r *http.Request) {
+	var requestPayload PickPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if len(requestPayload.Lines) == 0 {
+		app.errorJSON(w, r, errors.New("no lines to pick"))
+		return
+	}
+
+	for i, line := range requestPayload.Lines {
+		if line.ItemID == "" || line.Reserved < 1 || line.Picked < 0 || line.Picked > line.Reserved {
+			app.errorJSON(w, r, fmt.Errorf("line %d needs an item_id, a positive reserved quantity and at most that many picked units", i), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	unknown, err := app.Models.Inventory.Pick(r.Context(), requestPayload.Lines)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	if len(unknown) > 0 {
+		requestLogger(r).Warn("picked stock of unknown items", "order_id", requestPayload.OrderID, "items", unknown)
+	}
+
+	reference := "picklist/" + requestPayload.PickListID + "/order/" + requestPayload.OrderID
+
+	var entries []data.LedgerEntry
+	for _, line := range requestPayload.Lines {
+		if line.Picked > 0 {
+			entries = append(entries, ledgerEntry(r, line.ItemID, data.LedgerPick, line.Picked, reference))
+		}
+		if short := line.Reserved - line.Picked; short > 0 {
+			entries = append(entries, ledgerEntry(r, line.ItemID, data.LedgerShortPick, short, reference))
+		}
+	}
+	app.recordLedger(r, entries, unknown)
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "stock picked",
+		Data:    map[string]any{"picked": len(requestPayload.Lines) - len(unknown), "unknown": unknown},
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// ReceiveStock puts new units of the item with the id in the path on the shelf and
+// answers with the item as it is afterwards
+func (app *Config) ReceiveStock(w http.ResponseWriter, r *http.Request) {
+	var requestPayload ReceivePayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if requestPayload.Quantity < 1 {
+		app.errorJSON(w, r, errors.New("quantity must be positive"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	item, err := app.Models.Inventory.Receive(r.Context(), chi.URLParam(r, "id"), requestPayload.Quantity)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	reference := requestPayload.Reference
+	if reference == "" {
+		reference = "receipt"
+	}
+	app.recordLedger(r, []data.LedgerEntry{ledgerEntry(r, item.ID, data.LedgerReceive, requestPayload.Quantity, reference)}, nil)
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "stock received",
+		Data:    item,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// ItemLedger returns the latest stock movements of the item with the id in the path,
+// newest first. The limit query parameter caps how many.
+func (app *Config) ItemLedger(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLedgerLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLedgerLimit {
+			app.errorJSON(w, r, fmt.Errorf("limit must be between 1 and %d", maxLedgerLimit))
+			return
+		}
+		limit = n
+	}
+
+	entries, err := app.Models.Ledger.ByItem(r.Context(), chi.URLParam(r, "id"), limit)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "ledger found",
+		Data:    entries,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+func ledgerEntry(r *http.Request, itemID, kind string, quantity int, reference string) data.LedgerEntry {
+	return data.LedgerEntry{
+		ItemID:    itemID,
+		Kind:      kind,
+		Quantity:  quantity,
+		Reference: reference,
+		RequestID: middleware.GetReqID(r.Context()),
+		At:        time.Now(),
+	}
+}
+
+// recordLedger adds the movements of items that exist to the ledger. The stock has
+// already changed by then, so a failure is logged rather than failing the request.
+func (app *Config) recordLedger(r *http.Request, entries []data.LedgerEntry, unknown []string) {
+	entries = slices.DeleteFunc(entries, func(e data.LedgerEntry) bool {
+		return slices.Contains(unknown, e.ItemID)
+	})
+
+	if err := app.Models.Ledger.Record(r.Context(), entries); err != nil {
+		requestLogger(r).Error("recording stock movements", "error", err)
+	}
+}
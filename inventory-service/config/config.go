@@ -0,0 +1,81 @@
+// Package config holds the settings of the inventory service
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	WebPort         int      `json:"web_port" env:"WEB_PORT"`
+	LogLevel        string   `json:"log_level" env:"LOG_LEVEL"`
+	Storage         string   `json:"storage" env:"STORAGE"`
+	MongoURL        string   `json:"mongo_url" env:"MONGO_URL" secret:"true"`
+	MongoUsername   string   `json:"mongo_username" env:"MONGO_USERNAME"`
+	MongoPassword   string   `json:"mongo_password" env:"MONGO_PASSWORD" secret:"true"`
+	MongoDatabase   string   `json:"mongo_database" env:"MONGO_DATABASE"`
+	MongoBootstrap  bool     `json:"mongo_bootstrap" env:"MONGO_BOOTSTRAP"`
+	IdempotencyTTL  Duration `json:"idempotency_ttl" env:"IDEMPOTENCY_TTL"`
+	ShutdownTimeout Duration `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// DrainDelay is how long a stopping service keeps serving after its readiness check
+	// starts failing, so that load balancers stop sending it requests first
+	DrainDelay Duration `json:"drain_delay" env:"DRAIN_DELAY"`
+}
+
+func defaults() *Config {
+	return &Config{
+		WebPort:         80,
+		LogLevel:        "info",
+		Storage:         "mongo",
+		MongoURL:        "mongodb://mongo:27017",
+		MongoDatabase:   "warehouse",
+		MongoBootstrap:  true,
+		IdempotencyTTL:  Duration(24 * time.Hour),
+		ShutdownTimeout: Duration(20 * time.Second),
+		DrainDelay:      Duration(5 * time.Second),
+	}
+}
+
+// Validate reports every setting that is out of range, not just the first
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.WebPort < 1 || c.WebPort > 65535 {
+		errs = append(errs, fmt.Errorf("web_port %d is not a valid port", c.WebPort))
+	}
+
+	switch c.Storage {
+	case "memory":
+		// nothing else to check, mongo isn't used
+	case "mongo":
+		if !strings.HasPrefix(c.MongoURL, "mongodb://") && !strings.HasPrefix(c.MongoURL, "mongodb+srv://") {
+			errs = append(errs, errors.New("mongo_url must be a mongodb:// or mongodb+srv:// url"))
+		}
+
+		if c.MongoUsername != "" && c.MongoPassword == "" {
+			errs = append(errs, errors.New("mongo_password is required when mongo_username is set"))
+		}
+
+		if c.MongoDatabase == "" {
+			errs = append(errs, errors.New("mongo_database is required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage %q must be mongo or memory", c.Storage))
+	}
+
+	if c.IdempotencyTTL <= 0 {
+		errs = append(errs, errors.New("idempotency_ttl must be positive"))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+
+	if c.DrainDelay < 0 {
+		errs = append(errs, errors.New("drain_delay must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
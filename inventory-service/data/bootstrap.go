@@ -0,0 +1,270 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares an index a collection must have
+type IndexSpec struct {
+	Name   string
+	Keys   bson.D
+	Unique bool
+	// Partial limits the index to the documents matching the filter
+	Partial bson.D
+	// TTL has mongo delete documents once the date in the indexed field has passed
+	TTL bool
+}
+
+// CollectionSpec declares a collection with the validator and indexes it must have
+type CollectionSpec struct {
+	Name      string
+	Validator bson.M
+	Indexes   []IndexSpec
+}
+
+// Collections is everything the inventory service needs in mongo
+var Collections = []CollectionSpec{
+	{
+		Name: "inventory",
+		Validator: bson.M{"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"required": bson.A{"name", "price", "stock", "created_at"},
+			"properties": bson.M{
+				"name":        bson.M{"bsonType": "string", "minLength": 1},
+				"description": bson.M{"bsonType": "string"},
+				"price":       bson.M{"bsonType": bson.A{"double", "int", "long", "decimal"}, "minimum": 0},
+				"stock":       bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+				"reserved":    bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+				"category":    bson.M{"bsonType": "string"},
+				"sku":         bson.M{"bsonType": "string", "minLength": 1},
+				"location":    bson.M{"bsonType": "string"},
+				"request_id":  bson.M{"bsonType": "string"},
+				"created_at":  bson.M{"bsonType": "date"},
+				"updated_at":  bson.M{"bsonType": "date"},
+			},
+		}},
+		Indexes: []IndexSpec{
+			{
+				Name:    "sku_unique",
+				Keys:    bson.D{{Key: "sku", Value: 1}},
+				Unique:  true,
+				Partial: bson.D{{Key: "sku", Value: bson.D{{Key: "$type", Value: "string"}}}},
+			},
+			{Name: "category", Keys: bson.D{{Key: "category", Value: 1}}},
+			{Name: "created_at", Keys: bson.D{{Key: "created_at", Value: -1}}},
+		},
+	},
+	{
+		Name: "stock_ledger",
+		Validator: bson.M{"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"required": bson.A{"item_id", "kind", "quantity", "at"},
+			"properties": bson.M{
+				"item_id":    bson.M{"bsonType": "string", "minLength": 1},
+				"kind":       bson.M{"enum": bson.A{"reserve", "unreserve", "pick", "short_pick", "restock"}},
+				"quantity":   bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+				"reference":  bson.M{"bsonType": "string"},
+				"request_id": bson.M{"bsonType": "string"},
+				"at":         bson.M{"bsonType": "date"},
+			},
+		}},
+		Indexes: []IndexSpec{
+			{Name: "item_at", Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "at", Value: -1}}},
+		},
+	},
+	idempotencyCollection,
+}
+
+// idempotencyCollection holds the responses replayed for retried writes until they expire
+var idempotencyCollection = CollectionSpec{
+	Name: "idempotency_keys",
+	Validator: bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"fingerprint", "status", "created_at", "expires_at"},
+		"properties": bson.M{
+			"fingerprint": bson.M{"bsonType": "string"},
+			"status":      bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+			"body":        bson.M{"bsonType": "binData"},
+			"created_at":  bson.M{"bsonType": "date"},
+			"expires_at":  bson.M{"bsonType": "date"},
+		},
+	}},
+	Indexes: []IndexSpec{
+		{Name: "expires_at_ttl", Keys: bson.D{{Key: "expires_at", Value: 1}}, TTL: true},
+	},
+}
+
+// IndexDrift lists how a collection's indexes differ from the declared ones
+type IndexDrift struct {
+	Collection string   `json:"collection"`
+	Missing    []string `json:"missing,omitempty"`
+	Changed    []string `json:"changed,omitempty"`
+	Unexpected []string `json:"unexpected,omitempty"`
+}
+
+// None reports whether the collection matches its declaration
+func (d IndexDrift) None() bool {
+	return len(d.Missing) == 0 && len(d.Changed) == 0 && len(d.Unexpected) == 0
+}
+
+// Bootstrap makes sure every declared collection exists with its validator and creates
+// the declared indexes that are missing. Indexes that exist with a different definition
+// or that aren't declared are never dropped; they are returned as drift for a human to
+// look at.
+func Bootstrap(ctx context.Context, db *mongo.Database) ([]IndexDrift, error) {
+	for _, spec := range Collections {
+		if err := applyValidator(ctx, db, spec); err != nil {
+			return nil, err
+		}
+
+		drift, err := checkCollection(ctx, db.Collection(spec.Name), spec)
+		if err != nil {
+			return nil, err
+		}
+
+		var models []mongo.IndexModel
+		for _, index := range spec.Indexes {
+			for _, missing := range drift.Missing {
+				if index.Name == missing {
+					models = append(models, indexModel(index))
+				}
+			}
+		}
+
+		if len(models) > 0 {
+			if _, err := db.Collection(spec.Name).Indexes().CreateMany(ctx, models); err != nil {
+				return nil, fmt.Errorf("creating indexes on %s: %w", spec.Name, wrapErr(err))
+			}
+		}
+	}
+
+	return CheckIndexes(ctx, db)
+}
+
+// CheckIndexes compares the indexes of every declared collection with its declaration
+// without changing anything
+func CheckIndexes(ctx context.Context, db *mongo.Database) ([]IndexDrift, error) {
+	drifts := make([]IndexDrift, 0, len(Collections))
+
+	for _, spec := range Collections {
+		drift, err := checkCollection(ctx, db.Collection(spec.Name), spec)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, drift)
+	}
+
+	return drifts, nil
+}
+
+// applyValidator sets the collection's schema validator, creating the collection if it
+// doesn't exist yet. Validation is moderate, so documents written before the validator
+// existed can still be updated.
+func applyValidator(ctx context.Context, db *mongo.Database, spec CollectionSpec) error {
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: spec.Name},
+		{Key: "validator", Value: spec.Validator},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: "error"},
+	}).Err()
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceNotFound" {
+		opts := options.CreateCollection().
+			SetValidator(spec.Validator).
+			SetValidationLevel("moderate").
+			SetValidationAction("error")
+		err = db.CreateCollection(ctx, spec.Name, opts)
+	}
+
+	if err != nil {
+		return fmt.Errorf("applying validator to %s: %w", spec.Name, wrapErr(err))
+	}
+
+	return nil
+}
+
+// existingIndex is an index as listed by mongo
+type existingIndex struct {
+	Name    string `bson:"name"`
+	Key     bson.D `bson:"key"`
+	Unique  bool   `bson:"unique"`
+	Partial bson.D `bson:"partialFilterExpression"`
+	// ExpireAfter is nil unless the index is a TTL index
+	ExpireAfter *int32 `bson:"expireAfterSeconds"`
+}
+
+func checkCollection(ctx context.Context, collection *mongo.Collection, spec CollectionSpec) (IndexDrift, error) {
+	drift := IndexDrift{Collection: spec.Name}
+
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return drift, fmt.Errorf("listing indexes of %s: %w", spec.Name, wrapErr(err))
+	}
+
+	var existing []existingIndex
+	if err := cursor.All(ctx, &existing); err != nil {
+		return drift, fmt.Errorf("listing indexes of %s: %w", spec.Name, wrapErr(err))
+	}
+
+	actual := make(map[string]existingIndex, len(existing))
+	for _, index := range existing {
+		actual[index.Name] = index
+	}
+
+	declared := make(map[string]bool, len(spec.Indexes))
+	for _, index := range spec.Indexes {
+		declared[index.Name] = true
+
+		got, ok := actual[index.Name]
+		switch {
+		case !ok:
+			drift.Missing = append(drift.Missing, index.Name)
+		case !sameDoc(got.Key, index.Keys) || got.Unique != index.Unique || !sameDoc(got.Partial, index.Partial) ||
+			index.TTL != (got.ExpireAfter != nil && *got.ExpireAfter == 0):
+			drift.Changed = append(drift.Changed, index.Name)
+		}
+	}
+
+	for _, index := range existing {
+		if index.Name != "_id_" && !declared[index.Name] {
+			drift.Unexpected = append(drift.Unexpected, index.Name)
+		}
+	}
+
+	return drift, nil
+}
+
+func indexModel(index IndexSpec) mongo.IndexModel {
+	opts := options.Index().SetName(index.Name)
+	if index.Unique {
+		opts.SetUnique(true)
+	}
+	if len(index.Partial) > 0 {
+		opts.SetPartialFilterExpression(index.Partial)
+	}
+	if index.TTL {
+		opts.SetExpireAfterSeconds(0)
+	}
+
+	return mongo.IndexModel{Keys: index.Keys, Options: opts}
+}
+
+// sameDoc compares two documents as relaxed extended JSON, so that a key declared as the
+// Go int 1 matches the int32 1 mongo lists
+func sameDoc(a, b bson.D) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+
+	ja, errA := bson.MarshalExtJSON(a, false, false)
+	jb, errB := bson.MarshalExtJSON(b, false, false)
+
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
@@ -0,0 +1,37 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrNotFound is returned when no inventory item has the requested id
+	ErrNotFound = errors.New("inventory item not found")
+	// ErrDuplicate is returned when another inventory item already has the same sku
+	ErrDuplicate = errors.New("an inventory item with this sku already exists")
+	// ErrTimeout is returned when the caller's deadline passed before mongo answered
+	ErrTimeout = errors.New("inventory storage timed out")
+	// ErrInsufficientStock is returned when an item hasn't enough unreserved stock
+	ErrInsufficientStock = errors.New("not enough stock")
+)
+
+// wrapErr turns driver errors into the package's typed errors, keeping the original
+// error's text for the logs
+func wrapErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return ErrDuplicate
+	case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ledger entry kinds. Reserve and unreserve move units in and out of an item's reserved
+// count, pick takes them off the shelf, restock puts them back and short_pick records
+// units a picker was sent for but didn't find. Receive puts new units on the shelf.
+const (
+	LedgerReserve   = "reserve"
+	LedgerUnreserve = "unreserve"
+	LedgerPick      = "pick"
+	LedgerShortPick = "short_pick"
+	LedgerRestock   = "restock"
+	LedgerReceive   = "receive"
+)
+
+// LedgerEntry is one stock movement of an item. Reference names what caused it, such as
+// the order or pick list.
+type LedgerEntry struct {
+	ItemID    string    `bson:"item_id" json:"item_id"`
+	Kind      string    `bson:"kind" json:"kind"`
+	Quantity  int       `bson:"quantity" json:"quantity"`
+	Reference string    `bson:"reference,omitempty" json:"reference,omitempty"`
+	RequestID string    `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	At        time.Time `bson:"at" json:"at"`
+}
+
+// LedgerRepository keeps the history of stock movements. Entries are only ever added.
+type LedgerRepository interface {
+	Record(ctx context.Context, entries []LedgerEntry) error
+	// ByItem returns the latest entries of an item, newest first
+	ByItem(ctx context.Context, itemID string, limit int) ([]LedgerEntry, error)
+}
+
+// MongoLedger stores stock movements in the stock_ledger collection
+type MongoLedger struct {
+	collection *mongo.Collection
+}
+
+func NewMongoLedger(db *mongo.Database) *MongoLedger {
+	return &MongoLedger{collection: db.Collection("stock_ledger")}
+}
+
+func (m *MongoLedger) Record(ctx context.Context, entries []LedgerEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docs := make([]any, len(entries))
+	for i, entry := range entries {
+		docs[i] = entry
+	}
+
+	start := time.Now()
+	_, err := m.collection.InsertMany(ctx, docs)
+	observe("stock_ledger", "insert_many", start, err)
+
+	return wrapErr(err)
+}
+
+func (m *MongoLedger) ByItem(ctx context.Context, itemID string, limit int) ([]LedgerEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(limit))
+
+	start := time.Now()
+	cursor, err := m.collection.Find(ctx, bson.M{"item_id": itemID}, opts)
+	observe("stock_ledger", "find_by_item", start, err)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	entries := []LedgerEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return entries, nil
+}
+
+// MemoryLedger keeps stock movements in a slice, in the order they were recorded
+type MemoryLedger struct {
+	mu      sync.RWMutex
+	entries []LedgerEntry
+}
+
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{}
+}
+
+func (m *MemoryLedger) Record(ctx context.Context, entries []LedgerEntry) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = append(m.entries, entries...)
+
+	return nil
+}
+
+func (m *MemoryLedger) ByItem(ctx context.Context, itemID string, limit int) ([]LedgerEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := []LedgerEntry{}
+	for i := len(m.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if m.entries[i].ItemID == itemID {
+			entries = append(entries, m.entries[i])
+		}
+	}
+
+	// entries recorded together share a time; keep them newest first regardless
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.After(entries[j].At)
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,194 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryInventory keeps inventory items in a map. It is safe for concurrent use and hands
+// out copies, so callers can't change stored items behind its back.
+type MemoryInventory struct {
+	mu    sync.RWMutex
+	items map[string]InventoryItemEntry
+}
+
+func NewMemoryInventory() *MemoryInventory {
+	return &MemoryInventory{items: make(map[string]InventoryItemEntry)}
+}
+
+func (m *MemoryInventory) Insert(ctx context.Context, entry InventoryItemEntry) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.skuTaken(entry.SKU, "") {
+		return "", ErrDuplicate
+	}
+
+	return m.insert(entry), nil
+}
+
+// InsertMany holds the lock for the whole batch, so it is all-or-nothing like the mongo version
+func (m *MemoryInventory) InsertMany(ctx context.Context, entries []InventoryItemEntry) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// check the whole batch first, so a duplicate sku leaves nothing behind
+	batch := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if entry.SKU == "" {
+			continue
+		}
+		if batch[entry.SKU] || m.skuTaken(entry.SKU, "") {
+			return nil, ErrDuplicate
+		}
+		batch[entry.SKU] = true
+	}
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = m.insert(entry)
+	}
+
+	return ids, nil
+}
+
+func (m *MemoryInventory) insert(entry InventoryItemEntry) string {
+	now := time.Now()
+
+	entry.ID = primitive.NewObjectID().Hex()
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+
+	m.items[entry.ID] = entry
+
+	return entry.ID
+}
+
+// skuTaken reports whether an item other than the one with id except already has sku
+func (m *MemoryInventory) skuTaken(sku, except string) bool {
+	if sku == "" {
+		return false
+	}
+
+	for id, item := range m.items {
+		if id != except && item.SKU == sku {
+			return true
+		}
+	}
+
+	return false
+}
+
+// All returns every item, newest first
+func (m *MemoryInventory) All(ctx context.Context) ([]*InventoryItemEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := make([]*InventoryItemEntry, 0, len(m.items))
+	for _, item := range m.items {
+		items = append(items, &item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].ID > items[j].ID
+		}
+		return items[i].CreatedAt.After(items[j].CreatedAt)
+	})
+
+	return items, nil
+}
+
+func (m *MemoryInventory) GetOne(ctx context.Context, id string) (*InventoryItemEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	item, ok := m.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &item, nil
+}
+
+func (m *MemoryInventory) Update(ctx context.Context, entry InventoryItemEntry) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[entry.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	item.Name = entry.Name
+	item.Description = entry.Description
+	item.Price = entry.Price
+	item.Stock = entry.Stock
+	item.Category = entry.Category
+	item.Location = entry.Location
+	if entry.SKU != "" {
+		if m.skuTaken(entry.SKU, entry.ID) {
+			return ErrDuplicate
+		}
+		item.SKU = entry.SKU
+	}
+	item.UpdatedAt = time.Now()
+
+	m.items[entry.ID] = item
+
+	return nil
+}
+
+func (m *MemoryInventory) Totals(ctx context.Context) (StockTotals, error) {
+	if err := ctx.Err(); err != nil {
+		return StockTotals{}, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var totals StockTotals
+	for _, item := range m.items {
+		totals.Items++
+		totals.Units += int64(item.Stock)
+	}
+
+	return totals, nil
+}
+
+func (m *MemoryInventory) DropCollection(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items = make(map[string]InventoryItemEntry)
+
+	return nil
+}
@@ -2,7 +2,8 @@ package data
 
 import (
 	"context"
-	"log"
+	"idempotency"
+	"log/slog"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -11,18 +12,52 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var client *mongo.Client
+// InventoryRepository is the storage the inventory service needs. MongoInventory keeps
+// items in mongo; MemoryInventory keeps them in memory, for tests and local demos. Every
+// method gives up once ctx is done, returning ErrTimeout when its deadline passed.
+type InventoryRepository interface {
+	// Insert stores a new item and returns its id
+	Insert(ctx context.Context, entry InventoryItemEntry) (string, error)
+	InsertMany(ctx context.Context, entries []InventoryItemEntry) ([]string, error)
+	All(ctx context.Context) ([]*InventoryItemEntry, error)
+	GetOne(ctx context.Context, id string) (*InventoryItemEntry, error)
+	Update(ctx context.Context, entry InventoryItemEntry) error
+	Totals(ctx context.Context) (StockTotals, error)
+	Release(ctx context.Context, releases []StockRelease) ([]string, error)
+	Allocate(ctx context.Context, lines []StockLine) ([]Allocation, error)
+	AllocateAvailable(ctx context.Context, lines []StockLine) ([]Allocation, error)
+	Receive(ctx context.Context, id string, quantity int) (*InventoryItemEntry, error)
+	Pick(ctx context.Context, picks []StockPick) ([]string, error)
+	DropCollection(ctx context.Context) error
+}
+
+// New returns models backed by the given mongo database
+func New(client *mongo.Client, database string) Models {
+	db := client.Database(database)
 
-func New(mongo *mongo.Client) Models {
-	client = mongo
+	return Models{
+		Inventory:   NewMongoInventory(db),
+		Idempotency: idempotency.NewMongoStore(db.Collection("idempotency_keys"), dbTimeout, idempotency.Hooks{Observe: observe, Wrap: wrapErr}),
+		Ledger:      NewMongoLedger(db),
+	}
+}
 
+// NewMemory returns models that keep everything in memory
+func NewMemory() Models {
 	return Models{
-		InventoryItemEntry: InventoryItemEntry{},
+		Inventory:   NewMemoryInventory(),
+		Idempotency: idempotency.NewMemoryStore(),
+		Ledger:      NewMemoryLedger(),
 	}
 }
 
+// dbTimeout caps every mongo operation; a shorter deadline on the caller's context wins
+const dbTimeout = 15 * time.Second
+
 type Models struct {
-	InventoryItemEntry InventoryItemEntry
+	Inventory   InventoryRepository
+	Idempotency idempotency.Store
+	Ledger      LedgerRepository
 }
 
 type InventoryItemEntry struct {
@@ -31,44 +66,122 @@ type InventoryItemEntry struct {
 	Description string    `bson:"description" json:"description"`
 	Price       float32   `bson:"price" json:"price"`
 	Stock       int       `bson:"stock" json:"stock"`
+	// Reserved counts the units of Stock held for orders that haven't been picked yet
+	Reserved    int       `bson:"reserved,omitempty" json:"reserved"`
 	Category    string    `bson:"category" json:"category"`
+	SKU         string    `bson:"sku,omitempty" json:"sku,omitempty"`
+	// Location is the bin the item is picked from
+	Location    string    `bson:"location,omitempty" json:"location,omitempty"`
+	RequestID   string    `bson:"request_id,omitempty" json:"request_id,omitempty"`
 	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
 }
 
-func (l *InventoryItemEntry) Insert(entry InventoryItemEntry) error {
-	collection := client.Database("warehouse").Collection("inventory")
+// MongoInventory stores inventory items in the inventory collection
+type MongoInventory struct {
+	collection *mongo.Collection
+}
 
-	_, err := collection.InsertOne(context.TODO(), InventoryItemEntry{
+func NewMongoInventory(db *mongo.Database) *MongoInventory {
+	return &MongoInventory{collection: db.Collection("inventory")}
+}
+
+func (m *MongoInventory) Insert(ctx context.Context, entry InventoryItemEntry) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	collection := m.collection
+
+	start := time.Now()
+	result, err := collection.InsertOne(ctx, InventoryItemEntry{
 		Name:      entry.Name,
 		Description:      entry.Description,
 		Price:     entry.Price,
 		Stock:     entry.Stock,
 		Category:  entry.Category,
+		SKU:       entry.SKU,
+		Location:  entry.Location,
+		RequestID: entry.RequestID,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	})
+	observe("inventory", "insert", start, err)
 	if err != nil {
-		log.Println("Error inserting into inventory:", err)
-		return err
+		slog.Error("inserting into inventory", "error", err)
+		return "", wrapErr(err)
 	}
 
-	return nil
+	id, _ := result.InsertedID.(primitive.ObjectID)
+
+	return id.Hex(), nil
+}
+
+// InsertMany inserts all of entries or none of them. A standalone mongo has no multi
+// document transactions, so if the insert fails part way the documents that did get
+// written are deleted again.
+func (m *MongoInventory) InsertMany(ctx context.Context, entries []InventoryItemEntry) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	collection := m.collection
+
+	docs := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		docs[i] = InventoryItemEntry{
+			Name:        entry.Name,
+			Description: entry.Description,
+			Price:       entry.Price,
+			Stock:       entry.Stock,
+			Category:    entry.Category,
+			SKU:         entry.SKU,
+			Location:    entry.Location,
+			RequestID:   entry.RequestID,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+	}
+
+	start := time.Now()
+	result, err := collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(true))
+	observe("inventory", "insert_many", start, err)
+	if err != nil {
+		slog.Error("inserting batch into inventory", "error", err, "items", len(entries))
+
+		if result != nil && len(result.InsertedIDs) > 0 {
+			_, rollbackErr := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": result.InsertedIDs}})
+			if rollbackErr != nil {
+				slog.Error("rolling back inventory batch", "error", rollbackErr)
+			}
+		}
+
+		return nil, wrapErr(err)
+	}
+
+	ids := make([]string, 0, len(result.InsertedIDs))
+	for _, id := range result.InsertedIDs {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			ids = append(ids, oid.Hex())
+		}
+	}
+
+	return ids, nil
 }
 
-func (l *InventoryItemEntry) All() ([]*InventoryItemEntry, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (m *MongoInventory) All(ctx context.Context) ([]*InventoryItemEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	collection := client.Database("warehouse").Collection("inventory")
+	collection := m.collection
 
 	opts := options.Find()
-	opts.SetSort(bson.D{{"created_at", -1}})
+	opts.SetSort(bson.D{{Key: "created_at", Value: -1}})
 
-	cursor, err := collection.Find(context.TODO(), bson.D{}, opts)
+	start := time.Now()
+	cursor, err := collection.Find(ctx, bson.D{}, opts)
+	observe("inventory", "find_all", start, err)
 	if err != nil {
-		log.Println("Finding all docs error:", err)
-		return nil, err
+		slog.Error("finding all inventory items", "error", err)
+		return nil, wrapErr(err)
 	}
 	defer cursor.Close(ctx)
 
@@ -79,78 +192,132 @@ func (l *InventoryItemEntry) All() ([]*InventoryItemEntry, error) {
 
 		err := cursor.Decode(&item)
 		if err != nil {
-			log.Print("Error decoding product into slice:", err)
-			return nil, err
+			slog.Error("decoding inventory item", "error", err)
+			return nil, wrapErr(err)
 		} else {
 			logs = append(logs, &item)
 		}
 	}
 
+	if err := cursor.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
 	return logs, nil
 }
 
-func (l *InventoryItemEntry) GetOne(id string) (*InventoryItemEntry, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (m *MongoInventory) GetOne(ctx context.Context, id string) (*InventoryItemEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	collection := client.Database("warehouse").Collection("inventory")
+	collection := m.collection
 
 	docID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return nil, ErrNotFound
 	}
 
 	var entry InventoryItemEntry
+	start := time.Now()
 	err = collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&entry)
+	observe("inventory", "find_one", start, err)
 	if err != nil {
-		return nil, err
+		return nil, wrapErr(err)
 	}
 
 	return &entry, nil
 }
 
-func (l *InventoryItemEntry) DropCollection() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+// StockTotals is the size of the whole inventory
+type StockTotals struct {
+	Items int64 `bson:"items" json:"items"`
+	Units int64 `bson:"units" json:"units"`
+}
+
+// Totals counts the items in the inventory and sums their stock
+func (m *MongoInventory) Totals(ctx context.Context) (StockTotals, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	collection := client.Database("warehouse").Collection("inventory")
+	collection := m.collection
 
-	if err := collection.Drop(ctx); err != nil {
-		return err
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "items", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "units", Value: bson.D{{Key: "$sum", Value: "$stock"}}},
+		}}},
 	}
 
-	return nil
+	var totals StockTotals
+
+	start := time.Now()
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	observe("inventory", "totals", start, err)
+	if err != nil {
+		return totals, wrapErr(err)
+	}
+	defer cursor.Close(ctx)
+
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&totals); err != nil {
+			return totals, wrapErr(err)
+		}
+	}
+
+	return totals, wrapErr(cursor.Err())
 }
 
-func (l *InventoryItemEntry) Update() (*mongo.UpdateResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (m *MongoInventory) DropCollection(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	collection := client.Database("warehouse").Collection("inventory")
+	collection := m.collection
 
-	docID, err := primitive.ObjectIDFromHex(l.ID)
+	start := time.Now()
+	err := collection.Drop(ctx)
+	observe("inventory", "drop", start, err)
 	if err != nil {
-		return nil, err
-	}
-
-	result, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": docID},
-		bson.D{
-			{"$set", bson.D{
-				{"name", l.Name},
-				{"description", l.Description},
-				{"price", l.Price},
-				{"stock", l.Stock},
-				{"category", l.Category},
-				{"updated_at", time.Now()},
-			}},
-		},
-	)
+		return wrapErr(err)
+	}
 
+	return nil
+}
+
+// Update replaces the stored fields of the item with entry.ID
+func (m *MongoInventory) Update(ctx context.Context, entry InventoryItemEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(entry.ID)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	set := bson.D{
+		{Key: "name", Value: entry.Name},
+		{Key: "description", Value: entry.Description},
+		{Key: "price", Value: entry.Price},
+		{Key: "stock", Value: entry.Stock},
+		{Key: "category", Value: entry.Category},
+		{Key: "location", Value: entry.Location},
+		{Key: "updated_at", Value: time.Now()},
+	}
+	// an item keeps its sku unless a new one is given
+	if entry.SKU != "" {
+		set = append(set, bson.E{Key: "sku", Value: entry.SKU})
+	}
+
+	start := time.Now()
+	result, err := m.collection.UpdateOne(ctx, bson.M{"_id": docID}, bson.D{{Key: "$set", Value: set}})
+	observe("inventory", "update", start, err)
 	if err != nil {
-		return nil, err
+		return wrapErr(err)
 	}
 
-	return result, nil
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
 }
@@ -0,0 +1,462 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StockRelease gives back units an order no longer needs. Units that had been picked are
+// restocked, that is put back on the shelf; units that were only reserved have their
+// reservation dropped.
+type StockRelease struct {
+	ItemID   string `json:"item_id"`
+	Quantity int    `json:"quantity"`
+	Restock  bool   `json:"restock"`
+}
+
+// Release applies every release and returns the ids of the items it doesn't know. A
+// reservation never drops below zero, so releasing more than was reserved is harmless.
+func (m *MongoInventory) Release(ctx context.Context, releases []StockRelease) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var unknown []string
+
+	for _, release := range releases {
+		docID, err := primitive.ObjectIDFromHex(release.ItemID)
+		if err != nil {
+			unknown = append(unknown, release.ItemID)
+			continue
+		}
+
+		var update any
+		if release.Restock {
+			update = bson.D{
+				{Key: "$inc", Value: bson.D{{Key: "stock", Value: release.Quantity}}},
+				{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+			}
+		} else {
+			update = unreserve(release.Quantity)
+		}
+
+		start := time.Now()
+		result, err := m.collection.UpdateOne(ctx, bson.M{"_id": docID}, update)
+		observe("inventory", "release", start, err)
+		if err != nil {
+			return unknown, wrapErr(err)
+		}
+
+		if result.MatchedCount == 0 {
+			unknown = append(unknown, release.ItemID)
+		}
+	}
+
+	return unknown, nil
+}
+
+// Release holds the lock for every release, so a concurrent reader sees all of them or none
+func (m *MemoryInventory) Release(ctx context.Context, releases []StockRelease) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var unknown []string
+
+	for _, release := range releases {
+		item, ok := m.items[release.ItemID]
+		if !ok {
+			unknown = append(unknown, release.ItemID)
+			continue
+		}
+
+		if release.Restock {
+			item.Stock += release.Quantity
+		} else {
+			item.Reserved = max(0, item.Reserved-release.Quantity)
+		}
+		item.UpdatedAt = time.Now()
+
+		m.items[release.ItemID] = item
+	}
+
+	return unknown, nil
+}
+
+// StockLine asks for a number of units of one item
+type StockLine struct {
+	ItemID   string `json:"item_id"`
+	Quantity int    `json:"quantity"`
+}
+
+// Allocation is the stock reserved for one line and where to pick it from
+type Allocation struct {
+	ItemID   string `json:"item_id"`
+	Location string `json:"location"`
+	Quantity int    `json:"quantity"`
+}
+
+// StockPick takes picked units off the shelf. Reserved is how many units were held for
+// them; the reservation of the units that weren't found is dropped as well.
+type StockPick struct {
+	ItemID   string `json:"item_id"`
+	Reserved int    `json:"reserved"`
+	Picked   int    `json:"picked"`
+}
+
+// Allocate reserves the units of every line, or of none: when an item is unknown or
+// hasn't enough unreserved stock, the reservations already made are undone.
+func (m *MongoInventory) Allocate(ctx context.Context, lines []StockLine) ([]Allocation, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	allocations := make([]Allocation, 0, len(lines))
+
+	rollback := func() {
+		m.rollback(ctx, allocations)
+	}
+
+	for _, line := range lines {
+		docID, err := primitive.ObjectIDFromHex(line.ItemID)
+		if err != nil {
+			rollback()
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, line.ItemID)
+		}
+
+		// only reserve when the stock nobody has reserved yet covers the line
+		filter := bson.D{
+			{Key: "_id", Value: docID},
+			{Key: "$expr", Value: bson.D{{Key: "$gte", Value: bson.A{
+				bson.D{{Key: "$subtract", Value: bson.A{"$stock", bson.D{{Key: "$ifNull", Value: bson.A{"$reserved", 0}}}}}},
+				line.Quantity,
+			}}}},
+		}
+		update := bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "reserved", Value: line.Quantity}}},
+			{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+		}
+
+		var item InventoryItemEntry
+		start := time.Now()
+		err = m.collection.FindOneAndUpdate(ctx, filter, update).Decode(&item)
+		observe("inventory", "allocate", start, err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			rollback()
+			return nil, m.shortOf(ctx, line)
+		}
+		if err != nil {
+			rollback()
+			return nil, wrapErr(err)
+		}
+
+		allocations = append(allocations, Allocation{ItemID: line.ItemID, Location: item.Location, Quantity: line.Quantity})
+	}
+
+	return allocations, nil
+}
+
+// rollback undoes the reservations of an allocation that failed part way. It runs on a
+// context of its own, so that reservations made before the caller's deadline passed or the
+// caller went away are undone all the same.
+func (m *MongoInventory) rollback(ctx context.Context, allocations []Allocation) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dbTimeout)
+	defer cancel()
+
+	for _, done := range allocations {
+		if done.Quantity == 0 {
+			continue
+		}
+		docID, _ := primitive.ObjectIDFromHex(done.ItemID)
+
+		start := time.Now()
+		_, err := m.collection.UpdateOne(ctx, bson.M{"_id": docID}, unreserve(done.Quantity))
+		observe("inventory", "rollback", start, err)
+		if err != nil {
+			slog.Error("rolling back allocation", "error", err, "item_id", done.ItemID)
+		}
+	}
+}
+
+// unreserve is an update pipeline dropping a reservation of quantity units; a pipeline, so
+// that the reservation can be clamped at zero
+func unreserve(quantity int) bson.A {
+	return bson.A{bson.D{{Key: "$set", Value: bson.D{
+		{Key: "reserved", Value: bson.D{{Key: "$max", Value: bson.A{
+			0,
+			bson.D{{Key: "$subtract", Value: bson.A{
+				bson.D{{Key: "$ifNull", Value: bson.A{"$reserved", 0}}},
+				quantity,
+			}}},
+		}}}},
+		{Key: "updated_at", Value: time.Now()},
+	}}}}
+}
+
+// shortOf explains why a line couldn't be allocated
+func (m *MongoInventory) shortOf(ctx context.Context, line StockLine) error {
+	item, err := m.GetOne(ctx, line.ItemID)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotFound, line.ItemID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return insufficient(*item, line.Quantity)
+}
+
+// Pick takes the picked units off the shelf and drops their reservations. Neither stock
+// nor reservations go below zero.
+func (m *MongoInventory) Pick(ctx context.Context, picks []StockPick) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var unknown []string
+
+	for _, pick := range picks {
+		docID, err := primitive.ObjectIDFromHex(pick.ItemID)
+		if err != nil {
+			unknown = append(unknown, pick.ItemID)
+			continue
+		}
+
+		update := bson.A{bson.D{{Key: "$set", Value: bson.D{
+			{Key: "stock", Value: bson.D{{Key: "$max", Value: bson.A{
+				0,
+				bson.D{{Key: "$subtract", Value: bson.A{"$stock", pick.Picked}}},
+			}}}},
+			{Key: "reserved", Value: bson.D{{Key: "$max", Value: bson.A{
+				0,
+				bson.D{{Key: "$subtract", Value: bson.A{
+					bson.D{{Key: "$ifNull", Value: bson.A{"$reserved", 0}}},
+					pick.Reserved,
+				}}},
+			}}}},
+			{Key: "updated_at", Value: time.Now()},
+		}}}}
+
+		start := time.Now()
+		result, err := m.collection.UpdateOne(ctx, bson.M{"_id": docID}, update)
+		observe("inventory", "pick", start, err)
+		if err != nil {
+			return unknown, wrapErr(err)
+		}
+
+		if result.MatchedCount == 0 {
+			unknown = append(unknown, pick.ItemID)
+		}
+	}
+
+	return unknown, nil
+}
+
+// Allocate holds the lock for every line, so it is all-or-nothing like the mongo version
+func (m *MemoryInventory) Allocate(ctx context.Context, lines []StockLine) ([]Allocation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// check every line first, counting lines that ask for the same item together
+	wanted := make(map[string]int, len(lines))
+	for _, line := range lines {
+		item, ok := m.items[line.ItemID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, line.ItemID)
+		}
+
+		wanted[line.ItemID] += line.Quantity
+		if item.Stock-item.Reserved < wanted[line.ItemID] {
+			return nil, insufficient(item, wanted[line.ItemID])
+		}
+	}
+
+	allocations := make([]Allocation, 0, len(lines))
+	for _, line := range lines {
+		item := m.items[line.ItemID]
+		item.Reserved += line.Quantity
+		item.UpdatedAt = time.Now()
+		m.items[line.ItemID] = item
+
+		allocations = append(allocations, Allocation{ItemID: line.ItemID, Location: item.Location, Quantity: line.Quantity})
+	}
+
+	return allocations, nil
+}
+
+func (m *MemoryInventory) Pick(ctx context.Context, picks []StockPick) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var unknown []string
+
+	for _, pick := range picks {
+		item, ok := m.items[pick.ItemID]
+		if !ok {
+			unknown = append(unknown, pick.ItemID)
+			continue
+		}
+
+		item.Stock = max(0, item.Stock-pick.Picked)
+		item.Reserved = max(0, item.Reserved-pick.Reserved)
+		item.UpdatedAt = time.Now()
+
+		m.items[pick.ItemID] = item
+	}
+
+	return unknown, nil
+}
+
+func insufficient(item InventoryItemEntry, wanted int) error {
+	return fmt.Errorf("%w: item %s has %d units available, %d wanted", ErrInsufficientStock, item.ID, item.Stock-item.Reserved, wanted)
+}
+
+// AllocateAvailable reserves as many units of every line as there is unreserved stock for,
+// which may be none; a line's allocation says how many it got. Only an unknown item fails
+// the call, and then the reservations already made are undone.
+func (m *MongoInventory) AllocateAvailable(ctx context.Context, lines []StockLine) ([]Allocation, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	allocations := make([]Allocation, 0, len(lines))
+
+	rollback := func() {
+		m.rollback(ctx, allocations)
+	}
+
+	for _, line := range lines {
+		docID, err := primitive.ObjectIDFromHex(line.ItemID)
+		if err != nil {
+			rollback()
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, line.ItemID)
+		}
+
+		// an update pipeline reserves the line or what is left unreserved, whichever is less,
+		// in one step; the item as it was before tells how much that was
+		reserved := bson.D{{Key: "$ifNull", Value: bson.A{"$reserved", 0}}}
+		update := bson.A{bson.D{{Key: "$set", Value: bson.D{
+			{Key: "reserved", Value: bson.D{{Key: "$add", Value: bson.A{
+				reserved,
+				bson.D{{Key: "$min", Value: bson.A{
+					line.Quantity,
+					bson.D{{Key: "$max", Value: bson.A{0, bson.D{{Key: "$subtract", Value: bson.A{"$stock", reserved}}}}}},
+				}}},
+			}}}},
+			{Key: "updated_at", Value: time.Now()},
+		}}}}
+
+		var item InventoryItemEntry
+		start := time.Now()
+		err = m.collection.FindOneAndUpdate(ctx, bson.M{"_id": docID}, update).Decode(&item)
+		observe("inventory", "allocate_available", start, err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			rollback()
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, line.ItemID)
+		}
+		if err != nil {
+			rollback()
+			return nil, wrapErr(err)
+		}
+
+		quantity := min(line.Quantity, max(0, item.Stock-item.Reserved))
+		allocations = append(allocations, Allocation{ItemID: line.ItemID, Location: item.Location, Quantity: quantity})
+	}
+
+	return allocations, nil
+}
+
+// AllocateAvailable holds the lock for every line, so lines that ask for the same item
+// share its stock in the order they are listed
+func (m *MemoryInventory) AllocateAvailable(ctx context.Context, lines []StockLine) ([]Allocation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, line := range lines {
+		if _, ok := m.items[line.ItemID]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, line.ItemID)
+		}
+	}
+
+	allocations := make([]Allocation, 0, len(lines))
+	for _, line := range lines {
+		item := m.items[line.ItemID]
+		quantity := min(line.Quantity, max(0, item.Stock-item.Reserved))
+		if quantity > 0 {
+			item.Reserved += quantity
+			item.UpdatedAt = time.Now()
+			m.items[line.ItemID] = item
+		}
+
+		allocations = append(allocations, Allocation{ItemID: line.ItemID, Location: item.Location, Quantity: quantity})
+	}
+
+	return allocations, nil
+}
+
+// Receive puts quantity new units of the item on the shelf and returns the item as it is
+// afterwards
+func (m *MongoInventory) Receive(ctx context.Context, id string, quantity int) (*InventoryItemEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "stock", Value: quantity}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var item InventoryItemEntry
+	start := time.Now()
+	err = m.collection.FindOneAndUpdate(ctx, bson.M{"_id": docID}, update, opts).Decode(&item)
+	observe("inventory", "receive", start, err)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &item, nil
+}
+
+func (m *MemoryInventory) Receive(ctx context.Context, id string, quantity int) (*InventoryItemEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	item.Stock += quantity
+	item.UpdatedAt = time.Now()
+	m.items[id] = item
+
+	return &item, nil
+}
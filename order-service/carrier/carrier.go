@@ -0,0 +1,115 @@
+// Package carrier hands packages to the carriers that deliver them. Every carrier is an
+// adapter behind the Carrier interface, so that the order service doesn't care whose
+// van picks a package up.
+package carrier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrUnknownCarrier is returned when no carrier is registered under a name
+	ErrUnknownCarrier = errors.New("unknown carrier")
+	// ErrUnknownService is returned when a carrier doesn't offer the asked for service
+	ErrUnknownService = errors.New("unknown carrier service")
+	// ErrUnknownTracking is returned when a carrier doesn't know a tracking number
+	ErrUnknownTracking = errors.New("unknown tracking number")
+)
+
+// Tracking event codes every adapter maps its carrier's events onto
+const (
+	EventLabelCreated   = "label_created"
+	EventPickedUp       = "picked_up"
+	EventInTransit      = "in_transit"
+	EventOutForDelivery = "out_for_delivery"
+	EventDelivered      = "delivered"
+)
+
+// Parcel is a package to ship. Reference identifies it on our side, so that an adapter
+// can hand out the same label when it is asked twice for one package.
+type Parcel struct {
+	Reference string
+	Service   string
+	WeightKg  float64
+	LengthCm  float64
+	WidthCm   float64
+	HeightCm  float64
+}
+
+// Label is what goes on a package
+type Label struct {
+	TrackingNumber string
+	ContentType    string
+	Data           []byte
+}
+
+// Event is one step of a package on its way
+type Event struct {
+	Code        string
+	Description string
+	Location    string
+	At          time.Time
+}
+
+// Carrier is the adapter for one carrier
+type Carrier interface {
+	// Name is what the carrier is registered and recorded under
+	Name() string
+	// Label books the carrier for a parcel and returns its label
+	Label(ctx context.Context, parcel Parcel) (Label, error)
+	// Track returns the events of a package so far, oldest first
+	Track(ctx context.Context, trackingNumber string) ([]Event, error)
+}
+
+// Registry holds the carriers the service can ship with
+type Registry struct {
+	carriers map[string]Carrier
+	fallback string
+}
+
+// NewRegistry registers carriers and picks the one used when a shipment names none
+func NewRegistry(fallback string, carriers ...Carrier) (*Registry, error) {
+	reg := &Registry{carriers: make(map[string]Carrier, len(carriers)), fallback: fallback}
+
+	for _, c := range carriers {
+		if _, ok := reg.carriers[c.Name()]; ok {
+			return nil, fmt.Errorf("carrier %q is registered twice", c.Name())
+		}
+		reg.carriers[c.Name()] = c
+	}
+
+	if _, ok := reg.carriers[fallback]; !ok {
+		return nil, fmt.Errorf("%w: %q is the default but isn't registered", ErrUnknownCarrier, fallback)
+	}
+
+	return reg, nil
+}
+
+// Get returns the carrier registered under name, or the default one when name is empty
+func (reg *Registry) Get(name string) (Carrier, error) {
+	if name == "" {
+		name = reg.fallback
+	}
+
+	c, ok := reg.carriers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCarrier, name)
+	}
+
+	return c, nil
+}
+
+// Names lists the registered carriers, sorted
+func (reg *Registry) Names() []string {
+	names := make([]string, 0, len(reg.carriers))
+	for name := range reg.carriers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
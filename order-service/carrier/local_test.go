@@ -0,0 +1,137 @@
+package carrier
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var labelTime = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// localAt returns a local carrier whose clock reads *now
+func localAt(now *time.Time) *Local {
+	l := NewLocal(time.Hour)
+	l.now = func() time.Time { return *now }
+
+	return l
+}
+
+func TestLocalLabel(t *testing.T) {
+	tests := []struct {
+		service string
+		code    byte
+		want    error
+	}{
+		{"", 'S', nil},
+		{"standard", 'S', nil},
+		{"express", 'E', nil},
+		{"overnight", 0, ErrUnknownService},
+	}
+
+	now := labelTime
+	l := localAt(&now)
+
+	for _, tt := range tests {
+		label, err := l.Label(context.Background(), Parcel{Reference: "order-1/1", Service: tt.service, WeightKg: 1.5, LengthCm: 30, WidthCm: 20, HeightCm: 10})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%q: error = %v, want %v", tt.service, err, tt.want)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		number := label.TrackingNumber
+		if len(number) != 17 || !strings.HasPrefix(number, "LC") || number[2] != tt.code {
+			t.Errorf("%q: tracking number %q", tt.service, number)
+		}
+		if label.ContentType != "application/zpl" || !strings.Contains(string(label.Data), "^FD"+number+"^FS") {
+			t.Errorf("%q: label %s %q doesn't carry the tracking number", tt.service, label.ContentType, label.Data)
+		}
+	}
+}
+
+func TestLocalTrack(t *testing.T) {
+	now := labelTime
+	l := localAt(&now)
+
+	tests := []struct {
+		name    string
+		service string
+		after   time.Duration
+		want    []string
+	}{
+		{"just labelled", "standard", 0, []string{EventLabelCreated}},
+		{"between steps", "standard", 90 * time.Minute, []string{EventLabelCreated, EventPickedUp}},
+		{"out for delivery", "standard", 3 * time.Hour, []string{EventLabelCreated, EventPickedUp, EventInTransit, EventOutForDelivery}},
+		{"delivered", "standard", 4 * time.Hour, []string{EventLabelCreated, EventPickedUp, EventInTransit, EventOutForDelivery, EventDelivered}},
+		{"long delivered", "standard", 100 * time.Hour, []string{EventLabelCreated, EventPickedUp, EventInTransit, EventOutForDelivery, EventDelivered}},
+		{"express moves twice as fast", "express", 2 * time.Hour, []string{EventLabelCreated, EventPickedUp, EventInTransit, EventOutForDelivery, EventDelivered}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the label is made a fraction of a second in; the tracking number keeps whole seconds
+			now = labelTime.Add(300 * time.Millisecond)
+			label, err := l.Label(context.Background(), Parcel{Service: tt.service})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			now = labelTime.Add(tt.after)
+			events, err := l.Track(context.Background(), label.TrackingNumber)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(events) != len(tt.want) {
+				t.Fatalf("events %+v, want %v", events, tt.want)
+			}
+
+			step := time.Hour
+			if tt.service == "express" {
+				step /= 2
+			}
+			for i, e := range events {
+				if e.Code != tt.want[i] {
+					t.Errorf("event %d = %s, want %s", i, e.Code, tt.want[i])
+				}
+				if at := labelTime.Add(time.Duration(i) * step); !e.At.Equal(at) || e.At.Location() != time.UTC {
+					t.Errorf("event %d at %v, want %v", i, e.At, at)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalTrackRejects(t *testing.T) {
+	now := labelTime
+	l := localAt(&now)
+
+	for _, number := range []string{
+		"",
+		"LCS0SBB3VJ4123456X",
+		"XXS0SBB3VJ4123456",
+		"LCX0SBB3VJ4123456",
+		"LCS0SBB3V!4123456",
+	} {
+		if _, err := l.Track(context.Background(), number); !errors.Is(err, ErrUnknownTracking) {
+			t.Errorf("%q: error = %v, want ErrUnknownTracking", number, err)
+		}
+	}
+}
+
+func TestLocalHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	l := NewLocal(time.Hour)
+	if _, err := l.Label(ctx, Parcel{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("label: %v, want context.Canceled", err)
+	}
+	if _, err := l.Track(ctx, "LCS0SBB3VJ4123456"); !errors.Is(err, context.Canceled) {
+		t.Errorf("track: %v, want context.Canceled", err)
+	}
+}
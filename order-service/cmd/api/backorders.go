@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"order-service/data"
+)
+
+// backorderDropped is the reason a backorder is cancelled with when the order it was
+// split off from couldn't record the split
+const backorderDropped = "the split off order wasn't recorded"
+
+// BackorderPayload picks the backorders to allocate: the oldest ones, up to MaxOrders of
+// them, waiting for ProductID when it is given
+type BackorderPayload struct {
+	ProductID string `json:"product_id,omitempty"`
+	MaxOrders int    `json:"max_orders,omitempty"`
+}
+
+// BackorderRun is what allocating backorders did. Allocated orders may have had the units
+// still out of stock split off into new Backorders; Waiting orders got no stock at all.
+type BackorderRun struct {
+	Allocated  []string `json:"allocated"`
+	Backorders []string `json:"backorders"`
+	Waiting    []string `json:"waiting"`
+	Failed     []string `json:"failed"`
+}
+
+// Backorders reports the units waiting for stock by product, each product's orders oldest
+// first. The product_id query parameter narrows the report down to one product.
+func (app *Config) Backorders(w http.ResponseWriter, r *http.Request) {
+	filter := data.OrderFilter{
+		Status:    data.StatusBackordered,
+		ProductID: r.URL.Query().Get("product_id"),
+		PageSize:  data.MaxPageSize,
+		Oldest:    true,
+	}
+
+	var orders []*data.OrderEntry
+	for filter.Page = 1; ; filter.Page++ {
+		page, err := app.Models.Orders.Find(r.Context(), filter)
+		if err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+
+		orders = append(orders, page.Orders...)
+		if len(page.Orders) < filter.PageSize {
+			break
+		}
+	}
+
+	queues := data.BackorderQueues(orders, filter.ProductID)
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "backorders found",
+		Data:    queues,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// AllocateBackorders allocates what stock there is to the oldest backorders, such as once
+// stock was received. Each backorder is allocated on its own, so one that fails doesn't
+// hold up the rest.
+func (app *Config) AllocateBackorders(w http.ResponseWriter, r *http.Request) {
+	var requestPayload BackorderPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if requestPayload.MaxOrders < 0 || requestPayload.MaxOrders > data.MaxPageSize {
+		app.errorJSON(w, r, fmt.Errorf("max_orders must be between 1 and %d", data.MaxPageSize))
+		return
+	}
+
+	maxOrders := requestPayload.MaxOrders
+	if maxOrders == 0 {
+		maxOrders = data.MaxPageSize
+	}
+
+	page, err := app.Models.Orders.Find(r.Context(), data.OrderFilter{
+		Status:    data.StatusBackordered,
+		ProductID: requestPayload.ProductID,
+		PageSize:  maxOrders,
+		Oldest:    true,
+	})
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	run := BackorderRun{Allocated: []string{}, Backorders: []string{}, Waiting: []string{}, Failed: []string{}}
+	for _, order := range page.Orders {
+		backorder, err := app.allocateOrder(r, order, true)
+		switch {
+		case err != nil:
+			// the order is left as it was, the next run tries again
+			requestLogger(r).Warn("backorder not allocated", "order_id", order.ID, "error", err)
+			run.Failed = append(run.Failed, order.ID)
+		case order.Status == data.StatusBackordered:
+			run.Waiting = append(run.Waiting, order.ID)
+		default:
+			run.Allocated = append(run.Allocated, order.ID)
+			if backorder != nil {
+				run.Backorders = append(run.Backorders, backorder.ID)
+			}
+		}
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "backorders allocated",
+		Data:    run,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
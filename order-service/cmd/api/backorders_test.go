@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"order-service/data"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// waitingOrders stores backorders of testProduct for the given quantities, a day apart and
+// oldest first, and returns their ids
+func waitingOrders(t *testing.T, app *Config, quantities ...int) []string {
+	t.Helper()
+
+	ids := make([]string, len(quantities))
+	for i, quantity := range quantities {
+		id, err := app.Models.Orders.Insert(context.Background(), data.OrderEntry{
+			ClientID:  1,
+			OrderDate: time.Date(2026, 2, 1+i, 9, 0, 0, 0, time.UTC),
+			Status:    data.StatusBackordered,
+			Items:     []data.OrderItem{{ProductID: testProduct, ProductName: "Widget", ProductPrice: 2.5, Quantity: quantity}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+
+	return ids
+}
+
+func TestBackorders(t *testing.T) {
+	app, _ := newTestApp(t)
+	h := app.routes()
+	ids := waitingOrders(t, app, 3, 2)
+
+	for _, tt := range []struct {
+		query string
+		units []int
+	}{
+		{"", []int{5}},
+		{"?product_id=" + testProduct, []int{5}},
+		{"?product_id=other", nil},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/backorders"+tt.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: %d %s", tt.query, w.Code, w.Body)
+		}
+
+		var resp struct {
+			Data []data.BackorderQueue `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resp.Data) != len(tt.units) {
+			t.Fatalf("%q: queues %+v, want %v units", tt.query, resp.Data, tt.units)
+		}
+		for i, queue := range resp.Data {
+			if queue.Units != tt.units[i] || len(queue.Orders) != 2 || queue.Orders[0].OrderID != ids[0] || queue.Orders[1].OrderID != ids[1] {
+				t.Errorf("%q: queue %+v", tt.query, queue)
+			}
+		}
+	}
+}
+
+func TestAllocateBackorders(t *testing.T) {
+	tests := []struct {
+		name      string
+		stock     int
+		body      string
+		allocated []int
+		split     int
+		waiting   []int
+	}{
+		{"no stock", 0, `{}`, nil, 0, []int{0, 1, 2}},
+		{"the oldest first", 4, `{}`, []int{0, 1}, 1, []int{2}},
+		{"enough for everyone", 9, `{}`, []int{0, 1, 2}, 0, nil},
+		{"up to max_orders", 9, `{"max_orders":1}`, []int{0}, 0, nil},
+		{"of another product", 9, `{"product_id":"other"}`, nil, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, inventory := newTestApp(t)
+			h := app.routes()
+			ids := waitingOrders(t, app, 3, 2, 4)
+
+			stock := tt.stock
+			inventory.available = &stock
+
+			status, resp := post(t, h, "/backorders/allocate", tt.body, nil)
+			if status != http.StatusOK {
+				t.Fatalf("allocating: %d %s", status, resp.Message)
+			}
+
+			body, _ := json.Marshal(resp.Data)
+			var run BackorderRun
+			if err := json.Unmarshal(body, &run); err != nil {
+				t.Fatal(err)
+			}
+
+			pick := func(indexes []int) []string {
+				picked := []string{}
+				for _, i := range indexes {
+					picked = append(picked, ids[i])
+				}
+				return picked
+			}
+			if !reflect.DeepEqual(run.Allocated, pick(tt.allocated)) || !reflect.DeepEqual(run.Waiting, pick(tt.waiting)) || len(run.Failed) != 0 {
+				t.Errorf("run = %+v", run)
+			}
+			if len(run.Backorders) != tt.split {
+				t.Fatalf("split off %v, want %d backorders", run.Backorders, tt.split)
+			}
+
+			for _, i := range tt.allocated {
+				if order := getOrder(t, app, ids[i]); order.Status != data.StatusAllocated {
+					t.Errorf("order %d is %s", i, order.Status)
+				}
+			}
+			// the second order got one of its two units; the other waits on a new backorder
+			for _, id := range run.Backorders {
+				split := getOrder(t, app, id)
+				if split.Status != data.StatusBackordered || split.BackorderOf != ids[1] || split.Items[0].Quantity != 1 {
+					t.Errorf("split off %+v", split)
+				}
+			}
+		})
+	}
+}
+
+func TestAllocateBackordersRejects(t *testing.T) {
+	app, _ := newTestApp(t)
+	h := app.routes()
+
+	for _, body := range []string{`{"max_orders":-1}`, `{"max_orders":101}`, `{"max_orders":"all"}`} {
+		if status, _ := post(t, h, "/backorders/allocate", body, nil); status != http.StatusBadRequest {
+			t.Errorf("%s: %d, want %d", body, status, http.StatusBadRequest)
+		}
+	}
+}
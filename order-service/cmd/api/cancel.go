@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"order-service/data"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CancelPayload is the body of both cancellation endpoints. Quantity only applies to a
+// line; zero cancels every open unit of it.
+type CancelPayload struct {
+	Reason   string `json:"reason"`
+	Quantity int    `json:"quantity,omitempty"`
+}
+
+// errReleasePending is reported when an order was changed but the inventory service
+// couldn't take the stock back; cancelling again retries the release
+var errReleasePending = errors.New("the order is cancelled but releasing its stock failed, cancel it again to retry")
+
+// CancelOrder cancels every open unit of the order with the id in the path. An order that
+// is already cancelled but whose stock wasn't released yet only has the release retried.
+func (app *Config) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	var requestPayload CancelPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	order, err := app.Models.Orders.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	if order.Status != data.StatusCancelled || !hasPendingRelease(order) {
+		cancelled, err := order.Cancel(requestPayload.Reason, time.Now())
+		if err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+
+		if err := app.Models.Orders.Update(r.Context(), *order); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+
+		countCancelled(cancelled...)
+	}
+
+	app.finishCancellation(w, r, order.ID)
+}
+
+// CancelLine cancels some or all open units of the line with the index in the path
+func (app *Config) CancelLine(w http.ResponseWriter, r *http.Request) {
+	var requestPayload CancelPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	line, err := strconv.Atoi(chi.URLParam(r, "line"))
+	if err != nil {
+		app.errorJSON(w, r, errors.New("line must be a number"))
+		return
+	}
+
+	order, err := app.Models.Orders.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	cancelled, err := order.CancelLine(line, requestPayload.Quantity, requestPayload.Reason, time.Now())
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	if err := app.Models.Orders.Update(r.Context(), *order); err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	countCancelled(cancelled)
+
+	app.finishCancellation(w, r, order.ID)
+}
+
+// finishCancellation releases the stock of every cancellation of the order that the
+// inventory service hasn't taken back yet, and answers with the order as it now is
+func (app *Config) finishCancellation(w http.ResponseWriter, r *http.Request, id string) {
+	order, err := app.Models.Orders.GetOne(r.Context(), id)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	logger := requestLogger(r).With("order_id", id)
+
+	var failed error
+	var released []int
+	for i := range order.Cancellations {
+		if order.Cancellations[i].Released {
+			continue
+		}
+
+		c := order.Cancellations[i]
+		key := fmt.Sprintf("order/%s/cancellation/%d", id, i)
+		lines := []stockReleaseLine{{ItemID: c.ProductID, Quantity: c.Quantity, Restock: c.Restock}}
+
+		if err := app.releaseStock(r, key, id, lines); err != nil {
+			logger.Error("releasing stock", "cancellation", i, "error", err)
+			failed = err
+			continue
+		}
+
+		released = append(released, i)
+	}
+
+	if len(released) > 0 {
+		// the inventory only remembers its answer for a while, so the order itself has to
+		// say the stock is back, or a late retry would release it a second time
+		if err := app.recordReleased(r, id, released); err != nil {
+			logger.Error("recording released stock", "cancellations", released, "error", err)
+		}
+
+		if order, err = app.Models.Orders.GetOne(r.Context(), id); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+	}
+
+	if failed != nil {
+		app.errorJSON(w, r, fmt.Errorf("%w: %v", errReleasePending, failed), http.StatusBadGateway)
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "cancellation recorded",
+		Data:    order,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// recordReleased marks the given cancellations of an order as released, reading the order
+// again for as long as other requests change it first
+func (app *Config) recordReleased(r *http.Request, id string, cancellations []int) error {
+	r, cancel := app.compensating(r)
+	defer cancel()
+
+	for {
+		order, err := app.Models.Orders.GetOne(r.Context(), id)
+		if err != nil {
+			return err
+		}
+
+		for _, i := range cancellations {
+			order.Cancellations[i].Released = true
+		}
+
+		err = app.Models.Orders.Update(r.Context(), *order)
+		if !errors.Is(err, data.ErrConflict) {
+			return err
+		}
+	}
+}
+
+func hasPendingRelease(order *data.OrderEntry) bool {
+	for _, c := range order.Cancellations {
+		if !c.Released {
+			return true
+		}
+	}
+
+	return false
+}
+
+func countCancelled(cancelled ...data.Cancellation) {
+	for _, c := range cancelled {
+		unitsCancelled.WithLabelValues(strconv.FormatBool(c.Restock)).Add(float64(c.Quantity))
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"order-service/data"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// CustomerPayload is a customer as it is created or updated. ID may be given when creating
+// a customer, to keep the client id its orders already use.
+type CustomerPayload struct {
+	ID              int32          `json:"id"`
+	Name            string         `json:"name"`
+	Company         string         `json:"company"`
+	Email           string         `json:"email"`
+	Phone           string         `json:"phone"`
+	Addresses       []data.Address `json:"addresses"`
+	TaxIDs          []data.TaxID   `json:"tax_ids"`
+	DefaultShipping string         `json:"default_shipping"`
+	DefaultBilling  string         `json:"default_billing"`
+}
+
+// CreateCustomer adds the customer in the body, numbering it after the last one unless it
+// has an id
+func (app *Config) CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	var requestPayload CustomerPayload
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	entry := data.CustomerEntry{ID: requestPayload.ID, RequestID: middleware.GetReqID(r.Context())}
+	requestPayload.apply(&entry)
+
+	entry.Normalize()
+	if err := entry.Check(); err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	added, err := app.Models.Customers.Insert(r.Context(), entry)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	customersAdded.Inc()
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "customer added",
+		Data:    added,
+	}
+
+	app.writeJSON(w, http.StatusCreated, resp)
+}
+
+// GetCustomer returns the customer with the id in the path
+func (app *Config) GetCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := customerID(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	entry, err := app.Models.Customers.GetOne(r.Context(), id)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "customer found",
+		Data:    entry,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// UpdateCustomer replaces the details of the customer with the id in the path by the ones
+// in the body. Addresses keep their ids; the orders already placed keep the addresses they
+// were placed with.
+func (app *Config) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := customerID(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var requestPayload CustomerPayload
+	if err := app.readJSON(w, r, &requestPayload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	if requestPayload.ID != 0 && requestPayload.ID != id {
+		app.errorJSON(w, r, errors.New("a customer's id can't be changed"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	entry, err := app.Models.Customers.GetOne(r.Context(), id)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	requestPayload.apply(entry)
+
+	entry.Normalize()
+	if err := entry.Check(); err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	if err := app.Models.Customers.Update(r.Context(), *entry); err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	updated, err := app.Models.Customers.GetOne(r.Context(), id)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "customer updated",
+		Data:    updated,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// SearchCustomers returns a page of the customers matching the query: email, name, page
+// and page_size
+func (app *Config) SearchCustomers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := data.CustomerFilter{Email: q.Get("email"), Name: q.Get("name")}
+
+	for name, dst := range map[string]*int{"page": &filter.Page, "page_size": &filter.PageSize} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			app.errorJSON(w, r, fmt.Errorf("%s must be a positive integer", name))
+			return
+		}
+		*dst = n
+	}
+
+	page, err := app.Models.Customers.Find(r.Context(), filter)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d customers found", page.Total),
+		Data:    page,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// CustomerOrders returns a page of the order history of the customer with the id in the
+// path, narrowed down by the same query as a search for orders
+func (app *Config) CustomerOrders(w http.ResponseWriter, r *http.Request) {
+	id, err := customerID(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	filter, err := parseOrderFilter(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	filter.ClientID = id
+
+	if _, err := app.Models.Customers.GetOne(r.Context(), id); err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	app.findOrders(w, r, filter)
+}
+
+// orderCustomer checks that the order is placed by a known customer and gives it the
+// customer's shipping and billing addresses: the ones with the given ids, or the defaults.
+// An order shipped to an address is taxed where the address is.
+func (app *Config) orderCustomer(ctx context.Context, entry *data.OrderEntry, shippingID, billingID string) error {
+	if entry.ClientID < 1 {
+		return fmt.Errorf("%w: orders are placed by a customer, client_id is required", data.ErrInvalid)
+	}
+
+	customer, err := app.Models.Customers.GetOne(ctx, entry.ClientID)
+	if errors.Is(err, data.ErrCustomerNotFound) {
+		return fmt.Errorf("%w: there is no customer %d", data.ErrInvalid, entry.ClientID)
+	}
+	if err != nil {
+		return err
+	}
+
+	shipping, billing, err := customer.OrderAddresses(shippingID, billingID)
+	if err != nil {
+		return err
+	}
+
+	entry.ShippingAddress = shipping
+	entry.BillingAddress = billing
+	if shipping != nil {
+		entry.Destination = shipping.Destination()
+	}
+
+	return nil
+}
+
+// apply copies the details in the payload to the customer
+func (p CustomerPayload) apply(entry *data.CustomerEntry) {
+	entry.Name = p.Name
+	entry.Company = p.Company
+	entry.Email = p.Email
+	entry.Phone = p.Phone
+	entry.Addresses = p.Addresses
+	entry.TaxIDs = p.TaxIDs
+	entry.DefaultShipping = p.DefaultShipping
+	entry.DefaultBilling = p.DefaultBilling
+}
+
+// customerID reads the customer id in the path
+func customerID(r *http.Request) (int32, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil || id < 1 {
+		return 0, errors.New("customer id must be a positive integer")
+	}
+
+	return int32(id), nil
+}
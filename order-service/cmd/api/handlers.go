@@ -1,42 +1,97 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"order-service/data"
+	"order-service/pricing"
 	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 type JSONPayload struct {
 	ClientID    int32           `json:"client_id"`
 	OrderDate   time.Time        `json:"order_date"`
 	Status      string           `json:"status"`
-	TotalPrice float32          `json:"total_price"`
 	Items       []data.OrderItem `json:"items"`
+	Destination    pricing.Destination `json:"destination"`
+	PromotionCodes []string            `json:"promotion_codes"`
+	// ShippingAddressID and BillingAddressID pick the customer's addresses; the customer's
+	// defaults are used when they are empty
+	ShippingAddressID string `json:"shipping_address_id"`
+	BillingAddressID  string `json:"billing_address_id"`
+}
+
+// PlacedOrder is what the client learns of an order it placed: the id to follow it up by
+// and how its total came about
+type PlacedOrder struct {
+	ID         string             `json:"id"`
+	Status     string             `json:"status"`
+	TotalPrice float32            `json:"total_price"`
+	Pricing    *pricing.Breakdown `json:"pricing"`
 }
 
 func (app *Config) WriteOrder(w http.ResponseWriter, r *http.Request) {
 	// read json into var
 	var requestPayload JSONPayload
-	_ = app.readJSON(w, r, &requestPayload)
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	// every order starts out pending: stock is reserved, picked and shipped through the
+	// service, never by placing an order in a later status
+	switch requestPayload.Status {
+	case "", data.StatusPending:
+		requestPayload.Status = data.StatusPending
+	default:
+		app.errorJSON(w, r, fmt.Errorf("orders can't be placed as %s, only as %s", requestPayload.Status, data.StatusPending), http.StatusUnprocessableEntity)
+		return
+	}
+	for i := range requestPayload.Items {
+		requestPayload.Items[i].Location = ""
+		requestPayload.Items[i].Allocated = 0
+		requestPayload.Items[i].Picked = 0
+		requestPayload.Items[i].Backordered = 0
+	}
 
 	// insert data
 	entry := data.OrderEntry{
 		ClientID:    requestPayload.ClientID,
 		OrderDate:   requestPayload.OrderDate,
 		Status:      requestPayload.Status,
-		TotalPrice: requestPayload.TotalPrice,
 		Items:       requestPayload.Items,
+		Destination:    requestPayload.Destination,
+		PromotionCodes: requestPayload.PromotionCodes,
+		RequestID:   middleware.GetReqID(r.Context()),
+	}
+
+	if err := app.orderCustomer(r.Context(), &entry, requestPayload.ShippingAddressID, requestPayload.BillingAddressID); err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
 	}
 
-	err := app.Models.OrderEntry.Insert(entry)
+	// the total is worked out here from the catalog, whatever the client thinks it is
+	if err := app.priceOrder(r, &entry); err != nil {
+		app.errorJSON(w, r, err, pricingErrorStatus(err))
+		return
+	}
+
+	entry.ID, err = app.Models.Orders.Insert(r.Context(), entry)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorJSON(w, r, err, dataErrorStatus(err))
 		return
 	}
 
+	ordersPlaced.Inc()
+	orderValue.Add(float64(entry.TotalPrice))
+
 	resp := jsonResponse{
 		Error:   false,
 		Message: "oreder added",
+		Data:    PlacedOrder{ID: entry.ID, Status: entry.Status, TotalPrice: entry.TotalPrice, Pricing: entry.Pricing},
 	}
 
 	app.writeJSON(w, http.StatusAccepted, resp)
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"idempotency"
+	"net/http"
+	"net/http/httptest"
+	"order-service/config"
+	"order-service/data"
+	"order-service/pricing"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testProduct is the one product the fake inventory sells
+const testProduct = "6ad63ae1202eb62dba079afb"
+
+// fakeInventory sells testProduct and records the calls it was sent
+type fakeInventory struct {
+	mu sync.Mutex
+	// available caps the units that can be allocated; nil means there is always enough
+	available *int
+	calls     []fakeCall
+}
+
+// fakeCall is one write sent to the fake inventory
+type fakeCall struct {
+	Path string
+	Key  string
+}
+
+// keys returns the idempotency keys of the calls made to path, in order
+func (f *fakeInventory) keys(path string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var keys []string
+	for _, c := range f.calls {
+		if c.Path == path {
+			keys = append(keys, c.Key)
+		}
+	}
+
+	return keys
+}
+
+func (f *fakeInventory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		if r.URL.Path != "/inventory/"+testProduct {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":true,"message":"item not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"error":false,"data":{"id":"` + testProduct + `","name":"Widget","price":2.5,"category":"tools"}}`))
+		return
+	}
+
+	f.calls = append(f.calls, fakeCall{Path: r.URL.Path, Key: r.Header.Get(idempotency.KeyHeader)})
+
+	switch r.URL.Path {
+	case "/inventory/allocate":
+		var request stockAllocate
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		var answer struct {
+			Allocations []stockAllocation `json:"allocations"`
+		}
+		left := -1
+		if f.available != nil {
+			left = *f.available
+		}
+		for _, l := range request.Lines {
+			n := l.Quantity
+			if left >= 0 {
+				n = min(n, left)
+				left -= n
+			}
+			if n < l.Quantity && !request.Partial {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"error":true,"message":"not enough stock"}`))
+				return
+			}
+			answer.Allocations = append(answer.Allocations, stockAllocation{ItemID: l.ItemID, Location: "A-01", Quantity: n})
+		}
+		if f.available != nil {
+			*f.available = left
+		}
+		_ = json.NewEncoder(w).Encode(jsonResponse{Data: answer})
+	case "/inventory/release", "/inventory/pick":
+		_, _ = w.Write([]byte(`{"error":false,"data":{}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":true,"message":"not found"}`))
+	}
+}
+
+// newTestApp returns the order service keeping its data in memory, with a fake inventory
+// that knows testProduct at 2.50 and hands out or takes back any stock, and a tax rate of 20%
+func newTestApp(t *testing.T) (*Config, *fakeInventory) {
+	t.Helper()
+
+	fake := &fakeInventory{}
+	inventory := httptest.NewServer(fake)
+	t.Cleanup(inventory.Close)
+
+	engine, err := pricing.New(0.2, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &Config{
+		Settings: &config.Config{
+			IdempotencyTTL:  config.Duration(time.Hour),
+			InventoryURL:    inventory.URL,
+			UpstreamTimeout: config.Duration(5 * time.Second),
+		},
+		Models:  data.NewMemory(),
+		Pricing: engine,
+	}
+
+	customer := data.CustomerEntry{Name: "Ada", Email: "ada@example.com"}
+	if _, err := app.Models.Customers.Insert(context.Background(), customer); err != nil {
+		t.Fatal(err)
+	}
+
+	return app, fake
+}
+
+// post sends body to path and decodes the answer
+func post(t *testing.T, h http.Handler, path, body string, header http.Header) (int, jsonResponse) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var resp jsonResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+
+	return w.Code, resp
+}
+
+func TestWriteOrderPricesFromCatalog(t *testing.T) {
+	app, _ := newTestApp(t)
+
+	status, resp := post(t, app.routes(), "/order",
+		`{"client_id":1,"items":[{"product_id":"`+testProduct+`","product_name":"Cheap","product_price":0.01,"quantity":2}]}`, nil)
+	if status != http.StatusAccepted {
+		t.Fatalf("status %d: %s", status, resp.Message)
+	}
+
+	placed, _ := resp.Data.(map[string]any)
+	id, _ := placed["id"].(string)
+	if placed["total_price"] != 6.0 {
+		t.Errorf("total_price = %v, want 6", placed["total_price"])
+	}
+
+	order, err := app.Models.Orders.GetOne(context.Background(), id)
+	if err != nil {
+		t.Fatalf("the returned id %q doesn't find the order: %v", id, err)
+	}
+	if item := order.Items[0]; item.ProductPrice != 2.5 || item.ProductName != "Widget" || item.Category != "tools" {
+		t.Errorf("line = %+v, want the catalog's name, price and category", item)
+	}
+	if order.Status != data.StatusPending {
+		t.Errorf("status = %q, want %q", order.Status, data.StatusPending)
+	}
+}
+
+func TestWriteOrderRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"later status", `{"client_id":1,"status":"shipped","items":[{"product_id":"` + testProduct + `","quantity":1}]}`},
+		{"unknown customer", `{"client_id":2,"items":[{"product_id":"` + testProduct + `","quantity":1}]}`},
+		{"no customer", `{"items":[{"product_id":"` + testProduct + `","quantity":1}]}`},
+		{"unknown product", `{"client_id":1,"items":[{"product_id":"nope","quantity":1}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApp(t)
+
+			status, resp := post(t, app.routes(), "/order", tt.body, nil)
+			if status != http.StatusUnprocessableEntity {
+				t.Errorf("status %d (%s), want %d", status, resp.Message, http.StatusUnprocessableEntity)
+			}
+
+			orders, _ := app.Models.Orders.All(context.Background())
+			if len(orders) != 0 {
+				t.Errorf("%d orders stored, want none", len(orders))
+			}
+		})
+	}
+}
+
+func TestWriteOrderIdempotent(t *testing.T) {
+	app, _ := newTestApp(t)
+	h := app.routes()
+	body := `{"client_id":1,"items":[{"product_id":"` + testProduct + `","quantity":1}]}`
+	header := http.Header{idempotency.KeyHeader: {"place-1"}}
+
+	_, first := post(t, h, "/order", body, header)
+	status, second := post(t, h, "/order", body, header)
+	if status != http.StatusAccepted {
+		t.Fatalf("replay status %d: %s", status, second.Message)
+	}
+
+	orders, _ := app.Models.Orders.All(context.Background())
+	if len(orders) != 1 {
+		t.Errorf("%d orders stored, want 1", len(orders))
+	}
+	if first.Data.(map[string]any)["id"] != second.Data.(map[string]any)["id"] {
+		t.Errorf("replay answered with another order: %v, %v", first.Data, second.Data)
+	}
+
+	status, _ = post(t, h, "/order", strings.Replace(body, `"quantity":1`, `"quantity":2`, 1), header)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("reusing the key for another order: status %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestCancelReleasesUnderInternalKey(t *testing.T) {
+	app, inventory := newTestApp(t)
+	h := app.routes()
+
+	status, resp := post(t, h, "/order",
+		`{"client_id":1,"items":[{"product_id":"`+testProduct+`","quantity":2}]}`, nil)
+	if status != http.StatusAccepted {
+		t.Fatalf("placing the order: %d %s", status, resp.Message)
+	}
+	id := resp.Data.(map[string]any)["id"].(string)
+
+	if status, resp = post(t, h, "/order/"+id+"/allocate", `{}`, nil); status != http.StatusOK {
+		t.Fatalf("allocating: %d %s", status, resp.Message)
+	}
+
+	status, resp = post(t, h, "/order/"+id+"/cancel", `{"reason":"changed my mind"}`, nil)
+	if status != http.StatusOK {
+		t.Fatalf("cancelling: %d %s", status, resp.Message)
+	}
+
+	want := internalKeyPrefix + "order/" + id + "/cancellation/0"
+	if keys := inventory.keys("/inventory/release"); len(keys) != 1 || keys[0] != want {
+		t.Fatalf("release keys = %q, want [%q]", keys, want)
+	}
+
+	order, err := app.Models.Orders.GetOne(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(order.Cancellations) != 1 || !order.Cancellations[0].Released {
+		t.Errorf("cancellations = %+v, want the release recorded on the order", order.Cancellations)
+	}
+
+	// cancelling again must not release the stock a second time
+	post(t, h, "/order/"+id+"/cancel", `{"reason":"changed my mind"}`, nil)
+	if keys := inventory.keys("/inventory/release"); len(keys) != 1 {
+		t.Errorf("released %d times", len(keys))
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"idempotency"
+	"net/http"
+	"time"
+)
+
+// internalKeyPrefix starts the idempotency keys the service makes up for its own calls to
+// the inventory service. The broker refuses client keys that start with it, so a client
+// can't take a key the service is going to use.
+const internalKeyPrefix = "internal/"
+
+// idempotent stores the response to every request sent with an Idempotency-Key and replays
+// it for later requests of the same user with the same key; see package idempotency
+func (app *Config) idempotent(next http.Handler) http.Handler {
+	m := &idempotency.Middleware{
+		Store: app.Models.Idempotency,
+		TTL:   time.Duration(app.Settings.IdempotencyTTL),
+		Error: func(w http.ResponseWriter, r *http.Request, err error, status int) {
+			if status == 0 {
+				status = dataErrorStatus(err)
+			}
+			app.errorJSON(w, r, err, status)
+		},
+		Logger: requestLogger,
+	}
+
+	return m.Handler(next)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"idempotency"
+	"io"
+	"net/http"
+	"net/url"
+	"order-service/data"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// stockRelease is what the inventory service's /inventory/release expects
+type stockRelease struct {
+	OrderID string             `json:"order_id"`
+	Lines   []stockReleaseLine `json:"lines"`
+}
+
+type stockReleaseLine struct {
+	ItemID   string `json:"item_id"`
+	Quantity int    `json:"quantity"`
+	Restock  bool   `json:"restock"`
+}
+
+// stockAllocate is what the inventory service's /inventory/allocate expects
+type stockAllocate struct {
+	OrderID string      `json:"order_id"`
+	Lines   []stockLine `json:"lines"`
+	Partial bool        `json:"partial,omitempty"`
+}
+
+type stockLine struct {
+	ItemID   string `json:"item_id"`
+	Quantity int    `json:"quantity"`
+}
+
+// stockAllocation is one line of the inventory service's answer to an allocation, in the
+// order the lines were sent
+type stockAllocation struct {
+	ItemID   string `json:"item_id"`
+	Location string `json:"location"`
+	Quantity int    `json:"quantity"`
+}
+
+// stockPick is what the inventory service's /inventory/pick expects
+type stockPick struct {
+	OrderID    string          `json:"order_id"`
+	PickListID string          `json:"pick_list_id"`
+	Lines      []stockPickLine `json:"lines"`
+}
+
+type stockPickLine struct {
+	ItemID   string `json:"item_id"`
+	Reserved int    `json:"reserved"`
+	Picked   int    `json:"picked"`
+}
+
+// upstreamError is an answer from the inventory service that wasn't a success
+type upstreamError struct {
+	Status  int
+	Message string
+}
+
+func (e *upstreamError) Error() string {
+	return fmt.Sprintf("inventory-service answered %d: %s", e.Status, e.Message)
+}
+
+// releaseStock hands units of an order back to the inventory service. key must identify
+// what the units are given back for, such as one cancellation of the order, so that however
+// often the same release is sent its units are released once.
+func (app *Config) releaseStock(r *http.Request, key, orderID string, lines []stockReleaseLine) error {
+	var answer struct {
+		Unknown []string `json:"unknown"`
+	}
+
+	if err := app.callInventory(r, "/inventory/release", key, stockRelease{OrderID: orderID, Lines: lines}, &answer); err != nil {
+		return err
+	}
+
+	// nothing more can be done for products the inventory never had
+	if len(answer.Unknown) > 0 {
+		requestLogger(r).Warn("inventory doesn't know the released products", "order_id", orderID, "products", answer.Unknown)
+	}
+
+	return nil
+}
+
+// allocateStock reserves the stock for lines of an order. key must identify the attempt;
+// a refused allocation is answered the same way for as long as its key is reused. A
+// partial allocation reserves what stock there is for each line instead of refusing.
+func (app *Config) allocateStock(r *http.Request, key, orderID string, lines []stockLine, partial bool) ([]stockAllocation, error) {
+	var answer struct {
+		Allocations []stockAllocation `json:"allocations"`
+	}
+
+	if err := app.callInventory(r, "/inventory/allocate", key, stockAllocate{OrderID: orderID, Lines: lines, Partial: partial}, &answer); err != nil {
+		return nil, err
+	}
+
+	if len(answer.Allocations) != len(lines) {
+		return nil, fmt.Errorf("inventory-service allocated %d of %d lines", len(answer.Allocations), len(lines))
+	}
+
+	return answer.Allocations, nil
+}
+
+// pickStock has the inventory service take the picked units of an order off the shelf
+func (app *Config) pickStock(r *http.Request, pickListID, orderID string, lines []stockPickLine) error {
+	var answer struct {
+		Unknown []string `json:"unknown"`
+	}
+
+	key := "picklist/" + pickListID + "/order/" + orderID
+	if err := app.callInventory(r, "/inventory/pick", key, stockPick{OrderID: orderID, PickListID: pickListID, Lines: lines}, &answer); err != nil {
+		return err
+	}
+
+	if len(answer.Unknown) > 0 {
+		requestLogger(r).Warn("inventory doesn't know the picked products", "order_id", orderID, "products", answer.Unknown)
+	}
+
+	return nil
+}
+
+// catalogItem is what an order takes from an inventory item: the product as it is sold
+type catalogItem struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Price    float32 `json:"price"`
+	Category string  `json:"category"`
+}
+
+// catalog looks up the products of the order's lines, once each. A product the inventory
+// doesn't have is reported as ErrInvalid.
+func (app *Config) catalog(r *http.Request, items []data.OrderItem) (map[string]catalogItem, error) {
+	products := make(map[string]catalogItem, len(items))
+
+	for _, item := range items {
+		if _, ok := products[item.ProductID]; ok {
+			continue
+		}
+
+		var product catalogItem
+		err := app.doInventory(r, http.MethodGet, "/inventory/"+url.PathEscape(item.ProductID), "", nil, &product)
+		var upstream *upstreamError
+		if errors.As(err, &upstream) && upstream.Status == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: there is no product %s", data.ErrInvalid, item.ProductID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errCatalog, err)
+		}
+
+		products[item.ProductID] = product
+	}
+
+	return products, nil
+}
+
+// compensating returns the request with a context to undo or record its partial work on:
+// one that isn't cancelled with the request, so that a request that timed out or whose
+// caller went away still cleans up after itself, and has a deadline of its own
+func (app *Config) compensating(r *http.Request) (*http.Request, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), time.Duration(app.Settings.UpstreamTimeout))
+
+	return r.WithContext(ctx), cancel
+}
+
+// callInventory posts payload to the inventory service with an idempotency key and
+// decodes the data of its answer into answer. Answers other than 200 are returned as an
+// *upstreamError. The key is sent under internalKeyPrefix, apart from client keys.
+func (app *Config) callInventory(r *http.Request, path, key string, payload, answer any) error {
+	return app.doInventory(r, http.MethodPost, path, internalKeyPrefix+key, payload, answer)
+}
+
+// doInventory sends a request to the inventory service; payload and key are left out of
+// requests that have none
+func (app *Config) doInventory(r *http.Request, method, path, key string, payload, answer any) error {
+	var body io.Reader
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(app.Settings.UpstreamTimeout))
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, method, app.Settings.InventoryURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		request.Header.Set(idempotency.KeyHeader, key)
+	}
+	request.Header.Set(requestIDHeader, middleware.GetReqID(r.Context()))
+	if deadline, ok := ctx.Deadline(); ok {
+		request.Header.Set(requestTimeoutHeader, strconv.FormatInt(time.Until(deadline).Milliseconds(), 10))
+	}
+
+	response, err := upstreamClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("calling inventory-service: %w", err)
+	}
+	defer response.Body.Close()
+
+	jsonFromService := struct {
+		Message string `json:"message"`
+		Data    any    `json:"data"`
+	}{Data: answer}
+	_ = json.NewDecoder(response.Body).Decode(&jsonFromService)
+
+	if response.StatusCode != http.StatusOK {
+		return &upstreamError{Status: response.StatusCode, Message: jsonFromService.Message}
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"order-service/data"
+	"order-service/invoice"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// DocumentResponse is an invoice rendered in one format. Document is base64 in json.
+type DocumentResponse struct {
+	Number      string `json:"number"`
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	Document    []byte `json:"document"`
+}
+
+// CreateInvoice issues the invoice of the shipped order with the id in the path, giving
+// it the next invoice number and rendering its documents
+func (app *Config) CreateInvoice(w http.ResponseWriter, r *http.Request) {
+	order, err := app.Models.Orders.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	settings := data.InvoiceSettings{
+		Issuer:   app.Settings.InvoiceIssuer,
+		Currency: app.Settings.Currency,
+		TaxRate:  app.Settings.TaxRate,
+	}
+
+	// orders placed before there were customers are invoiced without a bill-to
+	customer, err := app.Models.Customers.GetOne(r.Context(), order.ClientID)
+	if errors.Is(err, data.ErrCustomerNotFound) {
+		customer, err = nil, nil
+	}
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	entry, err := data.NewInvoice(order, customer, settings, time.Now())
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+	entry.RequestID = middleware.GetReqID(r.Context())
+
+	issued, err := app.Models.Invoices.Insert(r.Context(), entry, invoice.Render)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	invoicesIssued.Inc()
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "invoice issued",
+		Data:    issued,
+	}
+
+	app.writeJSON(w, http.StatusCreated, resp)
+}
+
+// OrderInvoice returns the invoice of the order with the id in the path
+func (app *Config) OrderInvoice(w http.ResponseWriter, r *http.Request) {
+	entry, err := app.Models.Invoices.ByOrder(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "invoice found",
+		Data:    entry,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// GetInvoice returns the invoice with the id in the path
+func (app *Config) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	entry, err := app.Models.Invoices.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "invoice found",
+		Data:    entry,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// InvoiceDocument returns the invoice with the id in the path as it was rendered when it
+// was issued, in the format of the query: pdf, the default, or html
+func (app *Config) InvoiceDocument(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = data.InvoicePDF
+	}
+	if format != data.InvoicePDF && format != data.InvoiceHTML {
+		app.errorJSON(w, r, errors.New("format must be pdf or html"))
+		return
+	}
+
+	entry, err := app.Models.Invoices.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	doc, ok := entry.Document(format)
+	if !ok {
+		app.errorJSON(w, r, fmt.Errorf("invoice %s has no %s document", entry.Number, format), http.StatusNotFound)
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "invoice document found",
+		Data:    DocumentResponse{Number: entry.Number, Format: doc.Format, ContentType: doc.ContentType, Document: doc.Data},
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// userIDHeader identifies the user a request is made for, when the caller knows it
+const userIDHeader = "X-User-ID"
+
+// newLogger builds the service's JSON logger at the given level
+// (debug, info, warn or error; info when empty or unknown) and makes it the default
+func newLogger(service, logLevel string) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(logLevel))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+	logger := slog.New(handler).With("service", service)
+
+	slog.SetDefault(logger)
+
+	return logger
+}
+
+// requestLogger returns a logger that tags every line with the request, user and trace id
+func requestLogger(r *http.Request) *slog.Logger {
+	logger := slog.Default().With("request_id", middleware.GetReqID(r.Context()))
+
+	if userID := r.Header.Get(userIDHeader); userID != "" {
+		logger = logger.With("user_id", userID)
+	}
+
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		logger = logger.With("trace_id", sc.TraceID().String())
+	}
+
+	return logger
+}
+
+// accessLog writes one structured line for every request once it has been served
+func accessLog(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		route := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		requestLogger(r).LogAttrs(r.Context(), level, "request served",
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Float64("latency_ms", msSince(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// msSince returns the milliseconds elapsed since start, with microsecond precision
+func msSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
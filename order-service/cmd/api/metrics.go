@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"order-service/data"
+)
+
+// scrapeTimeout bounds the database query a scrape triggers
+const scrapeTimeout = 5 * time.Second
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	ordersPlaced = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_placed_total",
+		Help: "Orders placed since the service started.",
+	})
+
+	orderValue = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_placed_value_total",
+		Help: "Total price of the orders placed since the service started.",
+	})
+
+	unitsCancelled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "order_units_cancelled_total",
+		Help: "Ordered units cancelled since the service started, by whether they were restocked.",
+	}, []string{"restock"})
+
+	unitsBackordered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "order_units_backordered_total",
+		Help: "Ordered units found out of stock and backordered since the service started.",
+	})
+
+	unitsPicked = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "order_units_picked_total",
+		Help: "Ordered units confirmed as picked since the service started.",
+	})
+
+	shipmentsShipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shipments_shipped_total",
+		Help: "Shipments handed to a carrier since the service started, by carrier.",
+	}, []string{"carrier"})
+
+	customersAdded = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "customers_added_total",
+		Help: "Customers added since the service started.",
+	})
+
+	invoicesIssued = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "invoices_issued_total",
+		Help: "Invoices issued since the service started.",
+	})
+
+	returnsAuthorized = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "returns_authorized_total",
+		Help: "Return authorizations issued since the service started.",
+	})
+
+	refundValue = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "returns_refund_value_total",
+		Help: "Total refunds worked out for inspected returns since the service started.",
+	})
+)
+
+// instrument records the count and latency of every request under its chi route pattern,
+// so that /orders/{id} is one series rather than one per order
+func instrument(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		labels := prometheus.Labels{"route": route, "method": r.Method, "status": strconv.Itoa(status)}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// orderStatusCollector reports how many orders are in each status, read from mongo at scrape time
+type orderStatusCollector struct {
+	models data.Models
+	orders *prometheus.Desc
+}
+
+func newOrderStatusCollector(models data.Models) *orderStatusCollector {
+	return &orderStatusCollector{
+		models: models,
+		orders: prometheus.NewDesc("orders", "Orders stored, by status.", []string{"status"}, nil),
+	}
+}
+
+func (c *orderStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.orders
+}
+
+func (c *orderStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	counts, err := c.models.Orders.CountByStatus(ctx)
+	if err != nil {
+		slog.Error("collecting order metrics", "error", err)
+		return
+	}
+
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.orders, prometheus.GaugeValue, float64(count), status)
+	}
+}
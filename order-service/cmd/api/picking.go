@@ -0,0 +1,492 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"order-service/data"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// PickListPayload picks the orders for a new pick list. Without order ids the oldest
+// allocated orders are taken, up to MaxOrders of them.
+type PickListPayload struct {
+	OrderIDs  []string `json:"order_ids,omitempty"`
+	MaxOrders int      `json:"max_orders,omitempty"`
+}
+
+type ConfirmPayload struct {
+	Lines []data.PickConfirmation `json:"lines"`
+}
+
+var (
+	// errNotAllocated is reported when the inventory service refused to reserve the stock
+	errNotAllocated = errors.New("the order's stock can't be allocated")
+	// errInventory is reported when the inventory service couldn't be asked for the stock
+	errInventory = errors.New("the inventory service failed to allocate the stock")
+	// errPickPending is reported when a pick list was confirmed but some of its orders
+	// couldn't be moved on; confirming again retries them
+	errPickPending = errors.New("the pick list is confirmed but posting some of its orders failed, confirm it again to retry")
+)
+
+// AllocatePayload asks for the allocation of an order. With Backorder the units that are
+// out of stock are split off into a backorder rather than refusing the whole order.
+type AllocatePayload struct {
+	Backorder bool `json:"backorder,omitempty"`
+}
+
+// AllocateOrder reserves the stock of every open line of the order with the id in the
+// path and records where each line is picked from
+func (app *Config) AllocateOrder(w http.ResponseWriter, r *http.Request) {
+	var requestPayload AllocatePayload
+	// without a body the whole order is allocated or none of it, as it always was
+	if r.ContentLength != 0 {
+		if err := app.readJSON(w, r, &requestPayload); err != nil {
+			app.errorJSON(w, r, err)
+			return
+		}
+	}
+
+	order, err := app.Models.Orders.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	backorder, err := app.allocateOrder(r, order, requestPayload.Backorder)
+	if err != nil {
+		app.errorJSON(w, r, err, allocationStatus(err))
+		return
+	}
+
+	switch {
+	case backorder != nil:
+		app.writeOrder(w, r, order.ID, "order allocated, units out of stock backordered")
+	case order.Status == data.StatusBackordered:
+		app.writeOrder(w, r, order.ID, "order backordered")
+	default:
+		app.writeOrder(w, r, order.ID, "order allocated")
+	}
+}
+
+// allocateOrder reserves the stock of the order's open lines and records the allocation.
+// When backorder is set, units that are out of stock are split off into a new backorder,
+// which is returned, and an order with nothing in stock becomes or stays backordered.
+func (app *Config) allocateOrder(r *http.Request, order *data.OrderEntry, backorder bool) (*data.OrderEntry, error) {
+	if err := order.Allocatable(); err != nil {
+		return nil, err
+	}
+
+	// the attempt is claimed on the order first: the inventory tells attempts apart by the
+	// key derived from it, and of two concurrent allocations of the order only one claims it
+	order.AllocationAttempts++
+	if err := app.Models.Orders.Update(r.Context(), *order); err != nil {
+		return nil, err
+	}
+	claimed, err := app.Models.Orders.GetOne(r.Context(), order.ID)
+	if err != nil {
+		return nil, err
+	}
+	*order = *claimed
+
+	var lines []stockLine
+	var indexes []int
+	for i, item := range order.Items {
+		if item.Open() > 0 {
+			lines = append(lines, stockLine{ItemID: item.ProductID, Quantity: item.Open()})
+			indexes = append(indexes, i)
+		}
+	}
+
+	// every attempt is new to the inventory, so that one refused for lack of stock can
+	// succeed once stock arrives; retries of the same request are replayed before this
+	key := fmt.Sprintf("order/%s/allocate/%d", order.ID, order.AllocationAttempts)
+
+	allocated, err := app.allocateStock(r, key, order.ID, lines, backorder)
+	if err != nil {
+		var upstream *upstreamError
+		if errors.As(err, &upstream) && upstream.Status < http.StatusInternalServerError {
+			return nil, fmt.Errorf("%w: %s", errNotAllocated, upstream.Message)
+		}
+		requestLogger(r).Error("allocating stock", "order_id", order.ID, "error", err)
+		return nil, fmt.Errorf("%w: %v", errInventory, err)
+	}
+
+	var allocations []data.LineAllocation
+	short := make([]int, len(order.Items))
+	shortUnits := 0
+	for i, a := range allocated {
+		if a.Quantity > 0 {
+			allocations = append(allocations, data.LineAllocation{Line: indexes[i], Location: a.Location, Quantity: a.Quantity})
+		}
+		if s := lines[i].Quantity - a.Quantity; s > 0 {
+			short[indexes[i]] = s
+			shortUnits += s
+		}
+	}
+
+	var split *data.OrderEntry
+	switch {
+	case len(allocations) == 0 && order.Status == data.StatusBackordered:
+		// still nothing in stock, the backorder keeps waiting
+		return nil, nil
+	case len(allocations) == 0:
+		err = order.Backorder()
+	case shortUnits > 0:
+		var entry data.OrderEntry
+		if entry, err = order.SplitBackorder(data.NewOrderID(), short); err == nil {
+			entry.RequestID = middleware.GetReqID(r.Context())
+			split = &entry
+			err = order.Allocate(allocations)
+		}
+	default:
+		err = order.Allocate(allocations)
+	}
+
+	undo := func() {
+		// the order doesn't know about the reservation, so it must not outlive the request,
+		// even when the request ran out of time
+		r, cancel := app.compensating(r)
+		defer cancel()
+
+		var release []stockReleaseLine
+		for _, a := range allocated {
+			if a.Quantity > 0 {
+				release = append(release, stockReleaseLine{ItemID: a.ItemID, Quantity: a.Quantity})
+			}
+		}
+		if len(release) == 0 {
+			return
+		}
+		if err := app.releaseStock(r, key+"/undo", order.ID, release); err != nil {
+			requestLogger(r).Error("releasing stock of an allocation that wasn't recorded", "order_id", order.ID, "error", err)
+		}
+	}
+
+	if err != nil {
+		undo()
+		return nil, err
+	}
+
+	// the backorder goes first: should the order fail to record the split, the backorder
+	// is cancelled again, whereas units taken off the order with no backorder to hold them
+	// would be lost
+	if split != nil {
+		if _, err := app.Models.Orders.Insert(r.Context(), *split); err != nil {
+			undo()
+			return nil, err
+		}
+	}
+
+	if err := app.Models.Orders.Update(r.Context(), *order); err != nil {
+		undo()
+		if split != nil {
+			app.dropBackorder(r, split.ID)
+		}
+		return nil, err
+	}
+
+	unitsBackordered.Add(float64(shortUnits))
+
+	return split, nil
+}
+
+// dropBackorder cancels a backorder that was split off an order that couldn't record it
+func (app *Config) dropBackorder(r *http.Request, id string) {
+	r, cancel := app.compensating(r)
+	defer cancel()
+
+	backorder, err := app.Models.Orders.GetOne(r.Context(), id)
+	if err == nil {
+		if _, err = backorder.Cancel(backorderDropped, time.Now()); err == nil {
+			err = app.Models.Orders.Update(r.Context(), *backorder)
+		}
+	}
+	if err != nil {
+		requestLogger(r).Error("cancelling a backorder its order didn't record", "order_id", id, "error", err)
+	}
+}
+
+// allocationStatus is the status a failed allocation is answered with
+func allocationStatus(err error) int {
+	switch {
+	case errors.Is(err, errNotAllocated):
+		return http.StatusConflict
+	case errors.Is(err, errInventory):
+		return http.StatusBadGateway
+	default:
+		return dataErrorStatus(err)
+	}
+}
+
+// CreatePickList puts allocated orders on a new pick list and marks them as being picked
+func (app *Config) CreatePickList(w http.ResponseWriter, r *http.Request) {
+	var requestPayload PickListPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if requestPayload.MaxOrders < 0 || requestPayload.MaxOrders > data.MaxPageSize {
+		app.errorJSON(w, r, fmt.Errorf("max_orders must be between 1 and %d", data.MaxPageSize))
+		return
+	}
+
+	orders, err := app.pickableOrders(r, requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	list, err := data.NewPickList(orders, time.Now())
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+	list.ID = data.NewPickListID()
+	list.RequestID = middleware.GetReqID(r.Context())
+
+	// claim the orders before the list exists, so that no order lands on two lists
+	var claimed []string
+	for _, order := range orders {
+		order.Status = data.StatusPicking
+		order.PickListID = list.ID
+
+		if err := app.Models.Orders.Update(r.Context(), *order); err != nil {
+			app.unclaimOrders(r, list.ID, claimed)
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+		claimed = append(claimed, order.ID)
+	}
+
+	if err := app.Models.PickLists.Insert(r.Context(), list); err != nil {
+		app.unclaimOrders(r, list.ID, claimed)
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "pick list created",
+		Data:    list,
+	}
+
+	app.writeJSON(w, http.StatusCreated, resp)
+}
+
+// GetPickList returns the pick list with the id in the path
+func (app *Config) GetPickList(w http.ResponseWriter, r *http.Request) {
+	list, err := app.Models.PickLists.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "pick list found",
+		Data:    list,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// ConfirmPickList records what the pickers found, cancels the units they didn't and moves
+// every order of the list on. A list that is already confirmed but has orders that
+// weren't posted yet only has those retried.
+func (app *Config) ConfirmPickList(w http.ResponseWriter, r *http.Request) {
+	var requestPayload ConfirmPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	list, err := app.Models.PickLists.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	if list.Status != data.PickListConfirmed {
+		if err := list.Confirm(requestPayload.Lines, time.Now()); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+
+		if err := app.Models.PickLists.Update(r.Context(), *list); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+
+		if list, err = app.Models.PickLists.GetOne(r.Context(), list.ID); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+	}
+
+	logger := requestLogger(r).With("pick_list_id", list.ID)
+
+	var failed error
+	posted := false
+	for _, o := range list.Orders {
+		if o.Posted {
+			continue
+		}
+
+		if err := app.postPick(r, list, o.OrderID); err != nil {
+			logger.Error("posting picked order", "order_id", o.OrderID, "error", err)
+			failed = err
+			continue
+		}
+
+		list.Posted(o.OrderID, time.Now())
+		posted = true
+	}
+
+	if posted {
+		// if the list changed meanwhile its orders stay unposted; posting them again is
+		// harmless, orders that were moved on already are skipped
+		if err := app.Models.PickLists.Update(r.Context(), *list); err != nil {
+			logger.Warn("recording posted orders", "error", err)
+		} else if list, err = app.Models.PickLists.GetOne(r.Context(), list.ID); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+	}
+
+	if failed != nil {
+		app.errorJSON(w, r, fmt.Errorf("%w: %v", errPickPending, failed), http.StatusBadGateway)
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "pick list confirmed",
+		Data:    list,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// postPick takes the picked units of one order of the list off the shelf and moves the
+// order on. The inventory goes first: when the order can't be updated afterwards, the
+// retry sends the same pick again, which the inventory service answers once.
+func (app *Config) postPick(r *http.Request, list *data.PickList, orderID string) error {
+	order, err := app.Models.Orders.GetOne(r.Context(), orderID)
+	if err != nil {
+		return err
+	}
+
+	// an earlier attempt already moved the order on
+	if order.Status != data.StatusPicking || order.PickListID != list.ID {
+		return nil
+	}
+
+	lines := list.OrderLines(orderID)
+
+	picks := make([]stockPickLine, 0, len(lines))
+	for _, line := range lines {
+		picks = append(picks, stockPickLine{ItemID: line.ProductID, Reserved: line.Quantity, Picked: line.Picked})
+	}
+
+	if err := app.pickStock(r, list.ID, orderID, picks); err != nil {
+		return err
+	}
+
+	cancelled, err := order.ConfirmPick(lines, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := app.Models.Orders.Update(r.Context(), *order); err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		unitsPicked.Add(float64(line.Picked))
+	}
+	countCancelled(cancelled...)
+
+	return nil
+}
+
+// pickableOrders loads the orders asked for, or the oldest allocated ones
+func (app *Config) pickableOrders(r *http.Request, requestPayload PickListPayload) ([]*data.OrderEntry, error) {
+	if len(requestPayload.OrderIDs) == 0 {
+		page, err := app.Models.Orders.Find(r.Context(), data.OrderFilter{
+			Status:   data.StatusAllocated,
+			PageSize: requestPayload.MaxOrders,
+			Oldest:   true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Orders) == 0 {
+			return nil, fmt.Errorf("%w: no allocated orders to pick", data.ErrInvalid)
+		}
+		return page.Orders, nil
+	}
+
+	if len(requestPayload.OrderIDs) > data.MaxPageSize {
+		return nil, fmt.Errorf("%w: a pick list takes at most %d orders", data.ErrInvalid, data.MaxPageSize)
+	}
+
+	seen := make(map[string]bool, len(requestPayload.OrderIDs))
+	orders := make([]*data.OrderEntry, 0, len(requestPayload.OrderIDs))
+	for _, id := range requestPayload.OrderIDs {
+		if seen[id] {
+			return nil, fmt.Errorf("%w: order %s is listed twice", data.ErrInvalid, id)
+		}
+		seen[id] = true
+
+		order, err := app.Models.Orders.GetOne(r.Context(), id)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// unclaimOrders puts orders claimed for a pick list that couldn't be created back to
+// allocated
+func (app *Config) unclaimOrders(r *http.Request, listID string, ids []string) {
+	r, cancel := app.compensating(r)
+	defer cancel()
+
+	for _, id := range ids {
+		order, err := app.Models.Orders.GetOne(r.Context(), id)
+		if err == nil && order.Status == data.StatusPicking && order.PickListID == listID {
+			order.Status = data.StatusAllocated
+			order.PickListID = ""
+			err = app.Models.Orders.Update(r.Context(), *order)
+		}
+		if err != nil {
+			requestLogger(r).Error("returning order to allocated", "order_id", id, "pick_list_id", listID, "error", err)
+		}
+	}
+}
+
+// writeOrder answers with the order as it is stored now
+func (app *Config) writeOrder(w http.ResponseWriter, r *http.Request, id, message string) {
+	order, err := app.Models.Orders.GetOne(r.Context(), id)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    order,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"order-service/data"
+	"strconv"
+	"testing"
+)
+
+// placeOrder places an order for quantity units of testProduct and returns its id
+func placeOrder(t *testing.T, h http.Handler, quantity int) string {
+	t.Helper()
+
+	status, resp := post(t, h, "/order",
+		`{"client_id":1,"items":[{"product_id":"`+testProduct+`","quantity":`+strconv.Itoa(quantity)+`}]}`, nil)
+	if status != http.StatusAccepted {
+		t.Fatalf("placing the order: %d %s", status, resp.Message)
+	}
+
+	return resp.Data.(map[string]any)["id"].(string)
+}
+
+func getOrder(t *testing.T, app *Config, id string) *data.OrderEntry {
+	t.Helper()
+
+	order, err := app.Models.Orders.GetOne(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return order
+}
+
+// flakyOrders fails every update after the first ok ones
+type flakyOrders struct {
+	data.OrderRepository
+	ok int
+}
+
+func (f *flakyOrders) Update(ctx context.Context, entry data.OrderEntry) error {
+	if f.ok == 0 {
+		return data.ErrTimeout
+	}
+	f.ok--
+
+	return f.OrderRepository.Update(ctx, entry)
+}
+
+func TestAllocateOrder(t *testing.T) {
+	app, inventory := newTestApp(t)
+	h := app.routes()
+	id := placeOrder(t, h, 3)
+
+	status, resp := post(t, h, "/order/"+id+"/allocate", `{}`, nil)
+	if status != http.StatusOK {
+		t.Fatalf("allocating: %d %s", status, resp.Message)
+	}
+
+	order := getOrder(t, app, id)
+	if order.Status != data.StatusAllocated || order.Items[0].Allocated != 3 || order.Items[0].Location != "A-01" {
+		t.Errorf("order = %s, line %+v", order.Status, order.Items[0])
+	}
+
+	want := internalKeyPrefix + "order/" + id + "/allocate/1"
+	if keys := inventory.keys("/inventory/allocate"); len(keys) != 1 || keys[0] != want {
+		t.Errorf("allocation keys = %q, want [%q]", keys, want)
+	}
+
+	// an allocated order can't be allocated again
+	if status, _ := post(t, h, "/order/"+id+"/allocate", `{}`, nil); status != http.StatusConflict {
+		t.Errorf("allocating again: %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestAllocateOrderRefused(t *testing.T) {
+	app, inventory := newTestApp(t)
+	h := app.routes()
+	id := placeOrder(t, h, 3)
+
+	none := 0
+	inventory.available = &none
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		if status, _ := post(t, h, "/order/"+id+"/allocate", `{}`, nil); status != http.StatusConflict {
+			t.Fatalf("attempt %d: %d, want %d", attempt, status, http.StatusConflict)
+		}
+	}
+
+	order := getOrder(t, app, id)
+	if order.Status != data.StatusPending || order.AllocationAttempts != 2 {
+		t.Errorf("order = %s after %d attempts, want pending after 2", order.Status, order.AllocationAttempts)
+	}
+
+	// every attempt asks the inventory afresh, so that one can succeed once stock arrives
+	keys := inventory.keys("/inventory/allocate")
+	if len(keys) != 2 || keys[0] == keys[1] {
+		t.Errorf("allocation keys = %q, want two different ones", keys)
+	}
+	if releases := inventory.keys("/inventory/release"); len(releases) != 0 {
+		t.Errorf("released %q after a refusal", releases)
+	}
+}
+
+func TestAllocateOrderBackorders(t *testing.T) {
+	app, inventory := newTestApp(t)
+	h := app.routes()
+	id := placeOrder(t, h, 3)
+
+	one := 1
+	inventory.available = &one
+
+	status, resp := post(t, h, "/order/"+id+"/allocate", `{"backorder":true}`, nil)
+	if status != http.StatusOK {
+		t.Fatalf("allocating: %d %s", status, resp.Message)
+	}
+
+	order := getOrder(t, app, id)
+	if order.Status != data.StatusAllocated || order.Items[0].Allocated != 1 || order.Items[0].Backordered != 2 {
+		t.Fatalf("order = %s, line %+v", order.Status, order.Items[0])
+	}
+
+	page, err := app.Models.Orders.Find(context.Background(), data.OrderFilter{Status: data.StatusBackordered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Orders) != 1 || page.Orders[0].BackorderOf != id || page.Orders[0].Items[0].Quantity != 2 {
+		t.Fatalf("backorders = %+v", page.Orders)
+	}
+
+	// with nothing in stock the backorder keeps waiting
+	backorder := page.Orders[0].ID
+	status, resp = post(t, h, "/order/"+backorder+"/allocate", `{"backorder":true}`, nil)
+	if status != http.StatusOK || resp.Message != "order backordered" {
+		t.Errorf("allocating the backorder: %d %s", status, resp.Message)
+	}
+}
+
+func TestAllocateOrderUndoesUnrecordedAllocation(t *testing.T) {
+	app, inventory := newTestApp(t)
+	h := app.routes()
+	id := placeOrder(t, h, 3)
+
+	// the attempt is claimed, but the allocation can't be recorded
+	app.Models.Orders = &flakyOrders{OrderRepository: app.Models.Orders, ok: 1}
+
+	if status, _ := post(t, h, "/order/"+id+"/allocate", `{}`, nil); status < http.StatusInternalServerError {
+		t.Fatalf("allocating: %d, want a failure", status)
+	}
+
+	want := internalKeyPrefix + "order/" + id + "/allocate/1/undo"
+	if keys := inventory.keys("/inventory/release"); len(keys) != 1 || keys[0] != want {
+		t.Errorf("release keys = %q, want [%q]", keys, want)
+	}
+
+	order := getOrder(t, app, id)
+	if order.Status != data.StatusPending || order.Items[0].Allocated != 0 {
+		t.Errorf("order = %s, line %+v, want pending with nothing allocated", order.Status, order.Items[0])
+	}
+}
+
+func TestPickList(t *testing.T) {
+	tests := []struct {
+		name      string
+		confirm   string
+		status    string
+		picked    int
+		cancelled int
+	}{
+		{"full pick", `{"lines":[]}`, data.StatusPicked, 3, 0},
+		{"short pick", `{"lines":[{"order_id":"%s","line":0,"picked":1}]}`, data.StatusPicked, 1, 2},
+		{"nothing found", `{"lines":[{"order_id":"%s","line":0,"picked":0}]}`, data.StatusCancelled, 0, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, inventory := newTestApp(t)
+			h := app.routes()
+			id := placeOrder(t, h, 3)
+
+			if status, resp := post(t, h, "/order/"+id+"/allocate", `{}`, nil); status != http.StatusOK {
+				t.Fatalf("allocating: %d %s", status, resp.Message)
+			}
+
+			status, resp := post(t, h, "/picklists", `{"order_ids":["`+id+`"]}`, nil)
+			if status != http.StatusCreated {
+				t.Fatalf("creating the pick list: %d %s", status, resp.Message)
+			}
+			list := resp.Data.(map[string]any)["id"].(string)
+
+			if order := getOrder(t, app, id); order.Status != data.StatusPicking || order.PickListID != list {
+				t.Fatalf("order = %s on list %q, want picking on %q", order.Status, order.PickListID, list)
+			}
+
+			// the order is on a list already
+			if status, _ := post(t, h, "/picklists", `{"order_ids":["`+id+`"]}`, nil); status != http.StatusConflict {
+				t.Errorf("listing the order twice: %d, want %d", status, http.StatusConflict)
+			}
+
+			confirm := tt.confirm
+			if tt.cancelled > 0 {
+				confirm = fmt.Sprintf(confirm, id)
+			}
+			status, resp = post(t, h, "/picklists/"+list+"/confirm", confirm, nil)
+			if status != http.StatusOK {
+				t.Fatalf("confirming: %d %s", status, resp.Message)
+			}
+			if got := resp.Data.(map[string]any)["status"]; got != data.PickListCompleted {
+				t.Errorf("pick list is %v, want %s", got, data.PickListCompleted)
+			}
+
+			order := getOrder(t, app, id)
+			if order.Status != tt.status || order.Items[0].Picked != tt.picked || order.Items[0].CancelledQuantity != tt.cancelled {
+				t.Errorf("order = %s, line %+v", order.Status, order.Items[0])
+			}
+
+			want := internalKeyPrefix + "picklist/" + list + "/order/" + id
+			if keys := inventory.keys("/inventory/pick"); len(keys) != 1 || keys[0] != want {
+				t.Errorf("pick keys = %q, want [%q]", keys, want)
+			}
+
+			// short picked units went with the pick, there is nothing to release
+			if releases := inventory.keys("/inventory/release"); len(releases) != 0 {
+				t.Errorf("released %q", releases)
+			}
+		})
+	}
+}
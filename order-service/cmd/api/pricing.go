@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"order-service/data"
+	"time"
+)
+
+// QuoteOrder prices the order in the body as it would be placed now, without placing it.
+// An order quoted for a customer is taxed where it would be shipped.
+func (app *Config) QuoteOrder(w http.ResponseWriter, r *http.Request) {
+	var requestPayload JSONPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	entry := data.OrderEntry{
+		ClientID:       requestPayload.ClientID,
+		Items:          requestPayload.Items,
+		Destination:    requestPayload.Destination,
+		PromotionCodes: requestPayload.PromotionCodes,
+	}
+
+	if entry.ClientID != 0 {
+		if err := app.orderCustomer(r.Context(), &entry, requestPayload.ShippingAddressID, requestPayload.BillingAddressID); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+	}
+
+	if err := app.priceOrder(r, &entry); err != nil {
+		app.errorJSON(w, r, err, pricingErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "order priced",
+		Data:    entry.Pricing,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// priceOrder takes the name, price and category of every line from the catalog, whatever
+// the client sent, then applies the promotions and tax rules and sets the total
+func (app *Config) priceOrder(r *http.Request, entry *data.OrderEntry) error {
+	products, err := app.catalog(r, entry.Items)
+	if err != nil {
+		return err
+	}
+
+	for i, item := range entry.Items {
+		product := products[item.ProductID]
+		entry.Items[i].ProductName = product.Name
+		entry.Items[i].ProductPrice = product.Price
+		entry.Items[i].Category = product.Category
+	}
+
+	breakdown, err := app.Pricing.Price(entry.PricingOrder(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	entry.Priced(breakdown)
+
+	return nil
+}
+
+// errCatalog is reported when the inventory service couldn't be asked for the products
+var errCatalog = errors.New("the inventory service failed to look up the products")
+
+// pricingErrorStatus picks the status an order that couldn't be priced is reported with
+func pricingErrorStatus(err error) int {
+	if errors.Is(err, errCatalog) {
+		return http.StatusBadGateway
+	}
+
+	return http.StatusUnprocessableEntity
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"order-service/data"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetOrder returns the order with the id in the path
+func (app *Config) GetOrder(w http.ResponseWriter, r *http.Request) {
+	order, err := app.Models.Orders.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "order found",
+		Data:    order,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// SearchOrders returns a page of the orders matching the client_id, status, from and to
+// query parameters
+func (app *Config) SearchOrders(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.findOrders(w, r, filter)
+}
+
+// ClientOrders returns a page of the orders of the client with the id in the path
+func (app *Config) ClientOrders(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "clientID"), 10, 32)
+	if err != nil || clientID < 1 {
+		app.errorJSON(w, r, errors.New("client id must be a positive integer"))
+		return
+	}
+
+	filter, err := parseOrderFilter(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	filter.ClientID = int32(clientID)
+
+	app.findOrders(w, r, filter)
+}
+
+func (app *Config) findOrders(w http.ResponseWriter, r *http.Request, filter data.OrderFilter) {
+	page, err := app.Models.Orders.Find(r.Context(), filter)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d orders found", page.Total),
+		Data:    page,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// parseOrderFilter reads a search from query parameters. from and to are RFC 3339 times or
+// plain dates; to is exclusive, except that a plain to date includes the whole day.
+func parseOrderFilter(q url.Values) (data.OrderFilter, error) {
+	var filter data.OrderFilter
+
+	if v := q.Get("client_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || id < 1 {
+			return filter, errors.New("client_id must be a positive integer")
+		}
+		filter.ClientID = int32(id)
+	}
+
+	filter.Status = q.Get("status")
+
+	var err error
+	if filter.From, err = parseDate(q.Get("from"), false); err != nil {
+		return filter, fmt.Errorf("from: %w", err)
+	}
+	if filter.To, err = parseDate(q.Get("to"), true); err != nil {
+		return filter, fmt.Errorf("to: %w", err)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, errors.New("from must be before to")
+	}
+
+	for name, dst := range map[string]*int{"page": &filter.Page, "page_size": &filter.PageSize} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return filter, fmt.Errorf("%s must be a positive integer", name)
+		}
+		*dst = n
+	}
+
+	if filter.PageSize > data.MaxPageSize {
+		return filter, fmt.Errorf("page_size must not be more than %d", data.MaxPageSize)
+	}
+
+	return filter, nil
+}
+
+// parseDate parses an RFC 3339 time or a plain date. With endOfDay set a plain date
+// stands for the start of the next day, so that it can be used as an exclusive bound.
+func parseDate(v string, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, errors.New("must be an RFC 3339 time or a date like 2006-01-02")
+	}
+
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"order-service/data"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type ReturnPayload struct {
+	Reason string                `json:"reason"`
+	Lines  []data.ReturnQuantity `json:"lines"`
+}
+
+type ReceivePayload struct {
+	Lines []data.ReturnQuantity `json:"lines"`
+}
+
+type InspectPayload struct {
+	Lines []data.Inspection `json:"lines"`
+}
+
+// errRestockPending is reported when a return was inspected but the inventory service
+// couldn't take the restocked units back; inspecting again retries the restock
+var errRestockPending = errors.New("the return is inspected but restocking its units failed, inspect it again to retry")
+
+// CreateReturn authorizes the return of units of the order with the id in the path
+func (app *Config) CreateReturn(w http.ResponseWriter, r *http.Request) {
+	var requestPayload ReturnPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	order, err := app.Models.Orders.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	others, err := app.Models.Returns.ByOrder(r.Context(), order.ID)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	entry, err := data.NewReturn(order, others, requestPayload.Reason, requestPayload.Lines, time.Now())
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+	entry.RequestID = middleware.GetReqID(r.Context())
+
+	entry.ID, err = app.Models.Returns.Insert(r.Context(), entry)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	returnsAuthorized.Inc()
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "return authorized",
+		Data:    entry,
+	}
+
+	app.writeJSON(w, http.StatusCreated, resp)
+}
+
+// OrderReturns lists the returns of the order with the id in the path, oldest first
+func (app *Config) OrderReturns(w http.ResponseWriter, r *http.Request) {
+	returns, err := app.Models.Returns.ByOrder(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "returns found",
+		Data:    returns,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// GetReturn returns the return with the id in the path
+func (app *Config) GetReturn(w http.ResponseWriter, r *http.Request) {
+	entry, err := app.Models.Returns.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "return found",
+		Data:    entry,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// ReceiveReturn records the units of the return that arrived at the warehouse
+func (app *Config) ReceiveReturn(w http.ResponseWriter, r *http.Request) {
+	var requestPayload ReceivePayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	entry, err := app.Models.Returns.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	if err := entry.Receive(requestPayload.Lines, time.Now()); err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	if err := app.Models.Returns.Update(r.Context(), *entry); err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	app.writeReturn(w, r, entry.ID, "return received")
+}
+
+// InspectReturn records the outcome for every received unit, works out the refund and
+// adds the restocked units back to the inventory. A return that is already inspected but
+// whose units weren't restocked yet only has the restock retried.
+func (app *Config) InspectReturn(w http.ResponseWriter, r *http.Request) {
+	var requestPayload InspectPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	entry, err := app.Models.Returns.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	if entry.Status != data.ReturnInspected || entry.StockReturned {
+		policy := data.RefundPolicy{Refurbish: app.Settings.RefundRefurbish, Scrap: app.Settings.RefundScrap}
+
+		if err := entry.Inspect(requestPayload.Lines, policy, time.Now()); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+
+		if err := app.Models.Returns.Update(r.Context(), *entry); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+
+		refundValue.Add(float64(entry.RefundAmount))
+
+		entry, err = app.Models.Returns.GetOne(r.Context(), entry.ID)
+		if err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+	}
+
+	if !entry.StockReturned {
+		var lines []stockReleaseLine
+		for _, line := range entry.Restocked() {
+			lines = append(lines, stockReleaseLine{ItemID: line.ProductID, Quantity: line.Restocked, Restock: true})
+		}
+
+		if err := app.releaseStock(r, "return/"+entry.ID+"/restock", entry.OrderID, lines); err != nil {
+			requestLogger(r).Error("restocking returned units", "return_id", entry.ID, "error", err)
+			app.errorJSON(w, r, fmt.Errorf("%w: %v", errRestockPending, err), http.StatusBadGateway)
+			return
+		}
+
+		// the inventory only remembers its answer for a while, so the return itself has to
+		// say the units are back, or a late retry would restock them a second time
+		if err := app.recordStockReturned(r, entry.ID); err != nil {
+			requestLogger(r).Error("recording restocked units", "return_id", entry.ID, "error", err)
+		}
+	}
+
+	app.writeReturn(w, r, entry.ID, "return inspected")
+}
+
+// recordStockReturned marks the units of a return as restocked, reading the return again
+// for as long as other requests change it first
+func (app *Config) recordStockReturned(r *http.Request, id string) error {
+	r, cancel := app.compensating(r)
+	defer cancel()
+
+	for {
+		entry, err := app.Models.Returns.GetOne(r.Context(), id)
+		if err != nil {
+			return err
+		}
+
+		entry.StockReturned = true
+
+		err = app.Models.Returns.Update(r.Context(), *entry)
+		if !errors.Is(err, data.ErrConflict) {
+			return err
+		}
+	}
+}
+
+// writeReturn answers with the return as it is stored now
+func (app *Config) writeReturn(w http.ResponseWriter, r *http.Request, id, message string) {
+	entry, err := app.Models.Returns.GetOne(r.Context(), id)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    entry,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
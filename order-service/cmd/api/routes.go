@@ -6,6 +6,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func (app *Config) routes() http.Handler {
@@ -15,15 +16,99 @@ func (app *Config) routes() http.Handler {
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"https://*", "http://*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders: []string{"Link"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key", "X-Request-ID", "X-Request-Timeout", "X-User-ID"},
+		ExposedHeaders: []string{"Link", "Idempotent-Replayed", "X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge: 300,
 	}))
 
 	mux.Use(middleware.Heartbeat("/ping"))
 
-	mux.Post("/order", app.WriteOrder)
+	// continue the caller's trace, or start a new one
+	mux.Use(traceRequests("order-service"))
+	mux.Use(nameSpan)
+
+	// accept the caller's X-Request-ID or assign one, and log every request with it
+	mux.Use(middleware.RequestID)
+	mux.Use(echoRequestID)
+	mux.Use(accessLog)
+	mux.Use(instrument)
+
+	// stop working on requests the broker has already given up on
+	mux.Use(honourDeadline)
+
+	mux.Handle("/metrics", promhttp.Handler())
+
+	mux.Get("/health/live", app.Live)
+
+	mux.Get("/health/ready", app.Ready)
+
+	// orders sent with an Idempotency-Key are placed once, retries get the first response
+	mux.With(app.idempotent).Post("/order", app.WriteOrder)
+
+	mux.Post("/order/quote", app.QuoteOrder)
+
+	mux.Get("/order/{id}", app.GetOrder)
+
+	mux.With(app.idempotent).Post("/order/{id}/cancel", app.CancelOrder)
+
+	mux.With(app.idempotent).Post("/order/{id}/lines/{line}/cancel", app.CancelLine)
+
+	mux.With(app.idempotent).Post("/order/{id}/allocate", app.AllocateOrder)
+
+	mux.Get("/backorders", app.Backorders)
+
+	mux.With(app.idempotent).Post("/backorders/allocate", app.AllocateBackorders)
+
+	mux.With(app.idempotent).Post("/order/{id}/shipments", app.CreateShipment)
+
+	mux.Get("/order/{id}/shipments", app.OrderShipments)
+
+	mux.Get("/shipments/{id}", app.GetShipment)
+
+	mux.With(app.idempotent).Post("/shipments/{id}/ship", app.ShipShipment)
+
+	mux.With(app.idempotent).Post("/shipments/{id}/track", app.TrackShipment)
+
+	mux.Get("/shipments/{id}/packages/{number}/label", app.ShipmentLabel)
+
+	mux.With(app.idempotent).Post("/order/{id}/invoice", app.CreateInvoice)
+
+	mux.Get("/order/{id}/invoice", app.OrderInvoice)
+
+	mux.Get("/invoices/{id}", app.GetInvoice)
+
+	mux.Get("/invoices/{id}/document", app.InvoiceDocument)
+
+	mux.With(app.idempotent).Post("/order/{id}/returns", app.CreateReturn)
+
+	mux.Get("/order/{id}/returns", app.OrderReturns)
+
+	mux.Get("/returns/{id}", app.GetReturn)
+
+	mux.With(app.idempotent).Post("/returns/{id}/receive", app.ReceiveReturn)
+
+	mux.With(app.idempotent).Post("/returns/{id}/inspect", app.InspectReturn)
+
+	mux.With(app.idempotent).Post("/picklists", app.CreatePickList)
+
+	mux.Get("/picklists/{id}", app.GetPickList)
+
+	mux.With(app.idempotent).Post("/picklists/{id}/confirm", app.ConfirmPickList)
+
+	mux.Get("/orders", app.SearchOrders)
+
+	mux.Get("/clients/{clientID}/orders", app.ClientOrders)
+
+	mux.With(app.idempotent).Post("/customers", app.CreateCustomer)
+
+	mux.Get("/customers", app.SearchCustomers)
+
+	mux.Get("/customers/{id}", app.GetCustomer)
+
+	mux.With(app.idempotent).Put("/customers/{id}", app.UpdateCustomer)
+
+	mux.Get("/customers/{id}/orders", app.CustomerOrders)
 
 	return mux
 }
\ No newline at end of file
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"order-service/carrier"
+	"order-service/data"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type PackPayload struct {
+	Packages []data.PackageSpec `json:"packages"`
+}
+
+// ShipPayload picks the carrier and its service; both fall back to the defaults
+type ShipPayload struct {
+	Carrier string `json:"carrier,omitempty"`
+	Service string `json:"service,omitempty"`
+}
+
+// LabelResponse is the label of one package. Label is base64 in json.
+type LabelResponse struct {
+	TrackingNumber string `json:"tracking_number"`
+	ContentType    string `json:"content_type"`
+	Label          []byte `json:"label"`
+}
+
+// errLabelPending is reported when some packages of a shipment couldn't be labelled;
+// shipping again books the rest
+var errLabelPending = errors.New("not every package of the shipment could be labelled, ship it again to retry")
+
+// CreateShipment packs every open unit of the picked order with the id in the path into
+// packages. Packing a packed order again voids its earlier shipment.
+func (app *Config) CreateShipment(w http.ResponseWriter, r *http.Request) {
+	var requestPayload PackPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	order, err := app.Models.Orders.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	earlier, err := app.Models.Shipments.ByOrder(r.Context(), order.ID)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	shipment, err := data.NewShipment(order, requestPayload.Packages, time.Now())
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+	shipment.RequestID = middleware.GetReqID(r.Context())
+
+	shipment.ID, err = app.Models.Shipments.Insert(r.Context(), shipment)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	for _, other := range earlier {
+		if other.Status != data.ShipmentPacked {
+			continue
+		}
+		other.Status = data.ShipmentVoided
+		if err := app.Models.Shipments.Update(r.Context(), *other); err != nil {
+			app.voidShipment(r, shipment.ID)
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+	}
+
+	if order.Status != data.StatusPacked {
+		order.Status = data.StatusPacked
+		if err := app.Models.Orders.Update(r.Context(), *order); err != nil {
+			app.voidShipment(r, shipment.ID)
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "order packed",
+		Data:    shipment,
+	}
+
+	app.writeJSON(w, http.StatusCreated, resp)
+}
+
+// OrderShipments lists the shipments of the order with the id in the path, oldest first
+func (app *Config) OrderShipments(w http.ResponseWriter, r *http.Request) {
+	shipments, err := app.Models.Shipments.ByOrder(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "shipments found",
+		Data:    shipments,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// GetShipment returns the shipment with the id in the path
+func (app *Config) GetShipment(w http.ResponseWriter, r *http.Request) {
+	app.writeShipment(w, r, chi.URLParam(r, "id"), "shipment found")
+}
+
+// ShipShipment books a carrier for every package of the shipment, stores their labels
+// and marks the shipment and its order as shipped. Packages that already have a label
+// keep it, so shipping again after a failure only books the rest.
+func (app *Config) ShipShipment(w http.ResponseWriter, r *http.Request) {
+	var requestPayload ShipPayload
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	shipment, err := app.Models.Shipments.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	if shipment.Status == data.ShipmentPacked {
+		order, err := app.Models.Orders.GetOne(r.Context(), shipment.OrderID)
+		if err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+
+		if order.Status != data.StatusPacked {
+			app.errorJSON(w, r, fmt.Errorf("%w: only packed orders can be shipped, the order is %s", data.ErrStatus, order.Status), http.StatusConflict)
+			return
+		}
+
+		if err := shipment.Matches(order); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+
+		// once a package has a label the shipment is booked with that carrier and service
+		if shipment.Booked() {
+			if (requestPayload.Carrier != "" && requestPayload.Carrier != shipment.Carrier) || (requestPayload.Service != "" && requestPayload.Service != shipment.Service) {
+				app.errorJSON(w, r, fmt.Errorf("%w: the shipment is already booked with %s %s", data.ErrInvalid, shipment.Carrier, shipment.Service), http.StatusUnprocessableEntity)
+				return
+			}
+		} else {
+			shipment.Carrier = requestPayload.Carrier
+			shipment.Service = requestPayload.Service
+		}
+
+		c, err := app.Carriers.Get(shipment.Carrier)
+		if err != nil {
+			app.errorJSON(w, r, err, carrierErrorStatus(err))
+			return
+		}
+		shipment.Carrier = c.Name()
+
+		failed := app.labelPackages(r, c, shipment)
+		if failed == nil {
+			if err := shipment.Ship(time.Now()); err != nil {
+				app.errorJSON(w, r, err, dataErrorStatus(err))
+				return
+			}
+		}
+
+		// labels that were made are kept even when others failed
+		if err := app.Models.Shipments.Update(r.Context(), *shipment); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+
+		if failed != nil {
+			requestLogger(r).Error("labelling packages", "shipment_id", shipment.ID, "carrier", shipment.Carrier, "error", failed)
+			status := carrierErrorStatus(failed)
+			if status == http.StatusBadGateway {
+				failed = fmt.Errorf("%w: %v", errLabelPending, failed)
+			}
+			app.errorJSON(w, r, failed, status)
+			return
+		}
+
+		shipmentsShipped.WithLabelValues(shipment.Carrier).Inc()
+	}
+
+	if shipment.Status == data.ShipmentVoided {
+		app.errorJSON(w, r, fmt.Errorf("%w: the shipment was voided", data.ErrStatus), http.StatusConflict)
+		return
+	}
+
+	// move the order on; shipping again after the order couldn't be updated ends up here
+	if err := app.advanceOrder(r, shipment.OrderID, data.StatusPacked, data.StatusShipped); err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	app.writeShipment(w, r, shipment.ID, "shipment shipped")
+}
+
+// TrackShipment asks the carrier where the packages of a shipped shipment are and records
+// the new events. Once every package is delivered, so are the shipment and its order.
+func (app *Config) TrackShipment(w http.ResponseWriter, r *http.Request) {
+	shipment, err := app.Models.Shipments.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	switch shipment.Status {
+	case data.ShipmentPacked, data.ShipmentVoided:
+		app.errorJSON(w, r, fmt.Errorf("%w: the shipment is %s, only shipped shipments can be tracked", data.ErrStatus, shipment.Status), http.StatusConflict)
+		return
+	case data.ShipmentShipped:
+		c, err := app.Carriers.Get(shipment.Carrier)
+		if err != nil {
+			app.errorJSON(w, r, err, carrierErrorStatus(err))
+			return
+		}
+
+		now := time.Now()
+		for _, pkg := range shipment.Packages {
+			events, err := c.Track(r.Context(), pkg.TrackingNumber)
+			if err != nil {
+				requestLogger(r).Error("tracking package", "shipment_id", shipment.ID, "tracking_number", pkg.TrackingNumber, "error", err)
+				app.errorJSON(w, r, err, carrierErrorStatus(err))
+				return
+			}
+
+			tracked := make([]data.TrackingEvent, 0, len(events))
+			delivered := false
+			for _, e := range events {
+				tracked = append(tracked, data.TrackingEvent{
+					TrackingNumber: pkg.TrackingNumber,
+					Code:           e.Code,
+					Description:    e.Description,
+					Location:       e.Location,
+					At:             e.At,
+				})
+				delivered = delivered || e.Code == carrier.EventDelivered
+			}
+
+			shipment.Track(pkg.TrackingNumber, tracked, delivered, now)
+		}
+
+		if err := app.Models.Shipments.Update(r.Context(), *shipment); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+	}
+
+	if shipment.Status == data.ShipmentDelivered {
+		if err := app.advanceOrder(r, shipment.OrderID, data.StatusShipped, data.StatusDelivered); err != nil {
+			app.errorJSON(w, r, err, dataErrorStatus(err))
+			return
+		}
+	}
+
+	app.writeShipment(w, r, shipment.ID, "shipment tracked")
+}
+
+// ShipmentLabel returns the label of the package with the number in the path
+func (app *Config) ShipmentLabel(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.Atoi(chi.URLParam(r, "number"))
+	if err != nil {
+		app.errorJSON(w, r, errors.New("number must be a number"))
+		return
+	}
+
+	shipment, err := app.Models.Shipments.GetOne(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	for _, pkg := range shipment.Packages {
+		if pkg.Number != number {
+			continue
+		}
+
+		if pkg.TrackingNumber == "" {
+			app.errorJSON(w, r, fmt.Errorf("%w: package %d has no label yet", data.ErrStatus, number), http.StatusConflict)
+			return
+		}
+
+		resp := jsonResponse{
+			Error:   false,
+			Message: "label found",
+			Data:    LabelResponse{TrackingNumber: pkg.TrackingNumber, ContentType: pkg.LabelType, Label: pkg.Label},
+		}
+
+		app.writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	app.errorJSON(w, r, fmt.Errorf("the shipment has no package %d", number), http.StatusNotFound)
+}
+
+// labelPackages books the carrier for every package without a label and stops at the
+// first failure
+func (app *Config) labelPackages(r *http.Request, c carrier.Carrier, shipment *data.ShipmentEntry) error {
+	for i := range shipment.Packages {
+		pkg := &shipment.Packages[i]
+		if pkg.TrackingNumber != "" {
+			continue
+		}
+
+		label, err := c.Label(r.Context(), carrier.Parcel{
+			Reference: fmt.Sprintf("%s/%d", shipment.ID, pkg.Number),
+			Service:   shipment.Service,
+			WeightKg:  pkg.WeightKg,
+			LengthCm:  pkg.LengthCm,
+			WidthCm:   pkg.WidthCm,
+			HeightCm:  pkg.HeightCm,
+		})
+		if err != nil {
+			return err
+		}
+
+		pkg.TrackingNumber = label.TrackingNumber
+		pkg.LabelType = label.ContentType
+		pkg.Label = label.Data
+	}
+
+	return nil
+}
+
+// advanceOrder moves an order from one status to the next. An order that is already past
+// from is left alone, so that retries don't fail.
+func (app *Config) advanceOrder(r *http.Request, id, from, to string) error {
+	order, err := app.Models.Orders.GetOne(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	if order.Status != from {
+		return nil
+	}
+
+	order.Status = to
+
+	return app.Models.Orders.Update(r.Context(), *order)
+}
+
+// voidShipment voids a shipment that was packed for an order that couldn't be updated
+func (app *Config) voidShipment(r *http.Request, id string) {
+	shipment, err := app.Models.Shipments.GetOne(r.Context(), id)
+	if err == nil {
+		shipment.Status = data.ShipmentVoided
+		err = app.Models.Shipments.Update(r.Context(), *shipment)
+	}
+	if err != nil {
+		requestLogger(r).Error("voiding shipment", "shipment_id", id, "error", err)
+	}
+}
+
+// writeShipment answers with the shipment as it is stored now
+func (app *Config) writeShipment(w http.ResponseWriter, r *http.Request, id, message string) {
+	shipment, err := app.Models.Shipments.GetOne(r.Context(), id)
+	if err != nil {
+		app.errorJSON(w, r, err, dataErrorStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    shipment,
+	}
+
+	app.writeJSON(w, http.StatusOK, resp)
+}
+
+// carrierErrorStatus picks the status a carrier error is reported with: asking for a
+// carrier or service that doesn't exist is the caller's mistake, anything else the
+// carrier's
+func carrierErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, carrier.ErrUnknownCarrier), errors.Is(err, carrier.ErrUnknownService):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
@@ -0,0 +1,146 @@
+// Package config holds the settings of the order service
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"order-service/pricing"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	WebPort         int      `json:"web_port" env:"WEB_PORT"`
+	LogLevel        string   `json:"log_level" env:"LOG_LEVEL"`
+	Storage         string   `json:"storage" env:"STORAGE"`
+	MongoURL        string   `json:"mongo_url" env:"MONGO_URL" secret:"true"`
+	MongoUsername   string   `json:"mongo_username" env:"MONGO_USERNAME"`
+	MongoPassword   string   `json:"mongo_password" env:"MONGO_PASSWORD" secret:"true"`
+	MongoDatabase   string   `json:"mongo_database" env:"MONGO_DATABASE"`
+	MongoBootstrap  bool     `json:"mongo_bootstrap" env:"MONGO_BOOTSTRAP"`
+	IdempotencyTTL  Duration `json:"idempotency_ttl" env:"IDEMPOTENCY_TTL"`
+	InventoryURL    string   `json:"inventory_url" env:"INVENTORY_SERVICE_URL"`
+	UpstreamTimeout Duration `json:"upstream_timeout" env:"UPSTREAM_TIMEOUT"`
+	// RefundRefurbish and RefundScrap are the shares of the unit price refunded for
+	// returned units that are refurbished or scrapped
+	RefundRefurbish float64 `json:"refund_refurbish" env:"REFUND_REFURBISH"`
+	RefundScrap     float64 `json:"refund_scrap" env:"REFUND_SCRAP"`
+	// DefaultCarrier ships the shipments that don't name a carrier
+	DefaultCarrier string `json:"default_carrier" env:"DEFAULT_CARRIER"`
+	// LocalCarrierStep is how far apart the fake local carrier's tracking events are
+	LocalCarrierStep Duration `json:"local_carrier_step" env:"LOCAL_CARRIER_STEP"`
+	// InvoiceIssuer and Currency are printed on every invoice
+	InvoiceIssuer string `json:"invoice_issuer" env:"INVOICE_ISSUER"`
+	Currency      string `json:"currency" env:"CURRENCY"`
+	// TaxRate taxes the order lines no tax rule matches. TaxRules and Promotions are
+	// JSON arrays in the environment.
+	TaxRate         float64             `json:"tax_rate" env:"TAX_RATE"`
+	TaxRules        []pricing.TaxRule   `json:"tax_rules" env:"TAX_RULES"`
+	Promotions      []pricing.Promotion `json:"promotions" env:"PROMOTIONS"`
+	ShutdownTimeout Duration            `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// DrainDelay is how long a stopping service keeps serving after its readiness check
+	// starts failing, so that load balancers stop sending it requests first
+	DrainDelay Duration `json:"drain_delay" env:"DRAIN_DELAY"`
+}
+
+func defaults() *Config {
+	return &Config{
+		WebPort:          80,
+		LogLevel:         "info",
+		Storage:          "mongo",
+		MongoURL:         "mongodb://mongo:27017",
+		MongoDatabase:    "warehouse",
+		MongoBootstrap:   true,
+		IdempotencyTTL:   Duration(24 * time.Hour),
+		InventoryURL:     "http://inventory-service",
+		UpstreamTimeout:  Duration(10 * time.Second),
+		RefundRefurbish:  0.8,
+		RefundScrap:      0,
+		DefaultCarrier:   "local",
+		LocalCarrierStep: Duration(time.Hour),
+		InvoiceIssuer:    "Go Warehouse",
+		Currency:         "EUR",
+		TaxRate:          0.2,
+		ShutdownTimeout:  Duration(20 * time.Second),
+		DrainDelay:       Duration(5 * time.Second),
+	}
+}
+
+// Validate reports every setting that is out of range, not just the first
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.WebPort < 1 || c.WebPort > 65535 {
+		errs = append(errs, fmt.Errorf("web_port %d is not a valid port", c.WebPort))
+	}
+
+	switch c.Storage {
+	case "memory":
+		// nothing else to check, mongo isn't used
+	case "mongo":
+		if !strings.HasPrefix(c.MongoURL, "mongodb://") && !strings.HasPrefix(c.MongoURL, "mongodb+srv://") {
+			errs = append(errs, errors.New("mongo_url must be a mongodb:// or mongodb+srv:// url"))
+		}
+
+		if c.MongoUsername != "" && c.MongoPassword == "" {
+			errs = append(errs, errors.New("mongo_password is required when mongo_username is set"))
+		}
+
+		if c.MongoDatabase == "" {
+			errs = append(errs, errors.New("mongo_database is required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage %q must be mongo or memory", c.Storage))
+	}
+
+	if c.IdempotencyTTL <= 0 {
+		errs = append(errs, errors.New("idempotency_ttl must be positive"))
+	}
+
+	if parsed, err := url.Parse(c.InventoryURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		errs = append(errs, fmt.Errorf("inventory_url %q is not an absolute url", c.InventoryURL))
+	}
+
+	if c.UpstreamTimeout <= 0 {
+		errs = append(errs, errors.New("upstream_timeout must be positive"))
+	}
+
+	if c.RefundRefurbish < 0 || c.RefundRefurbish > 1 {
+		errs = append(errs, errors.New("refund_refurbish must be between 0 and 1"))
+	}
+
+	if c.RefundScrap < 0 || c.RefundScrap > 1 {
+		errs = append(errs, errors.New("refund_scrap must be between 0 and 1"))
+	}
+
+	if c.DefaultCarrier == "" {
+		errs = append(errs, errors.New("default_carrier is required"))
+	}
+
+	if c.LocalCarrierStep <= 0 {
+		errs = append(errs, errors.New("local_carrier_step must be positive"))
+	}
+
+	if c.InvoiceIssuer == "" {
+		errs = append(errs, errors.New("invoice_issuer is required"))
+	}
+
+	if len(c.Currency) != 3 || strings.ToUpper(c.Currency) != c.Currency {
+		errs = append(errs, fmt.Errorf("currency %q must be a three letter ISO 4217 code", c.Currency))
+	}
+
+	if c.TaxRate < 0 || c.TaxRate > 1 {
+		errs = append(errs, errors.New("tax_rate must be between 0 and 1"))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+
+	if c.DrainDelay < 0 {
+		errs = append(errs, errors.New("drain_delay must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redacted replaces the value of secret fields when the configuration is printed
+const redacted = "*****"
+
+// Load builds the configuration from, in increasing order of precedence, the defaults,
+// the JSON file named by CONFIG_FILE, environment variables, and files named by
+// <VAR>_FILE, which is how Docker secrets mounted under /run/secrets are passed in.
+// The result is validated before it is returned.
+func Load() (*Config, error) {
+	cfg := defaults()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := json.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Redacted returns the configuration as JSON with every secret blanked out, for printing
+func (c Config) Redacted() string {
+	v := reflect.ValueOf(&c).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("secret") == "true" && v.Field(i).Kind() == reflect.String && v.Field(i).String() != "" {
+			v.Field(i).SetString(redacted)
+		}
+	}
+
+	out, _ := json.MarshalIndent(c, "", "  ")
+
+	return string(out)
+}
+
+// applyEnv overrides every field that has an env tag from the environment
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		raw, ok := os.LookupEnv(name)
+
+		if path, isFile := os.LookupEnv(name + "_FILE"); isFile {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("reading %s_FILE: %w", name, err)
+			}
+			raw, ok = strings.TrimSpace(string(b)), true
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := setField(v.Field(i), raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func setField(f reflect.Value, raw string) error {
+	if f.Type() == reflect.TypeOf(Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Slice:
+		// lists of settings are written as JSON arrays, as in the config file
+		if err := json.Unmarshal([]byte(raw), f.Addr().Interface()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported config field type %s", f.Type())
+	}
+
+	return nil
+}
+
+// Duration is a time.Duration written as "20s" or "1m30s" in config files and the environment
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"order-service/pricing"
+)
+
+// BackorderQueue is every backordered unit of one product, oldest order first
+type BackorderQueue struct {
+	ProductID   string          `json:"product_id"`
+	ProductName string          `json:"product_name"`
+	Units       int             `json:"units"`
+	Orders      []BackorderLine `json:"orders"`
+}
+
+// BackorderLine is one line of a backorder waiting for stock
+type BackorderLine struct {
+	OrderID     string    `json:"order_id"`
+	BackorderOf string    `json:"backorder_of,omitempty"`
+	ClientID    int32     `json:"client_id,omitempty"`
+	Line        int       `json:"line"`
+	Quantity    int       `json:"quantity"`
+	OrderDate   time.Time `json:"order_date"`
+}
+
+// NewOrderID returns the id of a new order
+func NewOrderID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// Backorder has the whole order wait for stock
+func (o *OrderEntry) Backorder() error {
+	if err := o.Allocatable(); err != nil {
+		return err
+	}
+
+	o.Status = StatusBackordered
+
+	return nil
+}
+
+// SplitBackorder takes short units off each of the order's lines and returns a backorder
+// with the given id that holds them. The backorder keeps the order's date, so it isn't
+// overtaken by orders placed later, and its lines keep the price their units were ordered
+// at.
+func (o *OrderEntry) SplitBackorder(id string, short []int) (OrderEntry, error) {
+	if err := o.Allocatable(); err != nil {
+		return OrderEntry{}, err
+	}
+
+	if len(short) != len(o.Items) {
+		return OrderEntry{}, fmt.Errorf("%w: the order has %d lines, %d were split", ErrInvalid, len(o.Items), len(short))
+	}
+
+	backorder := OrderEntry{
+		ID:              id,
+		ClientID:        o.ClientID,
+		OrderDate:       o.OrderDate,
+		Status:          StatusBackordered,
+		Destination:     o.Destination,
+		ShippingAddress: o.ShippingAddress,
+		BillingAddress:  o.BillingAddress,
+		RequestID:       o.RequestID,
+		BackorderOf:     o.ID,
+	}
+
+	var prices []pricing.LinePrice
+	for i, units := range short {
+		if units == 0 {
+			continue
+		}
+
+		item := o.Items[i]
+		if units < 0 || units > item.Open() {
+			return OrderEntry{}, fmt.Errorf("%w: line %d has %d open units, can't backorder %d", ErrInvalid, i, item.Open(), units)
+		}
+
+		price := o.LinePrice(i, units, 0)
+		price.Line = len(backorder.Items)
+		prices = append(prices, price)
+
+		backorder.Items = append(backorder.Items, OrderItem{
+			ProductID:    item.ProductID,
+			ProductName:  item.ProductName,
+			ProductPrice: item.ProductPrice,
+			Quantity:     units,
+			Category:     item.Category,
+		})
+	}
+
+	if len(backorder.Items) == 0 {
+		return OrderEntry{}, fmt.Errorf("%w: no units to backorder", ErrInvalid)
+	}
+
+	if o.Pricing != nil {
+		var breakdown pricing.Breakdown
+		for _, price := range prices {
+			breakdown.Lines = append(breakdown.Lines, price)
+			breakdown.Subtotal += price.Subtotal
+			breakdown.Discount += price.Discount
+			breakdown.Net += price.Net
+			breakdown.Tax += price.Tax
+		}
+		breakdown.Subtotal = cents(float64(breakdown.Subtotal))
+		breakdown.Discount = cents(float64(breakdown.Discount))
+		breakdown.Net = cents(float64(breakdown.Net))
+		breakdown.Tax = cents(float64(breakdown.Tax))
+		breakdown.Total = cents(float64(breakdown.Net + breakdown.Tax))
+		backorder.Pricing = &breakdown
+	}
+	backorder.Recalculate()
+
+	for i, units := range short {
+		o.Items[i].Backordered += units
+	}
+	o.Backorders = append(o.Backorders, id)
+	o.Recalculate()
+
+	return backorder, nil
+}
+
+// BackorderQueues gathers the open units of backordered orders by product, or only of the
+// given product when productID isn't empty. Orders come oldest first and keep that order
+// in each queue.
+func BackorderQueues(orders []*OrderEntry, productID string) []BackorderQueue {
+	byProduct := make(map[string]*BackorderQueue)
+
+	for _, order := range orders {
+		if order.Status != StatusBackordered {
+			continue
+		}
+
+		for i, item := range order.Items {
+			if item.Open() == 0 || (productID != "" && item.ProductID != productID) {
+				continue
+			}
+
+			queue, ok := byProduct[item.ProductID]
+			if !ok {
+				queue = &BackorderQueue{ProductID: item.ProductID, ProductName: item.ProductName}
+				byProduct[item.ProductID] = queue
+			}
+
+			queue.Units += item.Open()
+			queue.Orders = append(queue.Orders, BackorderLine{
+				OrderID:     order.ID,
+				BackorderOf: order.BackorderOf,
+				ClientID:    order.ClientID,
+				Line:        i,
+				Quantity:    item.Open(),
+				OrderDate:   order.OrderDate,
+			})
+		}
+	}
+
+	queues := make([]BackorderQueue, 0, len(byProduct))
+	for _, queue := range byProduct {
+		queues = append(queues, *queue)
+	}
+
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].ProductID < queues[j].ProductID
+	})
+
+	return queues
+}
+
+// hasProduct reports whether the order has a line of the product
+func (o *OrderEntry) hasProduct(productID string) bool {
+	for _, item := range o.Items {
+		if item.ProductID == productID {
+			return true
+		}
+	}
+
+	return false
+}
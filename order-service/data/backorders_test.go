@@ -0,0 +1,163 @@
+package data
+
+import (
+	"errors"
+	"order-service/pricing"
+	"testing"
+	"time"
+)
+
+var backorderTime = time.Date(2026, 2, 20, 9, 0, 0, 0, time.UTC)
+
+func pendingOrder() *OrderEntry {
+	order := &OrderEntry{
+		ID:              "o1",
+		ClientID:        1,
+		OrderDate:       backorderTime,
+		Status:          StatusPending,
+		ShippingAddress: &Address{Line1: "1 Main St", City: "Lyon", Country: "FR"},
+		Items: []OrderItem{
+			{ProductID: "a", ProductName: "Notebook", ProductPrice: 10, Quantity: 4, Category: "paper"},
+			{ProductID: "b", ProductName: "Monitor", ProductPrice: 100, Quantity: 2, CancelledQuantity: 1},
+		},
+	}
+	order.Recalculate()
+
+	return order
+}
+
+func TestSplitBackorder(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		short  []int
+		want   error
+		lines  []OrderItem
+		left   []int
+	}{
+		{"one line", StatusPending, []int{3, 0}, nil,
+			[]OrderItem{{ProductID: "a", ProductName: "Notebook", ProductPrice: 10, Quantity: 3, Category: "paper"}}, []int{1, 1}},
+		{"every open unit", StatusPending, []int{4, 1}, nil,
+			[]OrderItem{{ProductID: "a", ProductName: "Notebook", ProductPrice: 10, Quantity: 4, Category: "paper"}, {ProductID: "b", ProductName: "Monitor", ProductPrice: 100, Quantity: 1}}, []int{0, 0}},
+		{"a backorder split again", StatusBackordered, []int{1, 0}, nil,
+			[]OrderItem{{ProductID: "a", ProductName: "Notebook", ProductPrice: 10, Quantity: 1, Category: "paper"}}, []int{3, 1}},
+		{"an allocated order", StatusAllocated, []int{1, 0}, ErrStatus, nil, nil},
+		{"nothing short", StatusPending, []int{0, 0}, ErrInvalid, nil, nil},
+		{"a line missing", StatusPending, []int{1}, ErrInvalid, nil, nil},
+		{"more than is open", StatusPending, []int{0, 2}, ErrInvalid, nil, nil},
+		{"negative", StatusPending, []int{-1, 1}, ErrInvalid, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := pendingOrder()
+			order.Status = tt.status
+
+			backorder, err := order.SplitBackorder("b1", tt.short)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				if order.Items[0].Backordered != 0 || order.Items[1].Backordered != 0 || len(order.Backorders) != 0 {
+					t.Errorf("a refused split changed the order: %+v", order)
+				}
+				return
+			}
+
+			if backorder.ID != "b1" || backorder.BackorderOf != order.ID || backorder.Status != StatusBackordered ||
+				!backorder.OrderDate.Equal(backorderTime) || backorder.ShippingAddress != order.ShippingAddress {
+				t.Errorf("backorder = %+v", backorder)
+			}
+			if len(backorder.Items) != len(tt.lines) {
+				t.Fatalf("backorder lines %+v, want %+v", backorder.Items, tt.lines)
+			}
+			for i, want := range tt.lines {
+				if backorder.Items[i] != want {
+					t.Errorf("backorder line %d = %+v, want %+v", i, backorder.Items[i], want)
+				}
+			}
+
+			for i, want := range tt.left {
+				if open := order.Items[i].Open(); open != want {
+					t.Errorf("line %d has %d open units, want %d", i, open, want)
+				}
+			}
+			if len(order.Backorders) != 1 || order.Backorders[0] != "b1" {
+				t.Errorf("the order lists backorders %v", order.Backorders)
+			}
+			// the units only moved
+			if total := order.TotalPrice + backorder.TotalPrice; total != 140 {
+				t.Errorf("totals add up to %v, want 140", total)
+			}
+		})
+	}
+}
+
+func TestSplitBackorderKeepsPrices(t *testing.T) {
+	order := pendingOrder()
+	order.Pricing = &pricing.Breakdown{Lines: []pricing.LinePrice{
+		{Line: 0, Quantity: 4, Subtotal: 40, Discount: 10, Net: 30, TaxRate: 0.2, Tax: 6, Total: 36},
+		{Line: 1, Quantity: 2, Subtotal: 200, Net: 200, TaxRate: 0.1, Tax: 20, Total: 220},
+	}}
+	order.Recalculate()
+
+	backorder, err := order.SplitBackorder("b1", []int{3, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if backorder.Pricing == nil || len(backorder.Pricing.Lines) != 2 {
+		t.Fatalf("backorder pricing = %+v", backorder.Pricing)
+	}
+	want := []pricing.LinePrice{
+		{Line: 0, Quantity: 3, Subtotal: 30, Discount: 7.5, Net: 22.5, TaxRate: 0.2, Tax: 4.5, Total: 27},
+		{Line: 1, Quantity: 1, Subtotal: 100, Net: 100, TaxRate: 0.1, Tax: 10, Total: 110},
+	}
+	for i, line := range backorder.Pricing.Lines {
+		if line != want[i] {
+			t.Errorf("backorder line %d price = %+v, want %+v", i, line, want[i])
+		}
+	}
+
+	p := backorder.Pricing
+	if p.Subtotal != 130 || p.Discount != 7.5 || p.Net != 122.5 || p.Tax != 14.5 || p.Total != 137 || backorder.TotalPrice != 137 {
+		t.Errorf("backorder totals = %+v, total price %v", p, backorder.TotalPrice)
+	}
+	// what is left of the order keeps its share of the discount
+	if order.TotalPrice != 9 {
+		t.Errorf("order total = %v, want 9", order.TotalPrice)
+	}
+}
+
+func TestBackorderQueues(t *testing.T) {
+	waiting := func(id string, day int, items ...OrderItem) *OrderEntry {
+		return &OrderEntry{ID: id, Status: StatusBackordered, OrderDate: backorderTime.AddDate(0, 0, day), Items: items}
+	}
+
+	orders := []*OrderEntry{
+		waiting("o1", 0, OrderItem{ProductID: "b", Quantity: 2}, OrderItem{ProductID: "a", Quantity: 1}),
+		waiting("o2", 1, OrderItem{ProductID: "a", Quantity: 3, CancelledQuantity: 1}),
+		waiting("o3", 2, OrderItem{ProductID: "a", Quantity: 1, CancelledQuantity: 1}),
+		{ID: "o4", Status: StatusPending, Items: []OrderItem{{ProductID: "a", Quantity: 5}}},
+	}
+
+	queues := BackorderQueues(orders, "")
+	if len(queues) != 2 || queues[0].ProductID != "a" || queues[1].ProductID != "b" {
+		t.Fatalf("queues = %+v", queues)
+	}
+
+	a := queues[0]
+	if a.Units != 3 || len(a.Orders) != 2 || a.Orders[0].OrderID != "o1" || a.Orders[0].Line != 1 || a.Orders[1].OrderID != "o2" || a.Orders[1].Quantity != 2 {
+		t.Errorf("queue of a = %+v", a)
+	}
+	if queues[1].Units != 2 {
+		t.Errorf("queue of b = %+v", queues[1])
+	}
+
+	if only := BackorderQueues(orders, "b"); len(only) != 1 || only[0].ProductID != "b" {
+		t.Errorf("queues of b = %+v", only)
+	}
+	if none := BackorderQueues(orders, "c"); len(none) != 0 {
+		t.Errorf("queues of c = %+v", none)
+	}
+}
@@ -0,0 +1,412 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares an index a collection must have
+type IndexSpec struct {
+	Name   string
+	Keys   bson.D
+	Unique bool
+	// Partial limits the index to the documents matching the filter
+	Partial bson.D
+	// TTL has mongo delete documents once the date in the indexed field has passed
+	TTL bool
+}
+
+// CollectionSpec declares a collection with the validator and indexes it must have
+type CollectionSpec struct {
+	Name      string
+	Validator bson.M
+	Indexes   []IndexSpec
+}
+
+// Collections is everything the order service needs in mongo
+var Collections = []CollectionSpec{
+	{
+		Name: "orders",
+		Validator: bson.M{"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"required": bson.A{"order_date", "status", "items", "created_at"},
+			"properties": bson.M{
+				"client_id":   bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+				"order_date":  bson.M{"bsonType": "date"},
+				"status":      bson.M{"bsonType": "string", "maxLength": 32},
+				"total_price": bson.M{"bsonType": bson.A{"double", "int", "long", "decimal"}, "minimum": 0},
+				"items": bson.M{
+					"bsonType": "array",
+					"items": bson.M{
+						"bsonType": "object",
+						"required": bson.A{"product_id", "quantity"},
+						"properties": bson.M{
+							"product_id":         bson.M{"bsonType": "string", "minLength": 1},
+							"product_name":       bson.M{"bsonType": "string"},
+							"product_price":      bson.M{"bsonType": bson.A{"double", "int", "long", "decimal"}, "minimum": 0},
+							"quantity":           bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+							"cancelled_quantity": bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+							"category":           bson.M{"bsonType": "string"},
+							"backordered":        bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+						},
+					},
+				},
+				"destination": bson.M{
+					"bsonType": "object",
+					"properties": bson.M{
+						"country": bson.M{"bsonType": "string", "pattern": "^[A-Z]{2}$"},
+						"region":  bson.M{"bsonType": "string"},
+					},
+				},
+				"shipping_address":    bson.M{"bsonType": bson.A{"object", "null"}, "required": bson.A{"line1", "city", "country"}},
+				"billing_address":     bson.M{"bsonType": bson.A{"object", "null"}, "required": bson.A{"line1", "city", "country"}},
+				"pricing":             bson.M{"bsonType": bson.A{"object", "null"}, "required": bson.A{"lines", "total"}},
+				"allocation_attempts": bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+				"backorder_of":        bson.M{"bsonType": "string"},
+				"backorders":          bson.M{"bsonType": bson.A{"array", "null"}},
+				"cancel_reason":       bson.M{"bsonType": "string"},
+				"cancelled_at":        bson.M{"bsonType": bson.A{"date", "null"}},
+				"cancellations":       bson.M{"bsonType": bson.A{"array", "null"}},
+				"request_id":          bson.M{"bsonType": "string"},
+				"version":             bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+				"created_at":          bson.M{"bsonType": "date"},
+				"updated_at":          bson.M{"bsonType": "date"},
+			},
+		}},
+		Indexes: []IndexSpec{
+			{Name: "client_id_order_date", Keys: bson.D{{Key: "client_id", Value: 1}, {Key: "order_date", Value: -1}}},
+			{Name: "status", Keys: bson.D{{Key: "status", Value: 1}}},
+			{Name: "status_product", Keys: bson.D{{Key: "status", Value: 1}, {Key: "items.product_id", Value: 1}, {Key: "order_date", Value: 1}}},
+			{Name: "order_date", Keys: bson.D{{Key: "order_date", Value: -1}}},
+			{Name: "created_at", Keys: bson.D{{Key: "created_at", Value: -1}}},
+		},
+	},
+	{
+		Name: "returns",
+		Validator: bson.M{"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"required": bson.A{"order_id", "status", "lines", "created_at"},
+			"properties": bson.M{
+				"order_id":      bson.M{"bsonType": "string", "minLength": 1},
+				"status":        bson.M{"enum": bson.A{ReturnAuthorized, ReturnReceived, ReturnInspected}},
+				"reason":        bson.M{"bsonType": "string"},
+				"lines":         bson.M{"bsonType": "array", "minItems": 1},
+				"refund_amount": bson.M{"bsonType": bson.A{"double", "int", "long", "decimal"}, "minimum": 0},
+				"created_at":    bson.M{"bsonType": "date"},
+				"updated_at":    bson.M{"bsonType": "date"},
+			},
+		}},
+		Indexes: []IndexSpec{
+			{Name: "order_id", Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "created_at", Value: 1}}},
+			{Name: "status", Keys: bson.D{{Key: "status", Value: 1}}},
+		},
+	},
+	{
+		Name: "pick_lists",
+		Validator: bson.M{"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"required": bson.A{"status", "stops", "orders", "created_at"},
+			"properties": bson.M{
+				"status":     bson.M{"enum": bson.A{PickListOpen, PickListConfirmed, PickListCompleted}},
+				"stops":      bson.M{"bsonType": "array"},
+				"orders":     bson.M{"bsonType": "array", "minItems": 1},
+				"created_at": bson.M{"bsonType": "date"},
+				"updated_at": bson.M{"bsonType": "date"},
+			},
+		}},
+		Indexes: []IndexSpec{
+			{Name: "status", Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		},
+	},
+	{
+		Name: "shipments",
+		Validator: bson.M{"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"required": bson.A{"order_id", "status", "packages", "created_at"},
+			"properties": bson.M{
+				"order_id":   bson.M{"bsonType": "string", "minLength": 1},
+				"status":     bson.M{"enum": bson.A{ShipmentPacked, ShipmentShipped, ShipmentDelivered, ShipmentVoided}},
+				"packages":   bson.M{"bsonType": "array", "minItems": 1},
+				"carrier":    bson.M{"bsonType": "string"},
+				"created_at": bson.M{"bsonType": "date"},
+				"updated_at": bson.M{"bsonType": "date"},
+			},
+		}},
+		Indexes: []IndexSpec{
+			{Name: "order_id", Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "created_at", Value: 1}}},
+			{Name: "tracking_number", Keys: bson.D{{Key: "packages.tracking_number", Value: 1}}},
+			{Name: "status", Keys: bson.D{{Key: "status", Value: 1}}},
+		},
+	},
+	{
+		Name: "invoices",
+		Validator: bson.M{"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"required": bson.A{"number", "sequence", "order_id", "lines", "total", "issued_at"},
+			"properties": bson.M{
+				"number":    bson.M{"bsonType": "string", "pattern": "^" + InvoicePrefix + "[0-9]+$"},
+				"sequence":  bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+				"order_id":  bson.M{"bsonType": "string", "minLength": 1},
+				"lines":     bson.M{"bsonType": "array", "minItems": 1},
+				"total":     bson.M{"bsonType": bson.A{"double", "int", "long", "decimal"}, "minimum": 0},
+				"documents": bson.M{"bsonType": "array"},
+				"issued_at": bson.M{"bsonType": "date"},
+			},
+		}},
+		Indexes: []IndexSpec{
+			{Name: "sequence", Keys: bson.D{{Key: "sequence", Value: 1}}, Unique: true},
+			{Name: "order_id", Keys: bson.D{{Key: "order_id", Value: 1}}, Unique: true},
+		},
+	},
+	{
+		Name: "customers",
+		Validator: bson.M{"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"required": bson.A{"_id", "name", "email", "addresses", "created_at"},
+			"properties": bson.M{
+				"_id":        bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+				"name":       bson.M{"bsonType": "string", "minLength": 1, "maxLength": maxNameLength},
+				"email":      bson.M{"bsonType": "string", "minLength": 3},
+				"addresses":  bson.M{"bsonType": "array", "maxItems": maxAddresses},
+				"tax_ids":    bson.M{"bsonType": "array", "maxItems": maxTaxIDs},
+				"created_at": bson.M{"bsonType": "date"},
+				"updated_at": bson.M{"bsonType": "date"},
+			},
+		}},
+		Indexes: []IndexSpec{
+			{Name: "email", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+			{Name: "name", Keys: bson.D{{Key: "name", Value: 1}}},
+		},
+	},
+	idempotencyCollection,
+}
+
+// idempotencyCollection holds the responses replayed for retried writes until they expire
+var idempotencyCollection = CollectionSpec{
+	Name: "idempotency_keys",
+	Validator: bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"fingerprint", "status", "created_at", "expires_at"},
+		"properties": bson.M{
+			"fingerprint": bson.M{"bsonType": "string"},
+			"status":      bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+			"body":        bson.M{"bsonType": "binData"},
+			"created_at":  bson.M{"bsonType": "date"},
+			"expires_at":  bson.M{"bsonType": "date"},
+		},
+	}},
+	Indexes: []IndexSpec{
+		{Name: "expires_at_ttl", Keys: bson.D{{Key: "expires_at", Value: 1}}, TTL: true},
+	},
+}
+
+// IndexDrift lists how a collection's indexes differ from the declared ones
+type IndexDrift struct {
+	Collection string   `json:"collection"`
+	Missing    []string `json:"missing,omitempty"`
+	Changed    []string `json:"changed,omitempty"`
+	Unexpected []string `json:"unexpected,omitempty"`
+}
+
+// None reports whether the collection matches its declaration
+func (d IndexDrift) None() bool {
+	return len(d.Missing) == 0 && len(d.Changed) == 0 && len(d.Unexpected) == 0
+}
+
+// Bootstrap makes sure every declared collection exists with its validator and creates
+// the declared indexes that are missing. Indexes that exist with a different definition
+// or that aren't declared are never dropped; they are returned as drift for a human to
+// look at.
+func Bootstrap(ctx context.Context, db *mongo.Database) ([]IndexDrift, error) {
+	for _, spec := range Collections {
+		if err := bootstrapCollection(ctx, db, spec); err != nil {
+			return nil, err
+		}
+	}
+
+	return CheckIndexes(ctx, db)
+}
+
+// EnsureCollection bootstraps the one declared collection with the given name, for
+// collections the service can't work correctly without. Unlike Bootstrap it fails when
+// an index exists with a different definition, as that index may not enforce what the
+// declaration does.
+func EnsureCollection(ctx context.Context, db *mongo.Database, name string) error {
+	for _, spec := range Collections {
+		if spec.Name != name {
+			continue
+		}
+
+		if err := bootstrapCollection(ctx, db, spec); err != nil {
+			return err
+		}
+
+		drift, err := checkCollection(ctx, db.Collection(spec.Name), spec)
+		if err != nil {
+			return err
+		}
+		if len(drift.Missing) > 0 || len(drift.Changed) > 0 {
+			return fmt.Errorf("indexes of %s differ from their declaration: missing %v, changed %v", name, drift.Missing, drift.Changed)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("no collection %s is declared", name)
+}
+
+// bootstrapCollection applies the collection's validator and creates its missing indexes
+func bootstrapCollection(ctx context.Context, db *mongo.Database, spec CollectionSpec) error {
+	if err := applyValidator(ctx, db, spec); err != nil {
+		return err
+	}
+
+	drift, err := checkCollection(ctx, db.Collection(spec.Name), spec)
+	if err != nil {
+		return err
+	}
+
+	var models []mongo.IndexModel
+	for _, index := range spec.Indexes {
+		for _, missing := range drift.Missing {
+			if index.Name == missing {
+				models = append(models, indexModel(index))
+			}
+		}
+	}
+
+	if len(models) > 0 {
+		if _, err := db.Collection(spec.Name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("creating indexes on %s: %w", spec.Name, wrapErr(err))
+		}
+	}
+
+	return nil
+}
+
+// CheckIndexes compares the indexes of every declared collection with its declaration
+// without changing anything
+func CheckIndexes(ctx context.Context, db *mongo.Database) ([]IndexDrift, error) {
+	drifts := make([]IndexDrift, 0, len(Collections))
+
+	for _, spec := range Collections {
+		drift, err := checkCollection(ctx, db.Collection(spec.Name), spec)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, drift)
+	}
+
+	return drifts, nil
+}
+
+// applyValidator sets the collection's schema validator, creating the collection if it
+// doesn't exist yet. Validation is moderate, so documents written before the validator
+// existed can still be updated.
+func applyValidator(ctx context.Context, db *mongo.Database, spec CollectionSpec) error {
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: spec.Name},
+		{Key: "validator", Value: spec.Validator},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: "error"},
+	}).Err()
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceNotFound" {
+		opts := options.CreateCollection().
+			SetValidator(spec.Validator).
+			SetValidationLevel("moderate").
+			SetValidationAction("error")
+		err = db.CreateCollection(ctx, spec.Name, opts)
+	}
+
+	if err != nil {
+		return fmt.Errorf("applying validator to %s: %w", spec.Name, wrapErr(err))
+	}
+
+	return nil
+}
+
+// existingIndex is an index as listed by mongo
+type existingIndex struct {
+	Name    string `bson:"name"`
+	Key     bson.D `bson:"key"`
+	Unique  bool   `bson:"unique"`
+	Partial bson.D `bson:"partialFilterExpression"`
+	// ExpireAfter is nil unless the index is a TTL index
+	ExpireAfter *int32 `bson:"expireAfterSeconds"`
+}
+
+func checkCollection(ctx context.Context, collection *mongo.Collection, spec CollectionSpec) (IndexDrift, error) {
+	drift := IndexDrift{Collection: spec.Name}
+
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return drift, fmt.Errorf("listing indexes of %s: %w", spec.Name, wrapErr(err))
+	}
+
+	var existing []existingIndex
+	if err := cursor.All(ctx, &existing); err != nil {
+		return drift, fmt.Errorf("listing indexes of %s: %w", spec.Name, wrapErr(err))
+	}
+
+	actual := make(map[string]existingIndex, len(existing))
+	for _, index := range existing {
+		actual[index.Name] = index
+	}
+
+	declared := make(map[string]bool, len(spec.Indexes))
+	for _, index := range spec.Indexes {
+		declared[index.Name] = true
+
+		got, ok := actual[index.Name]
+		switch {
+		case !ok:
+			drift.Missing = append(drift.Missing, index.Name)
+		case !sameDoc(got.Key, index.Keys) || got.Unique != index.Unique || !sameDoc(got.Partial, index.Partial) ||
+			index.TTL != (got.ExpireAfter != nil && *got.ExpireAfter == 0):
+			drift.Changed = append(drift.Changed, index.Name)
+		}
+	}
+
+	for _, index := range existing {
+		if index.Name != "_id_" && !declared[index.Name] {
+			drift.Unexpected = append(drift.Unexpected, index.Name)
+		}
+	}
+
+	return drift, nil
+}
+
+func indexModel(index IndexSpec) mongo.IndexModel {
+	opts := options.Index().SetName(index.Name)
+	if index.Unique {
+		opts.SetUnique(true)
+	}
+	if len(index.Partial) > 0 {
+		opts.SetPartialFilterExpression(index.Partial)
+	}
+	if index.TTL {
+		opts.SetExpireAfterSeconds(0)
+	}
+
+	return mongo.IndexModel{Keys: index.Keys, Options: opts}
+}
+
+// sameDoc compares two documents as relaxed extended JSON, so that a key declared as the
+// Go int 1 matches the int32 1 mongo lists
+func sameDoc(a, b bson.D) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+
+	ja, errA := bson.MarshalExtJSON(a, false, false)
+	jb, errB := bson.MarshalExtJSON(b, false, false)
+
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
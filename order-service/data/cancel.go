@@ -0,0 +1,187 @@
+package data
+
+import (
+	"fmt"
+	"time"
+)
+
+// Order statuses. Every order is placed pending and only moves on through the service. An
+// allocated order has stock reserved for it, and an order that is picking is on a pick
+// list. A backordered order waits for stock to arrive.
+const (
+	StatusPending     = "pending"
+	StatusBackordered = "backordered"
+	StatusAllocated   = "allocated"
+	StatusPicking     = "picking"
+	StatusPicked      = "picked"
+	StatusPacked      = "packed"
+	StatusShipped     = "shipped"
+	StatusDelivered   = "delivered"
+	StatusCancelled   = "cancelled"
+)
+
+// MaxReasonLength caps the reason recorded with a cancellation
+const MaxReasonLength = 500
+
+// Cancellation records units taken off one line of an order
+type Cancellation struct {
+	Line      int    `bson:"line" json:"line"`
+	ProductID string `bson:"product_id" json:"product_id"`
+	Quantity  int    `bson:"quantity" json:"quantity"`
+	Reason    string `bson:"reason" json:"reason"`
+	// Restock is set when the units had already been picked and go back on the shelf
+	// rather than just having their reservation dropped
+	Restock bool `bson:"restock" json:"restock"`
+	// Released is set once the inventory service has taken the units back
+	Released bool      `bson:"released" json:"released"`
+	At       time.Time `bson:"at" json:"at"`
+}
+
+// Open returns the units of the line that haven't been cancelled or split off into a
+// backorder
+func (item OrderItem) Open() int {
+	return item.Quantity - item.CancelledQuantity - item.Backordered
+}
+
+// Cancellable reports whether units can still be taken off the order. Once goods have
+// left the warehouse they come back as a return instead, and while the order is picked
+// its pick list has to be confirmed first.
+func (o *OrderEntry) Cancellable() error {
+	switch o.Status {
+	case StatusPicking, StatusShipped, StatusDelivered, StatusCancelled:
+		return fmt.Errorf("%w: the order is %s", ErrStatus, o.Status)
+	}
+
+	return nil
+}
+
+// Cancel takes every open unit off the order and marks it cancelled
+func (o *OrderEntry) Cancel(reason string, now time.Time) ([]Cancellation, error) {
+	if err := o.Cancellable(); err != nil {
+		return nil, err
+	}
+
+	if err := checkReason(reason); err != nil {
+		return nil, err
+	}
+
+	var cancelled []Cancellation
+	for line, item := range o.Items {
+		if item.Open() > 0 {
+			cancelled = append(cancelled, o.cancelLine(line, item.Open(), reason, now))
+		}
+	}
+
+	o.Status = StatusCancelled
+	o.CancelReason = reason
+	o.CancelledAt = &now
+	o.Recalculate()
+
+	return cancelled, nil
+}
+
+// CancelLine takes quantity units off line, or all of its open units when quantity is
+// zero. The order is cancelled as a whole once no line has open units left.
+func (o *OrderEntry) CancelLine(line, quantity int, reason string, now time.Time) (Cancellation, error) {
+	if err := o.Cancellable(); err != nil {
+		return Cancellation{}, err
+	}
+
+	if err := checkReason(reason); err != nil {
+		return Cancellation{}, err
+	}
+
+	if line < 0 || line >= len(o.Items) {
+		return Cancellation{}, fmt.Errorf("%w: the order has no line %d", ErrInvalid, line)
+	}
+
+	open := o.Items[line].Open()
+	if quantity == 0 {
+		quantity = open
+	}
+
+	switch {
+	case open == 0:
+		return Cancellation{}, fmt.Errorf("%w: line %d is already cancelled", ErrStatus, line)
+	case quantity < 0 || quantity > open:
+		return Cancellation{}, fmt.Errorf("%w: line %d has %d open units, can't cancel %d", ErrInvalid, line, open, quantity)
+	}
+
+	cancelled := o.cancelLine(line, quantity, reason, now)
+
+	if o.openUnits() == 0 {
+		o.Status = StatusCancelled
+		o.CancelReason = reason
+		o.CancelledAt = &now
+	}
+	o.Recalculate()
+
+	return cancelled, nil
+}
+
+// Recalculate sets the total price from the open units of every line. A priced order
+// keeps the discounts and tax its units were ordered with.
+func (o *OrderEntry) Recalculate() {
+	if o.Pricing != nil {
+		var total float64
+		for i, item := range o.Items {
+			total += float64(o.LinePrice(i, item.Open(), 0).Total)
+		}
+
+		o.TotalPrice = cents(total)
+		return
+	}
+
+	var total float32
+	for _, item := range o.Items {
+		total += item.ProductPrice * float32(item.Open())
+	}
+
+	o.TotalPrice = total
+}
+
+func (o *OrderEntry) cancelLine(line, quantity int, reason string, now time.Time) Cancellation {
+	o.Items[line].CancelledQuantity += quantity
+
+	c := Cancellation{
+		Line:      line,
+		ProductID: o.Items[line].ProductID,
+		Quantity:  quantity,
+		Reason:    reason,
+		Restock:   o.Status == StatusPicked || o.Status == StatusPacked,
+		At:        now,
+	}
+
+	switch o.Status {
+	case StatusAllocated, StatusPicking:
+		o.Items[line].Allocated = max(0, o.Items[line].Allocated-quantity)
+	case StatusPicked, StatusPacked:
+	default:
+		// an order that wasn't allocated holds no stock, there is nothing to release
+		c.Released = true
+	}
+
+	o.Cancellations = append(o.Cancellations, c)
+
+	return c
+}
+
+func (o *OrderEntry) openUnits() int {
+	units := 0
+	for _, item := range o.Items {
+		units += item.Open()
+	}
+
+	return units
+}
+
+func checkReason(reason string) error {
+	switch {
+	case reason == "":
+		return fmt.Errorf("%w: a reason is required", ErrInvalid)
+	case len(reason) > MaxReasonLength:
+		return fmt.Errorf("%w: the reason must not be longer than %d characters", ErrInvalid, MaxReasonLength)
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"order-service/pricing"
+)
+
+// Address kinds. Orders are shipped to a shipping address, which sets the destination
+// their tax depends on, and invoiced to a billing address.
+const (
+	AddressShipping = "shipping"
+	AddressBilling  = "billing"
+)
+
+// Limits on the free text of a customer record
+const (
+	maxNameLength = 200
+	maxAddresses  = 20
+	maxTaxIDs     = 10
+)
+
+// email is deliberately loose: one @ with something on both sides and a dot in the domain
+var email = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// CustomerEntry is a client of the warehouse. ID is the number orders, returns, invoices
+// and promotions refer to the customer by as client_id.
+type CustomerEntry struct {
+	ID        int32     `bson:"_id" json:"id"`
+	Name      string    `bson:"name" json:"name"`
+	Company   string    `bson:"company,omitempty" json:"company,omitempty"`
+	Email     string    `bson:"email" json:"email"`
+	Phone     string    `bson:"phone,omitempty" json:"phone,omitempty"`
+	Addresses []Address `bson:"addresses" json:"addresses"`
+	TaxIDs    []TaxID   `bson:"tax_ids,omitempty" json:"tax_ids,omitempty"`
+	// DefaultShipping and DefaultBilling are the ids of the addresses an order gets when
+	// it names none
+	DefaultShipping string    `bson:"default_shipping,omitempty" json:"default_shipping,omitempty"`
+	DefaultBilling  string    `bson:"default_billing,omitempty" json:"default_billing,omitempty"`
+	RequestID       string    `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	CreatedAt       time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Address is one of a customer's addresses. Name is who receives what is sent there, the
+// customer when it is empty. Country is an ISO 3166-1 alpha-2 code and Region a state or
+// province, as the tax rules name it.
+type Address struct {
+	ID         string   `bson:"id" json:"id"`
+	Kinds      []string `bson:"kinds,omitempty" json:"kinds,omitempty"`
+	Name       string   `bson:"name,omitempty" json:"name,omitempty"`
+	Line1      string   `bson:"line1" json:"line1"`
+	Line2      string   `bson:"line2,omitempty" json:"line2,omitempty"`
+	City       string   `bson:"city" json:"city"`
+	PostalCode string   `bson:"postal_code,omitempty" json:"postal_code,omitempty"`
+	Region     string   `bson:"region,omitempty" json:"region,omitempty"`
+	Country    string   `bson:"country" json:"country"`
+}
+
+// TaxID is a tax identifier of the customer, such as a VAT number. Type names the scheme,
+// like eu_vat or us_ein.
+type TaxID struct {
+	Type    string `bson:"type" json:"type"`
+	Value   string `bson:"value" json:"value"`
+	Country string `bson:"country,omitempty" json:"country,omitempty"`
+}
+
+// NewAddressID returns the id of a new address
+func NewAddressID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// Normalize tidies up the record before it is checked: it trims the text, upper cases
+// country codes, gives new addresses an id and makes the first address of each kind the
+// default when there is none.
+func (c *CustomerEntry) Normalize() {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Company = strings.TrimSpace(c.Company)
+	c.Email = strings.ToLower(strings.TrimSpace(c.Email))
+	c.Phone = strings.TrimSpace(c.Phone)
+
+	for i := range c.Addresses {
+		a := &c.Addresses[i]
+		if a.ID == "" {
+			a.ID = NewAddressID()
+		}
+		a.Name = strings.TrimSpace(a.Name)
+		a.Line1 = strings.TrimSpace(a.Line1)
+		a.Line2 = strings.TrimSpace(a.Line2)
+		a.City = strings.TrimSpace(a.City)
+		a.PostalCode = strings.TrimSpace(a.PostalCode)
+		a.Region = strings.TrimSpace(a.Region)
+		a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	}
+
+	for i := range c.TaxIDs {
+		t := &c.TaxIDs[i]
+		t.Type = strings.ToLower(strings.TrimSpace(t.Type))
+		t.Value = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(t.Value), " ", ""))
+		t.Country = strings.ToUpper(strings.TrimSpace(t.Country))
+	}
+
+	if c.DefaultShipping == "" {
+		c.DefaultShipping = c.firstOfKind(AddressShipping)
+	}
+	if c.DefaultBilling == "" {
+		c.DefaultBilling = c.firstOfKind(AddressBilling)
+	}
+}
+
+// Check reports the first thing wrong with the record
+func (c *CustomerEntry) Check() error {
+	switch {
+	case c.ID < 0:
+		return fmt.Errorf("%w: the customer id can't be negative", ErrInvalid)
+	case c.Name == "" || len(c.Name) > maxNameLength:
+		return fmt.Errorf("%w: a name of at most %d characters is required", ErrInvalid, maxNameLength)
+	case len(c.Company) > maxNameLength:
+		return fmt.Errorf("%w: the company must not be longer than %d characters", ErrInvalid, maxNameLength)
+	case !email.MatchString(c.Email):
+		return fmt.Errorf("%w: %q is not an email address", ErrInvalid, c.Email)
+	case len(c.Addresses) > maxAddresses:
+		return fmt.Errorf("%w: a customer has at most %d addresses", ErrInvalid, maxAddresses)
+	case len(c.TaxIDs) > maxTaxIDs:
+		return fmt.Errorf("%w: a customer has at most %d tax ids", ErrInvalid, maxTaxIDs)
+	}
+
+	ids := make(map[string]bool, len(c.Addresses))
+	for i, a := range c.Addresses {
+		if err := a.check(); err != nil {
+			return fmt.Errorf("%w: address %d: %v", ErrInvalid, i, err)
+		}
+		if ids[a.ID] {
+			return fmt.Errorf("%w: address id %s is used twice", ErrInvalid, a.ID)
+		}
+		ids[a.ID] = true
+	}
+
+	for kind, id := range map[string]string{AddressShipping: c.DefaultShipping, AddressBilling: c.DefaultBilling} {
+		if id == "" {
+			continue
+		}
+		if a := c.address(id); a == nil || !slices.Contains(a.Kinds, kind) {
+			return fmt.Errorf("%w: the default %s address %s isn't one of the customer's %s addresses", ErrInvalid, kind, id, kind)
+		}
+	}
+
+	seen := make(map[TaxID]bool, len(c.TaxIDs))
+	for i, t := range c.TaxIDs {
+		switch {
+		case t.Type == "" || t.Value == "":
+			return fmt.Errorf("%w: tax id %d needs a type and a value", ErrInvalid, i)
+		case len(t.Type) > 32 || len(t.Value) > 64:
+			return fmt.Errorf("%w: tax id %d is too long", ErrInvalid, i)
+		case t.Country != "" && pricing.CheckDestination(pricing.Destination{Country: t.Country}) != nil:
+			return fmt.Errorf("%w: tax id %d: country %q must be an ISO 3166-1 alpha-2 code", ErrInvalid, i, t.Country)
+		case seen[t]:
+			return fmt.Errorf("%w: tax id %s %s is listed twice", ErrInvalid, t.Type, t.Value)
+		}
+		seen[t] = true
+	}
+
+	return nil
+}
+
+// OrderAddresses picks the shipping and billing addresses of an order: the ones with the
+// given ids, or the customer's defaults. Either is nil when the customer has none.
+func (c *CustomerEntry) OrderAddresses(shippingID, billingID string) (shipping, billing *Address, err error) {
+	if shipping, err = c.orderAddress(AddressShipping, shippingID, c.DefaultShipping); err != nil {
+		return nil, nil, err
+	}
+	if billing, err = c.orderAddress(AddressBilling, billingID, c.DefaultBilling); err != nil {
+		return nil, nil, err
+	}
+
+	return shipping, billing, nil
+}
+
+// Destination is where the tax rules consider something sent to the address to go
+func (a Address) Destination() pricing.Destination {
+	return pricing.Destination{Country: a.Country, Region: a.Region}
+}
+
+// Lines lays the address out for printing
+func (a Address) Lines() []string {
+	var lines []string
+	for _, line := range []string{a.Name, a.Line1, a.Line2, strings.TrimSpace(a.PostalCode + " " + a.City), a.Region, a.Country} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+func (a Address) check() error {
+	switch {
+	case len(a.Kinds) == 0:
+		return fmt.Errorf("kinds must list %s, %s or both", AddressShipping, AddressBilling)
+	case a.Line1 == "" || a.City == "":
+		return errors.New("line1 and city are required")
+	case len(a.Name) > maxNameLength || len(a.Line1) > maxNameLength || len(a.Line2) > maxNameLength ||
+		len(a.City) > maxNameLength || len(a.PostalCode) > 32 || len(a.Region) > 64:
+		return errors.New("a field is too long")
+	}
+
+	for _, kind := range a.Kinds {
+		if kind != AddressShipping && kind != AddressBilling {
+			return fmt.Errorf("kind %q must be %s or %s", kind, AddressShipping, AddressBilling)
+		}
+	}
+
+	if err := pricing.CheckDestination(a.Destination()); err != nil || a.Country == "" {
+		return fmt.Errorf("country %q must be an ISO 3166-1 alpha-2 code", a.Country)
+	}
+
+	return nil
+}
+
+func (c *CustomerEntry) orderAddress(kind, id, fallback string) (*Address, error) {
+	if id == "" {
+		id = fallback
+	}
+	if id == "" {
+		return nil, nil
+	}
+
+	a := c.address(id)
+	if a == nil || !slices.Contains(a.Kinds, kind) {
+		return nil, fmt.Errorf("%w: customer %d has no %s address %s", ErrInvalid, c.ID, kind, id)
+	}
+
+	// the order keeps the address as it was, whatever happens to the customer's records
+	address := *a
+	address.Kinds = nil
+	if address.Name == "" {
+		address.Name = c.Name
+	}
+
+	return &address, nil
+}
+
+func (c *CustomerEntry) address(id string) *Address {
+	for i := range c.Addresses {
+		if c.Addresses[i].ID == id {
+			return &c.Addresses[i]
+		}
+	}
+
+	return nil
+}
+
+func (c *CustomerEntry) firstOfKind(kind string) string {
+	for _, a := range c.Addresses {
+		if slices.Contains(a.Kinds, kind) {
+			return a.ID
+		}
+	}
+
+	return ""
+}
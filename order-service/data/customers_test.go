@@ -0,0 +1,178 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func lyon(kinds ...string) Address {
+	return Address{Kinds: kinds, Line1: "1 Main St", City: "Lyon", PostalCode: "69001", Country: "FR"}
+}
+
+func TestCustomerNormalize(t *testing.T) {
+	c := CustomerEntry{
+		Name:  "  Ada ",
+		Email: " Ada@Example.COM ",
+		Addresses: []Address{
+			{Kinds: []string{AddressBilling}, Line1: " 2 Rue ", City: "Paris ", Country: " fr"},
+			{Kinds: []string{AddressShipping, AddressBilling}, Line1: "1 Main St", City: "Lyon", Country: "FR"},
+		},
+		TaxIDs: []TaxID{{Type: " EU_VAT", Value: "fr 123 456", Country: "fr "}},
+	}
+
+	c.Normalize()
+
+	if c.Name != "Ada" || c.Email != "ada@example.com" {
+		t.Errorf("name %q, email %q", c.Name, c.Email)
+	}
+	a := c.Addresses[0]
+	if a.ID == "" || a.Line1 != "2 Rue" || a.City != "Paris" || a.Country != "FR" {
+		t.Errorf("address = %+v", a)
+	}
+	if tax := c.TaxIDs[0]; tax != (TaxID{Type: "eu_vat", Value: "FR123456", Country: "FR"}) {
+		t.Errorf("tax id = %+v", tax)
+	}
+	// the first address of each kind is the default
+	if c.DefaultBilling != c.Addresses[0].ID || c.DefaultShipping != c.Addresses[1].ID {
+		t.Errorf("defaults %s and %s", c.DefaultShipping, c.DefaultBilling)
+	}
+
+	// defaults that are set stay
+	c.DefaultBilling = c.Addresses[1].ID
+	c.Normalize()
+	if c.DefaultBilling != c.Addresses[1].ID {
+		t.Errorf("the default billing address moved to %s", c.DefaultBilling)
+	}
+
+	if err := c.Check(); err != nil {
+		t.Errorf("a normalized customer: %v", err)
+	}
+}
+
+func TestCustomerCheck(t *testing.T) {
+	long := strings.Repeat("x", maxNameLength+1)
+
+	tests := []struct {
+		name   string
+		change func(*CustomerEntry)
+		want   string
+	}{
+		{"a valid customer", func(c *CustomerEntry) {}, ""},
+		{"no addresses", func(c *CustomerEntry) { c.Addresses, c.DefaultShipping, c.DefaultBilling = nil, "", "" }, ""},
+		{"a negative id", func(c *CustomerEntry) { c.ID = -1 }, "negative"},
+		{"no name", func(c *CustomerEntry) { c.Name = "" }, "name"},
+		{"a long name", func(c *CustomerEntry) { c.Name = long }, "name"},
+		{"a long company", func(c *CustomerEntry) { c.Company = long }, "company"},
+		{"no email", func(c *CustomerEntry) { c.Email = "" }, "email"},
+		{"an email without a domain", func(c *CustomerEntry) { c.Email = "ada@example" }, "email"},
+		{"an email with two @", func(c *CustomerEntry) { c.Email = "ada@home@example.com" }, "email"},
+		{"too many addresses", func(c *CustomerEntry) {
+			for len(c.Addresses) <= maxAddresses {
+				a := lyon(AddressShipping)
+				a.ID = NewAddressID()
+				c.Addresses = append(c.Addresses, a)
+			}
+		}, "addresses"},
+		{"an address without kinds", func(c *CustomerEntry) { c.Addresses[1].Kinds = nil }, "address 1: kinds"},
+		{"an address of an unknown kind", func(c *CustomerEntry) { c.Addresses[1].Kinds = []string{"home"} }, `address 1: kind "home"`},
+		{"an address without a street", func(c *CustomerEntry) { c.Addresses[0].Line1 = "" }, "address 0: line1"},
+		{"an address without a city", func(c *CustomerEntry) { c.Addresses[0].City = "" }, "address 0: line1 and city"},
+		{"a long postal code", func(c *CustomerEntry) { c.Addresses[0].PostalCode = strings.Repeat("1", 33) }, "too long"},
+		{"an address without a country", func(c *CustomerEntry) { c.Addresses[0].Country = "" }, "address 0: country"},
+		{"a country by name", func(c *CustomerEntry) { c.Addresses[0].Country = "France" }, "address 0: country"},
+		{"an address id used twice", func(c *CustomerEntry) { c.Addresses[1].ID = c.Addresses[0].ID }, "used twice"},
+		{"a default that doesn't exist", func(c *CustomerEntry) { c.DefaultShipping = "gone" }, "default shipping"},
+		{"a default of the wrong kind", func(c *CustomerEntry) { c.DefaultShipping = c.Addresses[1].ID }, "default shipping"},
+		{"too many tax ids", func(c *CustomerEntry) {
+			for i := 0; i <= maxTaxIDs; i++ {
+				c.TaxIDs = append(c.TaxIDs, TaxID{Type: "eu_vat", Value: strings.Repeat("1", i+1)})
+			}
+		}, "tax ids"},
+		{"a tax id without a value", func(c *CustomerEntry) { c.TaxIDs[0].Value = "" }, "type and a value"},
+		{"a tax id without a type", func(c *CustomerEntry) { c.TaxIDs[0].Type = "" }, "type and a value"},
+		{"a long tax id", func(c *CustomerEntry) { c.TaxIDs[0].Value = strings.Repeat("1", 65) }, "too long"},
+		{"a tax id of a country by name", func(c *CustomerEntry) { c.TaxIDs[0].Country = "France" }, "country"},
+		{"a tax id of no country", func(c *CustomerEntry) { c.TaxIDs[0].Country = "" }, ""},
+		{"a tax id listed twice", func(c *CustomerEntry) { c.TaxIDs = append(c.TaxIDs, c.TaxIDs[0]) }, "listed twice"},
+		{"one value under two schemes", func(c *CustomerEntry) { c.TaxIDs = append(c.TaxIDs, TaxID{Type: "siren", Value: c.TaxIDs[0].Value}) }, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := CustomerEntry{
+				ID:        1,
+				Name:      "Ada",
+				Email:     "ada@example.com",
+				Addresses: []Address{lyon(AddressShipping), lyon(AddressBilling)},
+				TaxIDs:    []TaxID{{Type: "eu_vat", Value: "FR123", Country: "FR"}},
+			}
+			c.Normalize()
+			tt.change(&c)
+
+			err := c.Check()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("error = %v, want none", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want ErrInvalid about %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomerOrderAddresses(t *testing.T) {
+	c := CustomerEntry{ID: 1, Name: "Ada", Addresses: []Address{lyon(AddressShipping), lyon(AddressShipping, AddressBilling)}}
+	c.Addresses[1].Name = "Accounts"
+	c.Normalize()
+	home, office := c.Addresses[0].ID, c.Addresses[1].ID
+
+	tests := []struct {
+		name              string
+		shipping, billing string
+		want              error
+		shipTo, billTo    string
+	}{
+		{"the defaults", "", "", nil, home, office},
+		{"picked addresses", office, office, nil, office, office},
+		{"an address of the wrong kind", "", home, ErrInvalid, "", ""},
+		{"an address that doesn't exist", "gone", "", ErrInvalid, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shipping, billing, err := c.OrderAddresses(tt.shipping, tt.billing)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+
+			if shipping.ID != tt.shipTo || billing.ID != tt.billTo {
+				t.Errorf("shipping to %s and billing to %s", shipping.ID, billing.ID)
+			}
+			// the order gets the address as it is, addressed to the customer unless it names someone
+			if shipping.Kinds != nil || billing.Kinds != nil {
+				t.Errorf("the order's addresses keep their kinds")
+			}
+			if want := map[string]string{home: "Ada", office: "Accounts"}; shipping.Name != want[shipping.ID] || billing.Name != want[billing.ID] {
+				t.Errorf("addressed to %q and %q", shipping.Name, billing.Name)
+			}
+		})
+	}
+
+	shipping, _, _ := c.OrderAddresses("", "")
+	shipping.Line1 = "changed"
+	if c.Addresses[0].Line1 != "1 Main St" {
+		t.Errorf("changing the order's address changed the customer's")
+	}
+
+	none := CustomerEntry{ID: 2, Name: "Bob"}
+	if shipping, billing, err := none.OrderAddresses("", ""); shipping != nil || billing != nil || err != nil {
+		t.Errorf("a customer without addresses: %v, %v, %v", shipping, billing, err)
+	}
+}
@@ -0,0 +1,392 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CustomerRepository stores customers. Customers are never deleted, so that the orders
+// referring to them keep doing so.
+type CustomerRepository interface {
+	// Insert stores a new customer. One without an id is numbered after the highest id
+	// stored; one with an id takes it, so that customers can be recorded for the client ids
+	// orders already use. An id or email that is taken returns ErrCustomerExists.
+	Insert(ctx context.Context, entry CustomerEntry) (*CustomerEntry, error)
+	GetOne(ctx context.Context, id int32) (*CustomerEntry, error)
+	Find(ctx context.Context, filter CustomerFilter) (CustomerPage, error)
+	Update(ctx context.Context, entry CustomerEntry) error
+}
+
+// CustomerFilter narrows down a search for customers. Email must match exactly, Name is
+// any part of the name or company, in any case. Page counts from 1.
+type CustomerFilter struct {
+	Email    string
+	Name     string
+	Page     int
+	PageSize int
+}
+
+// CustomerPage is one page of a search, in id order
+type CustomerPage struct {
+	Customers []*CustomerEntry `json:"customers"`
+	Page      int              `json:"page"`
+	PageSize  int              `json:"page_size"`
+	Total     int64            `json:"total"`
+}
+
+// normalize fills in the default page and clamps the page size
+func (f CustomerFilter) normalize() CustomerFilter {
+	orders := OrderFilter{Page: f.Page, PageSize: f.PageSize}.normalize()
+	f.Page, f.PageSize = orders.Page, orders.PageSize
+	f.Email = strings.ToLower(strings.TrimSpace(f.Email))
+
+	return f
+}
+
+// query turns the filter into a mongo query; the email index serves email searches
+func (f CustomerFilter) query() bson.D {
+	q := bson.D{}
+
+	if f.Email != "" {
+		q = append(q, bson.E{Key: "email", Value: f.Email})
+	}
+
+	if f.Name != "" {
+		pattern := containing(f.Name)
+		q = append(q, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "name", Value: pattern}},
+			bson.D{{Key: "company", Value: pattern}},
+		}})
+	}
+
+	return q
+}
+
+// matches is query for customers held in memory
+func (f CustomerFilter) matches(c CustomerEntry) bool {
+	if f.Email != "" && c.Email != f.Email {
+		return false
+	}
+
+	if f.Name != "" {
+		name := strings.ToLower(f.Name)
+		return strings.Contains(strings.ToLower(c.Name), name) || strings.Contains(strings.ToLower(c.Company), name)
+	}
+
+	return true
+}
+
+// MongoCustomers stores customers in the customers collection. The unique index on the
+// email keeps two customers from sharing one.
+type MongoCustomers struct {
+	collection *mongo.Collection
+}
+
+func NewMongoCustomers(db *mongo.Database) *MongoCustomers {
+	return &MongoCustomers{collection: db.Collection("customers")}
+}
+
+// Insert takes the id after the highest one stored when the customer has none. When a
+// concurrent insert took it first the id index rejects the customer, and the next id is
+// tried.
+func (m *MongoCustomers) Insert(ctx context.Context, entry CustomerEntry) (*CustomerEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	numbered := entry.ID == 0
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = entry.CreatedAt
+
+	for attempt := 0; attempt < numberAttempts; attempt++ {
+		if numbered {
+			var last CustomerEntry
+			opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}}).SetProjection(bson.M{"_id": 1})
+
+			start := time.Now()
+			err := m.collection.FindOne(ctx, bson.D{}, opts).Decode(&last)
+			observe("customers", "find_last", start, err)
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, wrapErr(err)
+			}
+
+			entry.ID = last.ID + 1
+		}
+
+		start := time.Now()
+		_, err := m.collection.InsertOne(ctx, entry)
+		observe("customers", "insert", start, err)
+		if err == nil {
+			return &entry, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, wrapErr(err)
+		}
+
+		// the email may be taken; otherwise the id was
+		n, err := m.collection.CountDocuments(ctx, bson.M{"email": entry.Email})
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		if n > 0 {
+			return nil, fmt.Errorf("%w: another customer has the email %s", ErrCustomerExists, entry.Email)
+		}
+		if !numbered {
+			return nil, fmt.Errorf("%w: customer %d", ErrCustomerExists, entry.ID)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no customer id was free after %d attempts", ErrConflict, numberAttempts)
+}
+
+func (m *MongoCustomers) GetOne(ctx context.Context, id int32) (*CustomerEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var entry CustomerEntry
+	start := time.Now()
+	err := m.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&entry)
+	observe("customers", "find_one", start, err)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCustomerNotFound
+	}
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &entry, nil
+}
+
+// Find returns one page of the customers matching filter and how many match in total
+func (m *MongoCustomers) Find(ctx context.Context, filter CustomerFilter) (CustomerPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	filter = filter.normalize()
+	page := CustomerPage{Customers: []*CustomerEntry{}, Page: filter.Page, PageSize: filter.PageSize}
+	query := filter.query()
+
+	start := time.Now()
+	total, err := m.collection.CountDocuments(ctx, query)
+	observe("customers", "count", start, err)
+	if err != nil {
+		return page, wrapErr(err)
+	}
+	page.Total = total
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(int64((filter.Page - 1) * filter.PageSize)).
+		SetLimit(int64(filter.PageSize))
+
+	start = time.Now()
+	cursor, err := m.collection.Find(ctx, query, opts)
+	observe("customers", "find", start, err)
+	if err != nil {
+		return page, wrapErr(err)
+	}
+
+	if err := cursor.All(ctx, &page.Customers); err != nil {
+		return page, wrapErr(err)
+	}
+
+	return page, nil
+}
+
+// Update replaces the customer's details if nobody else changed them since they were read
+func (m *MongoCustomers) Update(ctx context.Context, entry CustomerEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := m.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": entry.ID, "updated_at": entry.UpdatedAt},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "name", Value: entry.Name},
+				{Key: "company", Value: entry.Company},
+				{Key: "email", Value: entry.Email},
+				{Key: "phone", Value: entry.Phone},
+				{Key: "addresses", Value: entry.Addresses},
+				{Key: "tax_ids", Value: entry.TaxIDs},
+				{Key: "default_shipping", Value: entry.DefaultShipping},
+				{Key: "default_billing", Value: entry.DefaultBilling},
+				{Key: "updated_at", Value: time.Now()},
+			}},
+		},
+	)
+	observe("customers", "update", start, err)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: another customer has the email %s", ErrCustomerExists, entry.Email)
+	}
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	if result.MatchedCount == 0 {
+		n, err := m.collection.CountDocuments(ctx, bson.M{"_id": entry.ID})
+		if err != nil {
+			return wrapErr(err)
+		}
+		if n == 0 {
+			return ErrCustomerNotFound
+		}
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// MemoryCustomers keeps customers in a map and hands out copies
+type MemoryCustomers struct {
+	mu        sync.RWMutex
+	customers map[int32]CustomerEntry
+}
+
+func NewMemoryCustomers() *MemoryCustomers {
+	return &MemoryCustomers{customers: make(map[int32]CustomerEntry)}
+}
+
+func (m *MemoryCustomers) Insert(ctx context.Context, entry CustomerEntry) (*CustomerEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.emailTaken(entry); err != nil {
+		return nil, err
+	}
+
+	if entry.ID == 0 {
+		for id := range m.customers {
+			entry.ID = max(entry.ID, id)
+		}
+		entry.ID++
+	} else if _, ok := m.customers[entry.ID]; ok {
+		return nil, fmt.Errorf("%w: customer %d", ErrCustomerExists, entry.ID)
+	}
+
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = entry.CreatedAt
+	m.customers[entry.ID] = *copyCustomer(entry)
+
+	return copyCustomer(entry), nil
+}
+
+func (m *MemoryCustomers) GetOne(ctx context.Context, id int32) (*CustomerEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.customers[id]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+
+	return copyCustomer(entry), nil
+}
+
+func (m *MemoryCustomers) Find(ctx context.Context, filter CustomerFilter) (CustomerPage, error) {
+	filter = filter.normalize()
+	page := CustomerPage{Customers: []*CustomerEntry{}, Page: filter.Page, PageSize: filter.PageSize}
+
+	if err := ctx.Err(); err != nil {
+		return page, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []*CustomerEntry
+	for _, entry := range m.customers {
+		if filter.matches(entry) {
+			matched = append(matched, copyCustomer(entry))
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].ID < matched[j].ID
+	})
+
+	page.Total = int64(len(matched))
+
+	from := (filter.Page - 1) * filter.PageSize
+	if from < len(matched) {
+		to := min(from+filter.PageSize, len(matched))
+		page.Customers = matched[from:to]
+	}
+
+	return page, nil
+}
+
+func (m *MemoryCustomers) Update(ctx context.Context, entry CustomerEntry) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.customers[entry.ID]
+	if !ok {
+		return ErrCustomerNotFound
+	}
+	if !stored.UpdatedAt.Equal(entry.UpdatedAt) {
+		return ErrConflict
+	}
+	if err := m.emailTaken(entry); err != nil {
+		return err
+	}
+
+	entry.CreatedAt = stored.CreatedAt
+	entry.RequestID = stored.RequestID
+	entry.UpdatedAt = time.Now()
+	m.customers[entry.ID] = *copyCustomer(entry)
+
+	return nil
+}
+
+// emailTaken reports another customer with the entry's email
+func (m *MemoryCustomers) emailTaken(entry CustomerEntry) error {
+	for id, other := range m.customers {
+		if id != entry.ID && other.Email == entry.Email {
+			return fmt.Errorf("%w: another customer has the email %s", ErrCustomerExists, entry.Email)
+		}
+	}
+
+	return nil
+}
+
+// copyCustomer copies the addresses and tax ids, so that callers can't change a stored
+// customer
+func copyCustomer(entry CustomerEntry) *CustomerEntry {
+	addresses := make([]Address, len(entry.Addresses))
+	for i, a := range entry.Addresses {
+		a.Kinds = append([]string(nil), a.Kinds...)
+		addresses[i] = a
+	}
+	entry.Addresses = addresses
+	entry.TaxIDs = append([]TaxID(nil), entry.TaxIDs...)
+
+	return &entry
+}
+
+// containing matches text anywhere in a field, in any case
+func containing(text string) bson.M {
+	return bson.M{"$regex": regexp.QuoteMeta(text), "$options": "i"}
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrNotFound is returned when no order has the requested id
+	ErrNotFound = errors.New("order not found")
+	// ErrTimeout is returned when the caller's deadline passed before mongo answered
+	ErrTimeout = errors.New("order storage timed out")
+	// ErrReturnNotFound is returned when no return authorization has the requested id
+	ErrReturnNotFound = errors.New("return not found")
+	// ErrPickListNotFound is returned when no pick list has the requested id
+	ErrPickListNotFound = errors.New("pick list not found")
+	// ErrShipmentNotFound is returned when no shipment has the requested id
+	ErrShipmentNotFound = errors.New("shipment not found")
+	// ErrInvoiceNotFound is returned when no invoice has the requested id, or an order has none
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	// ErrCustomerNotFound is returned when no customer has the requested id
+	ErrCustomerNotFound = errors.New("customer not found")
+	// ErrCustomerExists is returned when a new customer takes an id or email another has
+	ErrCustomerExists = errors.New("customer already exists")
+	// ErrConflict is returned when an order was changed by someone else since it was read
+	ErrConflict = errors.New("order was changed by another request")
+	// ErrStatus is returned when the status of an order or return doesn't allow the change
+	ErrStatus = errors.New("not allowed in the current status")
+	// ErrInvalid is returned when a change to an order, return or customer doesn't make sense
+	ErrInvalid = errors.New("invalid change")
+)
+
+// wrapErr turns driver errors into the package's typed errors, keeping the original
+// error's text for the logs
+func wrapErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,171 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// InvoicePrefix starts every invoice number; the sequence number follows, zero padded
+const InvoicePrefix = "INV-"
+
+// Invoice document formats
+const (
+	InvoiceHTML = "html"
+	InvoicePDF  = "pdf"
+)
+
+// InvoiceEntry is the invoice of one order. It never changes once issued: the amounts and
+// the rendered documents are kept as they were sent to the client.
+type InvoiceEntry struct {
+	ID string `bson:"_id,omitempty" json:"id,omitempty"`
+	// Number is given by the store when the invoice is issued, without gaps
+	Number    string        `bson:"number" json:"number"`
+	Sequence  int64         `bson:"sequence" json:"sequence"`
+	OrderID   string        `bson:"order_id" json:"order_id"`
+	ClientID  int32         `bson:"client_id,omitempty" json:"client_id,omitempty"`
+	Issuer    string        `bson:"issuer" json:"issuer"`
+	BillTo    *BillTo       `bson:"bill_to,omitempty" json:"bill_to,omitempty"`
+	Currency  string        `bson:"currency" json:"currency"`
+	Lines     []InvoiceLine `bson:"lines" json:"lines"`
+	Discount  float32       `bson:"discount" json:"discount"`
+	Net       float32       `bson:"net" json:"net"`
+	Tax       float32       `bson:"tax" json:"tax"`
+	Total     float32       `bson:"total" json:"total"`
+	Documents []Document    `bson:"documents" json:"-"`
+	RequestID string        `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	IssuedAt  time.Time     `bson:"issued_at" json:"issued_at"`
+}
+
+// BillTo is who an invoice is addressed to, as the customer was when it was issued.
+// Invoices of orders placed before there were customers have none.
+type BillTo struct {
+	Lines  []string `bson:"lines" json:"lines"`
+	TaxIDs []TaxID  `bson:"tax_ids,omitempty" json:"tax_ids,omitempty"`
+}
+
+// InvoiceLine is the open units of one order line as invoiced, at the price they were
+// ordered at. Net is what is left of their price after discounts.
+type InvoiceLine struct {
+	Line        int     `bson:"line" json:"line"`
+	ProductID   string  `bson:"product_id" json:"product_id"`
+	ProductName string  `bson:"product_name" json:"product_name"`
+	Quantity    int     `bson:"quantity" json:"quantity"`
+	UnitPrice   float32 `bson:"unit_price" json:"unit_price"`
+	Discount    float32 `bson:"discount" json:"discount"`
+	TaxRate     float64 `bson:"tax_rate" json:"tax_rate"`
+	Net         float32 `bson:"net" json:"net"`
+	Tax         float32 `bson:"tax" json:"tax"`
+	Total       float32 `bson:"total" json:"total"`
+}
+
+// Document is an invoice rendered in one format
+type Document struct {
+	Format      string `bson:"format" json:"format"`
+	ContentType string `bson:"content_type" json:"content_type"`
+	Data        []byte `bson:"data" json:"data"`
+}
+
+// InvoiceSettings are what an invoice takes from the service's configuration. TaxRate
+// taxes orders placed before orders were priced.
+type InvoiceSettings struct {
+	Issuer   string
+	Currency string
+	TaxRate  float64
+}
+
+// NewInvoice invoices the open units of a shipped order to its customer, nil for orders
+// placed before there were customers. The number is left to the store.
+func NewInvoice(order *OrderEntry, customer *CustomerEntry, settings InvoiceSettings, now time.Time) (InvoiceEntry, error) {
+	if order.Status != StatusShipped && order.Status != StatusDelivered {
+		return InvoiceEntry{}, fmt.Errorf("%w: only shipped or delivered orders can be invoiced, the order is %s", ErrStatus, order.Status)
+	}
+
+	invoice := InvoiceEntry{
+		OrderID:  order.ID,
+		ClientID: order.ClientID,
+		Issuer:   settings.Issuer,
+		Currency: settings.Currency,
+		BillTo:   billTo(order, customer),
+		IssuedAt: now,
+	}
+
+	for i, item := range order.Items {
+		if item.Open() == 0 {
+			continue
+		}
+
+		price := order.LinePrice(i, item.Open(), settings.TaxRate)
+
+		invoice.Lines = append(invoice.Lines, InvoiceLine{
+			Line:        i,
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Open(),
+			UnitPrice:   item.ProductPrice,
+			Discount:    price.Discount,
+			TaxRate:     price.TaxRate,
+			Net:         price.Net,
+			Tax:         price.Tax,
+			Total:       price.Total,
+		})
+
+		invoice.Discount += price.Discount
+		invoice.Net += price.Net
+		invoice.Tax += price.Tax
+	}
+
+	if len(invoice.Lines) == 0 {
+		return InvoiceEntry{}, fmt.Errorf("%w: the order has no open units to invoice", ErrInvalid)
+	}
+
+	invoice.Discount = cents(float64(invoice.Discount))
+	invoice.Net = cents(float64(invoice.Net))
+	invoice.Tax = cents(float64(invoice.Tax))
+	invoice.Total = cents(float64(invoice.Net + invoice.Tax))
+
+	return invoice, nil
+}
+
+// billTo addresses the invoice to the billing address the order was placed with, or to the
+// customer's name when the order has none
+func billTo(order *OrderEntry, customer *CustomerEntry) *BillTo {
+	if customer == nil {
+		return nil
+	}
+
+	var bill BillTo
+	if customer.Company != "" {
+		bill.Lines = append(bill.Lines, customer.Company)
+	}
+	if order.BillingAddress != nil {
+		bill.Lines = append(bill.Lines, order.BillingAddress.Lines()...)
+	} else {
+		bill.Lines = append(bill.Lines, customer.Name)
+	}
+	bill.TaxIDs = append([]TaxID(nil), customer.TaxIDs...)
+
+	return &bill
+}
+
+// Numbered gives the invoice its place in the sequence
+func (i *InvoiceEntry) Numbered(sequence int64) {
+	i.Sequence = sequence
+	i.Number = fmt.Sprintf("%s%06d", InvoicePrefix, sequence)
+}
+
+// Document returns the invoice rendered in format, if it was
+func (i *InvoiceEntry) Document(format string) (Document, bool) {
+	for _, doc := range i.Documents {
+		if doc.Format == format {
+			return doc, true
+		}
+	}
+
+	return Document{}, false
+}
+
+// cents rounds an amount of money to cents
+func cents(amount float64) float32 {
+	return float32(math.Round(amount*100) / 100)
+}
@@ -0,0 +1,189 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+var invoiceTime = time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+
+var invoiceSettings = InvoiceSettings{Issuer: "Warehouse Ltd", Currency: "EUR", TaxRate: 0.2}
+
+func TestNewInvoice(t *testing.T) {
+	billing := &Address{Line1: "1 Main St", City: "Lyon", PostalCode: "69001", Country: "FR"}
+	customer := &CustomerEntry{ID: 1, Name: "Ada", Company: "Acme", TaxIDs: []TaxID{{Type: "eu_vat", Value: "FR123"}}}
+
+	tests := []struct {
+		name     string
+		status   string
+		items    []OrderItem
+		billing  *Address
+		customer *CustomerEntry
+		want     error
+		lines    []int
+		net      float32
+		tax      float32
+		bill     []string
+	}{
+		{"a shipped order", StatusShipped, []OrderItem{{ProductPrice: 9.99, Quantity: 3}, {ProductPrice: 0.1, Quantity: 1}}, billing, customer, nil,
+			[]int{0, 1}, 30.07, 6.01, []string{"Acme", "1 Main St", "69001 Lyon", "FR"}},
+		{"a delivered order", StatusDelivered, []OrderItem{{ProductPrice: 10, Quantity: 1}}, nil, customer, nil,
+			[]int{0}, 10, 2, []string{"Acme", "Ada"}},
+		{"cancelled and backordered units are left out", StatusShipped,
+			[]OrderItem{{ProductPrice: 10, Quantity: 3, CancelledQuantity: 1}, {ProductPrice: 5, Quantity: 2, Backordered: 2}}, nil, nil, nil,
+			[]int{0}, 20, 4, nil},
+		{"an order before there were customers", StatusShipped, []OrderItem{{ProductPrice: 1, Quantity: 1}}, nil, nil, nil,
+			[]int{0}, 1, 0.2, nil},
+		{"an order that wasn't shipped", StatusPicked, []OrderItem{{ProductPrice: 10, Quantity: 1}}, nil, nil, ErrStatus, nil, 0, 0, nil},
+		{"nothing left open", StatusShipped, []OrderItem{{ProductPrice: 10, Quantity: 1, CancelledQuantity: 1}}, nil, nil, ErrInvalid, nil, 0, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &OrderEntry{ID: "o1", ClientID: 1, Status: tt.status, Items: tt.items, BillingAddress: tt.billing}
+
+			invoice, err := NewInvoice(order, tt.customer, invoiceSettings, invoiceTime)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+
+			if invoice.OrderID != order.ID || invoice.Number != "" || invoice.Issuer != "Warehouse Ltd" || invoice.Currency != "EUR" || !invoice.IssuedAt.Equal(invoiceTime) {
+				t.Errorf("invoice = %+v", invoice)
+			}
+			if len(invoice.Lines) != len(tt.lines) {
+				t.Fatalf("lines %+v, want %v", invoice.Lines, tt.lines)
+			}
+			for i, line := range invoice.Lines {
+				if line.Line != tt.lines[i] || line.Quantity != tt.items[line.Line].Open() {
+					t.Errorf("line %d = %+v", i, line)
+				}
+			}
+			if invoice.Net != tt.net || invoice.Tax != tt.tax || invoice.Total != cents(float64(tt.net+tt.tax)) {
+				t.Errorf("net %v, tax %v, total %v, want %v and %v", invoice.Net, invoice.Tax, invoice.Total, tt.net, tt.tax)
+			}
+
+			if tt.bill == nil {
+				if invoice.BillTo != nil {
+					t.Errorf("billed to %+v, want nobody", invoice.BillTo)
+				}
+				return
+			}
+			if invoice.BillTo == nil || !reflect.DeepEqual(invoice.BillTo.Lines, tt.bill) || len(invoice.BillTo.TaxIDs) != 1 {
+				t.Errorf("billed to %+v, want %v", invoice.BillTo, tt.bill)
+			}
+		})
+	}
+}
+
+func TestNewInvoiceKeepsTheCustomer(t *testing.T) {
+	customer := &CustomerEntry{ID: 1, Name: "Ada", TaxIDs: []TaxID{{Type: "eu_vat", Value: "FR123"}}}
+	order := &OrderEntry{ID: "o1", Status: StatusShipped, Items: []OrderItem{{ProductPrice: 1, Quantity: 1}}}
+
+	invoice, err := NewInvoice(order, customer, invoiceSettings, invoiceTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	customer.TaxIDs[0].Value = "FR999"
+	if invoice.BillTo.TaxIDs[0].Value != "FR123" {
+		t.Errorf("the invoice changed with the customer: %+v", invoice.BillTo.TaxIDs)
+	}
+}
+
+func TestMemoryInvoicesInsert(t *testing.T) {
+	store := NewMemoryInvoices()
+	ctx := context.Background()
+	render := func(entry *InvoiceEntry) error {
+		entry.Documents = []Document{{Format: InvoiceHTML, Data: []byte(entry.Number)}}
+		return nil
+	}
+
+	for i, want := range []string{"INV-000001", "INV-000002", "INV-000003"} {
+		invoice, err := store.Insert(ctx, InvoiceEntry{OrderID: string(rune('a' + i))}, render)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if invoice.Number != want || invoice.Sequence != int64(i+1) {
+			t.Errorf("invoice %d is %s", i, invoice.Number)
+		}
+		if doc, ok := invoice.Document(InvoiceHTML); !ok || string(doc.Data) != want {
+			t.Errorf("invoice %d was rendered before it was numbered: %q", i, doc.Data)
+		}
+	}
+
+	if _, err := store.Insert(ctx, InvoiceEntry{OrderID: "a"}, render); !errors.Is(err, ErrStatus) {
+		t.Errorf("invoicing an order twice: %v, want ErrStatus", err)
+	}
+
+	failed := errors.New("render failed")
+	if _, err := store.Insert(ctx, InvoiceEntry{OrderID: "d"}, func(*InvoiceEntry) error { return failed }); !errors.Is(err, failed) {
+		t.Errorf("render error = %v", err)
+	}
+
+	// neither refusal took a number
+	invoice, err := store.Insert(ctx, InvoiceEntry{OrderID: "d"}, render)
+	if err != nil || invoice.Number != "INV-000004" {
+		t.Errorf("after the refusals: %v, %v", invoice, err)
+	}
+}
+
+func TestMongoInvoicesInsert(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	ns := "db.invoices"
+	last := func(sequence int64) bson.D {
+		return mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "sequence", Value: sequence}})
+	}
+	none := mtest.CreateCursorResponse(0, ns, mtest.FirstBatch)
+	taken := mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"})
+	inserted := mtest.CreateSuccessResponse()
+
+	tests := []struct {
+		name      string
+		responses []bson.D
+		want      error
+		number    string
+		tries     int
+	}{
+		{"the first invoice", []bson.D{none, inserted}, nil, "INV-000001", 1},
+		{"the number after the last", []bson.D{last(41), inserted}, nil, "INV-000042", 1},
+		{"a number taken meanwhile", []bson.D{last(41), taken, none, last(42), inserted}, nil, "INV-000043", 2},
+		{"the order invoiced meanwhile", []bson.D{last(41), taken,
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "order_id", Value: "o1"}, {Key: "number", Value: "INV-000042"}})}, ErrStatus, "", 1},
+		{"every number taken", []bson.D{
+			last(41), taken, none, last(42), taken, none, last(43), taken, none, last(44), taken, none, last(45), taken, none,
+		}, ErrConflict, "", numberAttempts},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses...)
+			store := NewMongoInvoices(mt.DB)
+
+			renders := 0
+			invoice, err := store.Insert(context.Background(), InvoiceEntry{OrderID: "o1"}, func(entry *InvoiceEntry) error {
+				renders++
+				return nil
+			})
+			if !errors.Is(err, tt.want) {
+				mt.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			// every number tried is rendered on the invoice again
+			if renders != tt.tries {
+				mt.Errorf("rendered %d times, want %d", renders, tt.tries)
+			}
+			if err == nil && (invoice.Number != tt.number || invoice.ID == "") {
+				mt.Errorf("invoice %s (%s), want %s", invoice.Number, invoice.ID, tt.number)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// numberAttempts caps how often Insert takes the next number after another invoice got it
+const numberAttempts = 5
+
+// InvoiceRepository stores invoices. Invoices are never updated; an order has at most one.
+type InvoiceRepository interface {
+	// Insert numbers the invoice with the sequence number after the last one, has render
+	// fill in its documents and stores it. Numbering an order that already has an invoice
+	// returns ErrStatus.
+	Insert(ctx context.Context, entry InvoiceEntry, render func(*InvoiceEntry) error) (*InvoiceEntry, error)
+	GetOne(ctx context.Context, id string) (*InvoiceEntry, error)
+	ByOrder(ctx context.Context, orderID string) (*InvoiceEntry, error)
+}
+
+// MongoInvoices stores invoices in the invoices collection. The unique indexes on the
+// sequence and the order id keep numbers free of gaps and orders invoiced once.
+type MongoInvoices struct {
+	collection *mongo.Collection
+}
+
+func NewMongoInvoices(db *mongo.Database) *MongoInvoices {
+	return &MongoInvoices{collection: db.Collection("invoices")}
+}
+
+// Insert takes the number after the highest one stored. When a concurrent insert took it
+// first the unique index rejects the invoice, and the next number is tried.
+func (m *MongoInvoices) Insert(ctx context.Context, entry InvoiceEntry, render func(*InvoiceEntry) error) (*InvoiceEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	entry.ID = ""
+
+	for attempt := 0; attempt < numberAttempts; attempt++ {
+		var last InvoiceEntry
+		opts := options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}}).SetProjection(bson.M{"sequence": 1})
+
+		start := time.Now()
+		err := m.collection.FindOne(ctx, bson.D{}, opts).Decode(&last)
+		observe("invoices", "find_last", start, err)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, wrapErr(err)
+		}
+
+		entry.Numbered(last.Sequence + 1)
+		if err := render(&entry); err != nil {
+			return nil, err
+		}
+
+		start = time.Now()
+		result, err := m.collection.InsertOne(ctx, entry)
+		observe("invoices", "insert", start, err)
+		if err == nil {
+			id, _ := result.InsertedID.(primitive.ObjectID)
+			entry.ID = id.Hex()
+			return &entry, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, wrapErr(err)
+		}
+
+		// the order may have been invoiced meanwhile; otherwise the number was taken
+		if existing, err := m.ByOrder(ctx, entry.OrderID); err == nil {
+			return nil, invoiced(existing)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no invoice number was free after %d attempts", ErrConflict, numberAttempts)
+}
+
+func (m *MongoInvoices) GetOne(ctx context.Context, id string) (*InvoiceEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvoiceNotFound
+	}
+
+	return m.findOne(ctx, "find_one", bson.M{"_id": docID})
+}
+
+func (m *MongoInvoices) ByOrder(ctx context.Context, orderID string) (*InvoiceEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	return m.findOne(ctx, "find_by_order", bson.M{"order_id": orderID})
+}
+
+func (m *MongoInvoices) findOne(ctx context.Context, op string, filter bson.M) (*InvoiceEntry, error) {
+	var entry InvoiceEntry
+	start := time.Now()
+	err := m.collection.FindOne(ctx, filter).Decode(&entry)
+	observe("invoices", op, start, err)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvoiceNotFound
+	}
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &entry, nil
+}
+
+// MemoryInvoices keeps invoices in a slice, in number order, and hands out copies
+type MemoryInvoices struct {
+	mu       sync.RWMutex
+	invoices []InvoiceEntry
+}
+
+func NewMemoryInvoices() *MemoryInvoices {
+	return &MemoryInvoices{}
+}
+
+func (m *MemoryInvoices) Insert(ctx context.Context, entry InvoiceEntry, render func(*InvoiceEntry) error) (*InvoiceEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.invoices {
+		if m.invoices[i].OrderID == entry.OrderID {
+			return nil, invoiced(&m.invoices[i])
+		}
+	}
+
+	entry.ID = primitive.NewObjectID().Hex()
+	entry.Numbered(int64(len(m.invoices)) + 1)
+	if err := render(&entry); err != nil {
+		return nil, err
+	}
+
+	m.invoices = append(m.invoices, *copyInvoice(entry))
+
+	return copyInvoice(entry), nil
+}
+
+func (m *MemoryInvoices) GetOne(ctx context.Context, id string) (*InvoiceEntry, error) {
+	return m.find(ctx, func(entry *InvoiceEntry) bool { return entry.ID == id })
+}
+
+func (m *MemoryInvoices) ByOrder(ctx context.Context, orderID string) (*InvoiceEntry, error) {
+	return m.find(ctx, func(entry *InvoiceEntry) bool { return entry.OrderID == orderID })
+}
+
+func (m *MemoryInvoices) find(ctx context.Context, match func(*InvoiceEntry) bool) (*InvoiceEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := range m.invoices {
+		if match(&m.invoices[i]) {
+			return copyInvoice(m.invoices[i]), nil
+		}
+	}
+
+	return nil, ErrInvoiceNotFound
+}
+
+func invoiced(existing *InvoiceEntry) error {
+	return fmt.Errorf("%w: the order is already invoiced as %s", ErrStatus, existing.Number)
+}
+
+// copyInvoice copies the lines and documents, so that callers can't change a stored invoice
+func copyInvoice(entry InvoiceEntry) *InvoiceEntry {
+	entry.Lines = append([]InvoiceLine(nil), entry.Lines...)
+	if entry.BillTo != nil {
+		bill := BillTo{
+			Lines:  append([]string(nil), entry.BillTo.Lines...),
+			TaxIDs: append([]TaxID(nil), entry.BillTo.TaxIDs...),
+		}
+		entry.BillTo = &bill
+	}
+
+	documents := make([]Document, len(entry.Documents))
+	for i, doc := range entry.Documents {
+		doc.Data = append([]byte(nil), doc.Data...)
+		documents[i] = doc
+	}
+	entry.Documents = documents
+
+	return &entry
+}
@@ -0,0 +1,171 @@
+package data
+
+import (
+	"context"
+	"order-service/pricing"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryOrders keeps orders in a map. It is safe for concurrent use and hands out
+// copies, so callers can't change stored orders behind its back.
+type MemoryOrders struct {
+	mu     sync.RWMutex
+	orders map[string]OrderEntry
+}
+
+func NewMemoryOrders() *MemoryOrders {
+	return &MemoryOrders{orders: make(map[string]OrderEntry)}
+}
+
+func (m *MemoryOrders) Insert(ctx context.Context, entry OrderEntry) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	if entry.ID == "" {
+		entry.ID = primitive.NewObjectID().Hex()
+	}
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+	entry.Version = 0
+
+	m.orders[entry.ID] = *copyOrder(entry)
+
+	return entry.ID, nil
+}
+
+// All returns every order, newest first
+func (m *MemoryOrders) All(ctx context.Context) ([]*OrderEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	orders := make([]*OrderEntry, 0, len(m.orders))
+	for _, order := range m.orders {
+		orders = append(orders, copyOrder(order))
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].ID > orders[j].ID
+		}
+		return orders[i].CreatedAt.After(orders[j].CreatedAt)
+	})
+
+	return orders, nil
+}
+
+func (m *MemoryOrders) GetOne(ctx context.Context, id string) (*OrderEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	order, ok := m.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyOrder(order), nil
+}
+
+func (m *MemoryOrders) Update(ctx context.Context, entry OrderEntry) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[entry.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Version != entry.Version {
+		return ErrConflict
+	}
+
+	order.ClientID = entry.ClientID
+	order.OrderDate = entry.OrderDate
+	order.Status = entry.Status
+	order.TotalPrice = entry.TotalPrice
+	order.Items = append([]OrderItem(nil), entry.Items...)
+	order.CancelReason = entry.CancelReason
+	order.CancelledAt = entry.CancelledAt
+	order.Cancellations = append([]Cancellation(nil), entry.Cancellations...)
+	order.PickListID = entry.PickListID
+	order.AllocationAttempts = entry.AllocationAttempts
+	order.Backorders = append([]string(nil), entry.Backorders...)
+	order.Version++
+	order.UpdatedAt = time.Now()
+
+	m.orders[entry.ID] = order
+
+	return nil
+}
+
+func (m *MemoryOrders) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, order := range m.orders {
+		counts[order.Status]++
+	}
+
+	return counts, nil
+}
+
+func (m *MemoryOrders) DropCollection(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.orders = make(map[string]OrderEntry)
+
+	return nil
+}
+
+// copyOrder copies an order along with its items and pricing
+func copyOrder(order OrderEntry) *OrderEntry {
+	order.Items = append([]OrderItem(nil), order.Items...)
+	order.Cancellations = append([]Cancellation(nil), order.Cancellations...)
+	order.PromotionCodes = append([]string(nil), order.PromotionCodes...)
+	order.Backorders = append([]string(nil), order.Backorders...)
+	if order.ShippingAddress != nil {
+		shipping := *order.ShippingAddress
+		order.ShippingAddress = &shipping
+	}
+	if order.BillingAddress != nil {
+		billing := *order.BillingAddress
+		order.BillingAddress = &billing
+	}
+	if order.Pricing != nil {
+		breakdown := *order.Pricing
+		breakdown.Lines = append([]pricing.LinePrice(nil), breakdown.Lines...)
+		breakdown.Promotions = append([]pricing.Applied(nil), breakdown.Promotions...)
+		order.Pricing = &breakdown
+	}
+	return &order
+}
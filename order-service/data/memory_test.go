@@ -0,0 +1,114 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemoryOrdersUpdateIsOptimistic(t *testing.T) {
+	ctx := context.Background()
+	orders := NewMemoryOrders()
+
+	id, err := orders.Insert(ctx, OrderEntry{ClientID: 1, Status: StatusPending, Items: []OrderItem{{ProductID: "p", Quantity: 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := orders.GetOne(ctx, id)
+	second, _ := orders.GetOne(ctx, id)
+
+	first.Status = StatusAllocated
+	if err := orders.Update(ctx, *first); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+
+	second.Status = StatusCancelled
+	if err := orders.Update(ctx, *second); !errors.Is(err, ErrConflict) {
+		t.Errorf("update of a stale copy: %v, want ErrConflict", err)
+	}
+
+	stored, _ := orders.GetOne(ctx, id)
+	if stored.Status != StatusAllocated {
+		t.Errorf("status = %q, want %q", stored.Status, StatusAllocated)
+	}
+
+	if err := orders.Update(ctx, OrderEntry{ID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update of a missing order: %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryOrdersHandOutCopies(t *testing.T) {
+	ctx := context.Background()
+	orders := NewMemoryOrders()
+
+	id, err := orders.Insert(ctx, OrderEntry{ClientID: 1, Items: []OrderItem{{ProductID: "p", Quantity: 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order, _ := orders.GetOne(ctx, id)
+	order.Items[0].Quantity = 99
+
+	stored, _ := orders.GetOne(ctx, id)
+	if stored.Items[0].Quantity != 2 {
+		t.Errorf("changing a returned order changed the stored one")
+	}
+}
+
+func TestMemoryCustomersNumbering(t *testing.T) {
+	ctx := context.Background()
+	customers := NewMemoryCustomers()
+
+	legacy, err := customers.Insert(ctx, CustomerEntry{ID: 7, Name: "Legacy", Email: "legacy@example.com"})
+	if err != nil || legacy.ID != 7 {
+		t.Fatalf("insert with an id: %v, %v", legacy, err)
+	}
+
+	next, err := customers.Insert(ctx, CustomerEntry{Name: "Next", Email: "next@example.com"})
+	if err != nil || next.ID != 8 {
+		t.Fatalf("insert without an id: %v, %v; want id 8", next, err)
+	}
+
+	if _, err := customers.Insert(ctx, CustomerEntry{ID: 7, Name: "Again", Email: "again@example.com"}); !errors.Is(err, ErrCustomerExists) {
+		t.Errorf("taken id: %v, want ErrCustomerExists", err)
+	}
+	if _, err := customers.Insert(ctx, CustomerEntry{Name: "Twin", Email: "next@example.com"}); !errors.Is(err, ErrCustomerExists) {
+		t.Errorf("taken email: %v, want ErrCustomerExists", err)
+	}
+}
+
+func TestMemoryOrdersUpdateChecksVersion(t *testing.T) {
+	ctx := context.Background()
+	orders := NewMemoryOrders()
+
+	id, err := orders.Insert(ctx, OrderEntry{ClientID: 1, Status: StatusPending, Version: 5, Items: []OrderItem{{ProductID: "p", Quantity: 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order, _ := orders.GetOne(ctx, id)
+	if order.Version != 0 {
+		t.Fatalf("a new order is at version %d, want 0", order.Version)
+	}
+
+	for want := 1; want <= 2; want++ {
+		if err := orders.Update(ctx, *order); err != nil {
+			t.Fatalf("update %d: %v", want, err)
+		}
+
+		order, _ = orders.GetOne(ctx, id)
+		if order.Version != want {
+			t.Errorf("version = %d, want %d", order.Version, want)
+		}
+	}
+
+	// an update made within the same instant as the read is still told apart
+	stale := *order
+	if err := orders.Update(ctx, *order); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.Update(ctx, stale); !errors.Is(err, ErrConflict) {
+		t.Errorf("update at an old version: %v, want ErrConflict", err)
+	}
+}
@@ -0,0 +1,32 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var dbOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_operation_duration_seconds",
+	Help:    "Time taken by mongo operations, by collection, operation and outcome.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 15},
+}, []string{"collection", "operation", "outcome"})
+
+// observe records how long a database operation that started at start took
+func observe(collection, operation string, start time.Time, err error) {
+	outcome := "ok"
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+		outcome = "timeout"
+	case errors.Is(err, context.Canceled):
+		outcome = "canceled"
+	case err != nil:
+		outcome = "error"
+	}
+
+	dbOperationDuration.WithLabelValues(collection, operation, outcome).Observe(time.Since(start).Seconds())
+}
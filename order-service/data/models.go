@@ -2,7 +2,9 @@ package data
 
 import (
 	"context"
-	"log"
+	"idempotency"
+	"log/slog"
+	"order-service/pricing"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -11,18 +13,59 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var client *mongo.Client
+// OrderRepository is the storage the order service needs. MongoOrders keeps orders in
+// mongo; MemoryOrders keeps them in memory, for tests and local demos. Every method
+// gives up once ctx is done, returning ErrTimeout when its deadline passed.
+type OrderRepository interface {
+	// Insert stores a new order and returns its id, the one it was given if any
+	Insert(ctx context.Context, entry OrderEntry) (string, error)
+	All(ctx context.Context) ([]*OrderEntry, error)
+	GetOne(ctx context.Context, id string) (*OrderEntry, error)
+	Find(ctx context.Context, filter OrderFilter) (OrderPage, error)
+	Update(ctx context.Context, entry OrderEntry) error
+	CountByStatus(ctx context.Context) (map[string]int64, error)
+	DropCollection(ctx context.Context) error
+}
 
-func New(mongo *mongo.Client) Models {
-	client = mongo
+// New returns models backed by the given mongo database
+func New(client *mongo.Client, database string) Models {
+	db := client.Database(database)
 
 	return Models{
-		OrderEntry: OrderEntry{},
+		Orders:      NewMongoOrders(db),
+		Returns:     NewMongoReturns(db),
+		PickLists:   NewMongoPickLists(db),
+		Shipments:   NewMongoShipments(db),
+		Invoices:    NewMongoInvoices(db),
+		Customers:   NewMongoCustomers(db),
+		Idempotency: idempotency.NewMongoStore(db.Collection("idempotency_keys"), dbTimeout, idempotency.Hooks{Observe: observe, Wrap: wrapErr}),
 	}
 }
 
+// NewMemory returns models that keep everything in memory
+func NewMemory() Models {
+	return Models{
+		Orders:      NewMemoryOrders(),
+		Returns:     NewMemoryReturns(),
+		PickLists:   NewMemoryPickLists(),
+		Shipments:   NewMemoryShipments(),
+		Invoices:    NewMemoryInvoices(),
+		Customers:   NewMemoryCustomers(),
+		Idempotency: idempotency.NewMemoryStore(),
+	}
+}
+
+// dbTimeout caps every mongo operation; a shorter deadline on the caller's context wins
+const dbTimeout = 15 * time.Second
+
 type Models struct {
-	OrderEntry OrderEntry
+	Orders      OrderRepository
+	Returns     ReturnRepository
+	PickLists   PickListRepository
+	Shipments   ShipmentRepository
+	Invoices    InvoiceRepository
+	Customers   CustomerRepository
+	Idempotency idempotency.Store
 }
 
 type OrderItem struct {
@@ -30,6 +73,15 @@ type OrderItem struct {
     ProductName  string  `bson:"product_name" json:"product_name"`
     ProductPrice float32 `bson:"product_price" json:"product_price"`
     Quantity     int     `bson:"quantity" json:"quantity"`
+    // Category picks the tax rules and promotions that apply to the line
+    Category     string  `bson:"category,omitempty" json:"category,omitempty"`
+    CancelledQuantity int `bson:"cancelled_quantity,omitempty" json:"cancelled_quantity,omitempty"`
+    // Location is the bin the line is picked from, known once the order is allocated
+    Location  string `bson:"location,omitempty" json:"location,omitempty"`
+    Allocated int    `bson:"allocated,omitempty" json:"allocated,omitempty"`
+    Picked    int    `bson:"picked,omitempty" json:"picked,omitempty"`
+    // Backordered counts the units split off into a backorder because they were out of stock
+    Backordered int `bson:"backordered,omitempty" json:"backordered,omitempty"`
 }
 
 
@@ -40,44 +92,112 @@ type OrderEntry struct {
     Status      string      `bson:"status" json:"status"`
     TotalPrice  float32     `bson:"total_price" json:"total_price"`
     Items       []OrderItem `bson:"items" json:"items"`
+    Destination    pricing.Destination `bson:"destination,omitempty" json:"destination,omitempty"`
+    PromotionCodes []string            `bson:"promotion_codes,omitempty" json:"promotion_codes,omitempty"`
+    // ShippingAddress and BillingAddress are copied from the customer when the order is
+    // placed, so that later changes to the customer don't move it
+    ShippingAddress *Address `bson:"shipping_address,omitempty" json:"shipping_address,omitempty"`
+    BillingAddress  *Address `bson:"billing_address,omitempty" json:"billing_address,omitempty"`
+    // Pricing is how TotalPrice came about when the order was placed; orders placed before
+    // orders were priced have none
+    Pricing     *pricing.Breakdown `bson:"pricing,omitempty" json:"pricing,omitempty"`
+    RequestID   string      `bson:"request_id,omitempty" json:"request_id,omitempty"`
+    CancelReason  string         `bson:"cancel_reason,omitempty" json:"cancel_reason,omitempty"`
+    CancelledAt   *time.Time     `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+    Cancellations []Cancellation `bson:"cancellations,omitempty" json:"cancellations,omitempty"`
+    PickListID    string         `bson:"pick_list_id,omitempty" json:"pick_list_id,omitempty"`
+    // AllocationAttempts counts the attempts to reserve the order's stock; each one is
+    // claimed on the order before the inventory is asked, which tells the attempts apart
+    AllocationAttempts int `bson:"allocation_attempts,omitempty" json:"allocation_attempts,omitempty"`
+    // BackorderOf is the order a backorder was split off from; Backorders are the ones
+    // split off from this order
+    BackorderOf string   `bson:"backorder_of,omitempty" json:"backorder_of,omitempty"`
+    Backorders  []string `bson:"backorders,omitempty" json:"backorders,omitempty"`
+    // Version counts the updates of the order; an update only applies to the version it
+    // was read at. Orders stored before it was kept have none, which reads as 0.
+    Version     int         `bson:"version" json:"version"`
     CreatedAt   time.Time   `bson:"created_at" json:"created_at"`
     UpdatedAt   time.Time   `bson:"updated_at" json:"updated_at"`
 }
 
 
-func (l *OrderEntry) Insert(entry OrderEntry) error {
-	collection := client.Database("warehouse").Collection("orders")
+// MongoOrders stores orders in the orders collection
+type MongoOrders struct {
+	collection *mongo.Collection
+}
+
+func NewMongoOrders(db *mongo.Database) *MongoOrders {
+	return &MongoOrders{collection: db.Collection("orders")}
+}
+
+func (m *MongoOrders) Insert(ctx context.Context, entry OrderEntry) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
 
-	_, err := collection.InsertOne(context.TODO(), OrderEntry{
+	collection := m.collection
+
+	doc := OrderEntry{
 		ClientID: entry.ClientID,
 		OrderDate: entry.OrderDate,
 		Status: entry.Status,
 		TotalPrice: entry.TotalPrice,
 		Items: entry.Items,
+		Destination: entry.Destination,
+		PromotionCodes: entry.PromotionCodes,
+		ShippingAddress: entry.ShippingAddress,
+		BillingAddress: entry.BillingAddress,
+		Pricing: entry.Pricing,
+		RequestID: entry.RequestID,
+		BackorderOf: entry.BackorderOf,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-	})
+	}
+
+	// the id is given here rather than by mongo so that it can be returned; an order given
+	// an id, such as a backorder, keeps it. Either way it is stored as an object id.
+	if entry.ID == "" {
+		entry.ID = NewOrderID()
+	}
+	docID, err := primitive.ObjectIDFromHex(entry.ID)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	raw, err := bson.Marshal(doc)
 	if err != nil {
-		log.Println("Error inserting into orders:", err)
-		return err
+		return "", err
+	}
+	var insert bson.M
+	if err := bson.Unmarshal(raw, &insert); err != nil {
+		return "", err
 	}
+	insert["_id"] = docID
 
-	return nil
+	start := time.Now()
+	_, err = collection.InsertOne(ctx, insert)
+	observe("orders", "insert", start, err)
+	if err != nil {
+		slog.Error("inserting into orders", "error", err)
+		return "", wrapErr(err)
+	}
+
+	return entry.ID, nil
 }
 
-func (l *OrderEntry) All() ([]*OrderEntry, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (m *MongoOrders) All(ctx context.Context) ([]*OrderEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	collection := client.Database("warehouse").Collection("orders")
+	collection := m.collection
 
 	opts := options.Find()
-	opts.SetSort(bson.D{{"created_at", -1}})
+	opts.SetSort(bson.D{{Key: "created_at", Value: -1}})
 
-	cursor, err := collection.Find(context.TODO(), bson.D{}, opts)
+	start := time.Now()
+	cursor, err := collection.Find(ctx, bson.D{}, opts)
+	observe("orders", "find_all", start, err)
 	if err != nil {
-		log.Println("Finding all docs error:", err)
-		return nil, err
+		slog.Error("finding all orders", "error", err)
+		return nil, wrapErr(err)
 	}
 	defer cursor.Close(ctx)
 
@@ -88,78 +208,152 @@ func (l *OrderEntry) All() ([]*OrderEntry, error) {
 
 		err := cursor.Decode(&item)
 		if err != nil {
-			log.Print("Error decoding product into slice:", err)
-			return nil, err
+			slog.Error("decoding order", "error", err)
+			return nil, wrapErr(err)
 		} else {
 			logs = append(logs, &item)
 		}
 	}
 
+	if err := cursor.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
 	return logs, nil
 }
 
-func (l *OrderEntry) GetOne(id string) (*OrderEntry, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (m *MongoOrders) GetOne(ctx context.Context, id string) (*OrderEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	collection := client.Database("warehouse").Collection("orders")
+	collection := m.collection
 
 	docID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return nil, ErrNotFound
 	}
 
 	var entry OrderEntry
+	start := time.Now()
 	err = collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&entry)
+	observe("orders", "find_one", start, err)
 	if err != nil {
-		return nil, err
+		return nil, wrapErr(err)
 	}
 
 	return &entry, nil
 }
 
-func (l *OrderEntry) DropCollection() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+// CountByStatus counts the orders in each status
+func (m *MongoOrders) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	collection := client.Database("warehouse").Collection("orders")
+	collection := m.collection
 
-	if err := collection.Drop(ctx); err != nil {
-		return err
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$status"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
 	}
 
-	return nil
+	start := time.Now()
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	observe("orders", "count_by_status", start, err)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[string]int64)
+
+	for cursor.Next(ctx) {
+		var row struct {
+			Status string `bson:"_id"`
+			Count  int64  `bson:"count"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, wrapErr(err)
+		}
+		counts[row.Status] = row.Count
+	}
+
+	return counts, wrapErr(cursor.Err())
 }
 
-func (l *OrderEntry) Update() (*mongo.UpdateResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func (m *MongoOrders) DropCollection(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
 	defer cancel()
 
-	collection := client.Database("warehouse").Collection("orders")
+	collection := m.collection
+
+	start := time.Now()
+	err := collection.Drop(ctx)
+	observe("orders", "drop", start, err)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	return nil
+}
+
+// Update replaces the stored fields of the order with entry.ID. entry must have been read
+// at its current Version: when the order changed since, ErrConflict is returned and
+// nothing is written.
+func (m *MongoOrders) Update(ctx context.Context, entry OrderEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
 
-	docID, err := primitive.ObjectIDFromHex(l.ID)
+	docID, err := primitive.ObjectIDFromHex(entry.ID)
 	if err != nil {
-		return nil, err
+		return ErrNotFound
 	}
 
-	result, err := collection.UpdateOne(
+	// orders stored before versions were kept have no version field, which matches 0
+	version := any(entry.Version)
+	if entry.Version == 0 {
+		version = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	start := time.Now()
+	result, err := m.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": docID},
+		bson.M{"_id": docID, "version": version},
 		bson.D{
-			{"$set", bson.D{
-				{"client_id", l.ClientID},
-				{"order_date", l.OrderDate},
-				{"status", l.Status},
-				{"total_price", l.TotalPrice},
-				{"items", l.Items},
-				{"updated_at", time.Now()},
+			{Key: "$set", Value: bson.D{
+				{Key: "client_id", Value: entry.ClientID},
+				{Key: "order_date", Value: entry.OrderDate},
+				{Key: "status", Value: entry.Status},
+				{Key: "total_price", Value: entry.TotalPrice},
+				{Key: "items", Value: entry.Items},
+				{Key: "cancel_reason", Value: entry.CancelReason},
+				{Key: "cancelled_at", Value: entry.CancelledAt},
+				{Key: "cancellations", Value: entry.Cancellations},
+				{Key: "pick_list_id", Value: entry.PickListID},
+				{Key: "allocation_attempts", Value: entry.AllocationAttempts},
+				{Key: "backorders", Value: entry.Backorders},
+				{Key: "updated_at", Value: time.Now()},
 			}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
 		},
 	)
-
+	observe("orders", "update", start, err)
 	if err != nil {
-		return nil, err
+		return wrapErr(err)
 	}
 
-	return result, nil
-}
\ No newline at end of file
+	if result.MatchedCount == 0 {
+		// tell a missing order from one that changed under us
+		n, err := m.collection.CountDocuments(ctx, bson.M{"_id": docID})
+		if err != nil {
+			return wrapErr(err)
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+
+	return nil
+}
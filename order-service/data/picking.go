@@ -0,0 +1,283 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Pick list statuses. A pick list is open while pickers work through it, confirmed once
+// they reported what they picked and completed once every order on it was updated and
+// the inventory took the picked units off the shelf.
+const (
+	PickListOpen      = "open"
+	PickListConfirmed = "confirmed"
+	PickListCompleted = "completed"
+)
+
+// ShortPickReason is recorded with the cancellation of units a picker didn't find
+const ShortPickReason = "short pick"
+
+// PickList is the warehouse work for a batch of allocated orders. Stops are sorted by
+// location, so that a picker walks the warehouse once.
+type PickList struct {
+	ID          string          `bson:"_id,omitempty" json:"id,omitempty"`
+	Status      string          `bson:"status" json:"status"`
+	Stops       []PickStop      `bson:"stops" json:"stops"`
+	Orders      []PickListOrder `bson:"orders" json:"orders"`
+	RequestID   string          `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	ConfirmedAt *time.Time      `bson:"confirmed_at,omitempty" json:"confirmed_at,omitempty"`
+	CompletedAt *time.Time      `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	CreatedAt   time.Time       `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time       `bson:"updated_at" json:"updated_at"`
+}
+
+// PickStop is every line picked from one location
+type PickStop struct {
+	Location string     `bson:"location" json:"location"`
+	Lines    []PickLine `bson:"lines" json:"lines"`
+}
+
+// PickLine is one order line to pick. Picked is known once the list is confirmed.
+type PickLine struct {
+	OrderID     string `bson:"order_id" json:"order_id"`
+	Line        int    `bson:"line" json:"line"`
+	ProductID   string `bson:"product_id" json:"product_id"`
+	ProductName string `bson:"product_name" json:"product_name"`
+	Quantity    int    `bson:"quantity" json:"quantity"`
+	Picked      int    `bson:"picked" json:"picked"`
+}
+
+// PickListOrder follows one order of the list. Posted is set once the order was moved
+// on and the inventory took its picked units off the shelf.
+type PickListOrder struct {
+	OrderID string `bson:"order_id" json:"order_id"`
+	Posted  bool   `bson:"posted" json:"posted"`
+}
+
+// PickConfirmation is the number of units picked for one line of an order
+type PickConfirmation struct {
+	OrderID string `json:"order_id"`
+	Line    int    `json:"line"`
+	Picked  int    `json:"picked"`
+}
+
+// LineAllocation is the stock reserved for one line of an order
+type LineAllocation struct {
+	Line     int
+	Location string
+	Quantity int
+}
+
+// Allocatable reports whether stock can be reserved for the order
+func (o *OrderEntry) Allocatable() error {
+	switch o.Status {
+	case StatusAllocated, StatusPicking, StatusPicked, StatusPacked, StatusShipped, StatusDelivered, StatusCancelled:
+		return fmt.Errorf("%w: only pending and backordered orders can be allocated, the order is %s", ErrStatus, o.Status)
+	}
+
+	if o.openUnits() == 0 {
+		return fmt.Errorf("%w: the order has no open units", ErrInvalid)
+	}
+
+	return nil
+}
+
+// Allocate records the stock reserved for the order's lines and where to pick it from
+func (o *OrderEntry) Allocate(allocations []LineAllocation) error {
+	if err := o.Allocatable(); err != nil {
+		return err
+	}
+
+	for _, a := range allocations {
+		if a.Line < 0 || a.Line >= len(o.Items) {
+			return fmt.Errorf("%w: the order has no line %d", ErrInvalid, a.Line)
+		}
+		o.Items[a.Line].Location = a.Location
+		o.Items[a.Line].Allocated = a.Quantity
+	}
+
+	o.Status = StatusAllocated
+
+	return nil
+}
+
+// ConfirmPick records what was picked for the order's lines. Units that weren't found are
+// cancelled; their reservation goes with the picked units, so there is nothing left to
+// release. The order is picked, or cancelled when nothing at all was found.
+func (o *OrderEntry) ConfirmPick(lines []PickLine, now time.Time) ([]Cancellation, error) {
+	if o.Status != StatusPicking {
+		return nil, fmt.Errorf("%w: only orders being picked can be confirmed, the order is %s", ErrStatus, o.Status)
+	}
+
+	var cancelled []Cancellation
+	for _, line := range lines {
+		if line.Line < 0 || line.Line >= len(o.Items) {
+			return nil, fmt.Errorf("%w: the order has no line %d", ErrInvalid, line.Line)
+		}
+
+		if short := o.Items[line.Line].Open() - line.Picked; short > 0 {
+			c := o.cancelLine(line.Line, short, ShortPickReason, now)
+			o.Cancellations[len(o.Cancellations)-1].Released = true
+			c.Released = true
+			cancelled = append(cancelled, c)
+		}
+
+		o.Items[line.Line].Picked = line.Picked
+		o.Items[line.Line].Allocated = 0
+	}
+
+	o.Status = StatusPicked
+	if o.openUnits() == 0 {
+		o.Status = StatusCancelled
+		o.CancelReason = ShortPickReason
+		o.CancelledAt = &now
+	}
+	o.Recalculate()
+
+	return cancelled, nil
+}
+
+// NewPickList builds the pick list for allocated orders, grouping their open lines by
+// location
+func NewPickList(orders []*OrderEntry, now time.Time) (PickList, error) {
+	if len(orders) == 0 {
+		return PickList{}, fmt.Errorf("%w: a pick list needs at least one order", ErrInvalid)
+	}
+
+	list := PickList{
+		Status:    PickListOpen,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	stops := make(map[string]*PickStop)
+	for _, order := range orders {
+		if order.Status != StatusAllocated {
+			return PickList{}, fmt.Errorf("%w: order %s is %s, only allocated orders can be picked", ErrStatus, order.ID, order.Status)
+		}
+
+		list.Orders = append(list.Orders, PickListOrder{OrderID: order.ID})
+
+		for i, item := range order.Items {
+			if item.Open() == 0 {
+				continue
+			}
+
+			stop, ok := stops[item.Location]
+			if !ok {
+				stop = &PickStop{Location: item.Location}
+				stops[item.Location] = stop
+			}
+
+			stop.Lines = append(stop.Lines, PickLine{
+				OrderID:     order.ID,
+				Line:        i,
+				ProductID:   item.ProductID,
+				ProductName: item.ProductName,
+				Quantity:    item.Open(),
+			})
+		}
+	}
+
+	for _, stop := range stops {
+		sort.SliceStable(stop.Lines, func(i, j int) bool {
+			return stop.Lines[i].ProductID < stop.Lines[j].ProductID
+		})
+		list.Stops = append(list.Stops, *stop)
+	}
+
+	// lines without a location sort first, so that they stand out
+	sort.Slice(list.Stops, func(i, j int) bool {
+		return list.Stops[i].Location < list.Stops[j].Location
+	})
+
+	return list, nil
+}
+
+// Confirm records the picked units of every line. Lines left out were picked in full.
+func (p *PickList) Confirm(confirmations []PickConfirmation, now time.Time) error {
+	if p.Status != PickListOpen {
+		return fmt.Errorf("%w: the pick list is already %s", ErrStatus, p.Status)
+	}
+
+	type lineKey struct {
+		order string
+		line  int
+	}
+
+	picked := make(map[lineKey]int, len(confirmations))
+	for _, c := range confirmations {
+		key := lineKey{c.OrderID, c.Line}
+		if _, ok := picked[key]; ok {
+			return fmt.Errorf("%w: line %d of order %s is listed twice", ErrInvalid, c.Line, c.OrderID)
+		}
+
+		line := p.line(c.OrderID, c.Line)
+		if line == nil {
+			return fmt.Errorf("%w: the pick list has no line %d of order %s", ErrInvalid, c.Line, c.OrderID)
+		}
+		if c.Picked < 0 || c.Picked > line.Quantity {
+			return fmt.Errorf("%w: line %d of order %s was to pick %d units, can't confirm %d", ErrInvalid, c.Line, c.OrderID, line.Quantity, c.Picked)
+		}
+
+		picked[key] = c.Picked
+	}
+
+	for i := range p.Stops {
+		for j := range p.Stops[i].Lines {
+			line := &p.Stops[i].Lines[j]
+			line.Picked = line.Quantity
+			if n, ok := picked[lineKey{line.OrderID, line.Line}]; ok {
+				line.Picked = n
+			}
+		}
+	}
+
+	p.Status = PickListConfirmed
+	p.ConfirmedAt = &now
+
+	return nil
+}
+
+// OrderLines returns the lines of the list that belong to one order
+func (p *PickList) OrderLines(orderID string) []PickLine {
+	var lines []PickLine
+	for _, stop := range p.Stops {
+		for _, line := range stop.Lines {
+			if line.OrderID == orderID {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	return lines
+}
+
+// Posted marks the order as moved on, and completes the list once every order is
+func (p *PickList) Posted(orderID string, now time.Time) {
+	done := true
+	for i := range p.Orders {
+		if p.Orders[i].OrderID == orderID {
+			p.Orders[i].Posted = true
+		}
+		done = done && p.Orders[i].Posted
+	}
+
+	if done {
+		p.Status = PickListCompleted
+		p.CompletedAt = &now
+	}
+}
+
+func (p *PickList) line(orderID string, index int) *PickLine {
+	for i := range p.Stops {
+		for j := range p.Stops[i].Lines {
+			if line := &p.Stops[i].Lines[j]; line.OrderID == orderID && line.Line == index {
+				return line
+			}
+		}
+	}
+
+	return nil
+}
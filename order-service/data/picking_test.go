@@ -0,0 +1,285 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var pickTime = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// storedOrder inserts order into a memory store and returns the stored copy
+func storedOrder(t *testing.T, orders *MemoryOrders, order OrderEntry) *OrderEntry {
+	t.Helper()
+
+	ctx := context.Background()
+	id, err := orders.Insert(ctx, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := orders.GetOne(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stored
+}
+
+func TestAllocatable(t *testing.T) {
+	tests := []struct {
+		status string
+		items  []OrderItem
+		want   error
+	}{
+		{StatusPending, []OrderItem{{ProductID: "p", Quantity: 2}}, nil},
+		{StatusBackordered, []OrderItem{{ProductID: "p", Quantity: 2}}, nil},
+		{StatusPending, []OrderItem{{ProductID: "p", Quantity: 2, CancelledQuantity: 2}}, ErrInvalid},
+		{StatusAllocated, []OrderItem{{ProductID: "p", Quantity: 2}}, ErrStatus},
+		{StatusPicking, []OrderItem{{ProductID: "p", Quantity: 2}}, ErrStatus},
+		{StatusShipped, []OrderItem{{ProductID: "p", Quantity: 2}}, ErrStatus},
+		{StatusCancelled, []OrderItem{{ProductID: "p", Quantity: 2}}, ErrStatus},
+	}
+
+	for _, tt := range tests {
+		order := OrderEntry{Status: tt.status, Items: tt.items}
+		if err := order.Allocatable(); !errors.Is(err, tt.want) {
+			t.Errorf("%s order with %d open units: %v, want %v", tt.status, order.openUnits(), err, tt.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	orders := NewMemoryOrders()
+	order := storedOrder(t, orders, OrderEntry{ClientID: 1, Status: StatusPending, Items: []OrderItem{
+		{ProductID: "a", Quantity: 2},
+		{ProductID: "b", Quantity: 1},
+	}})
+
+	if err := order.Allocate([]LineAllocation{{Line: 2, Location: "A-01", Quantity: 1}}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("allocating a missing line: %v, want ErrInvalid", err)
+	}
+
+	err := order.Allocate([]LineAllocation{
+		{Line: 0, Location: "B-02", Quantity: 2},
+		{Line: 1, Location: "A-01", Quantity: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.Update(context.Background(), *order); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := orders.GetOne(context.Background(), order.ID)
+	if stored.Status != StatusAllocated || stored.Items[0].Location != "B-02" || stored.Items[1].Allocated != 1 {
+		t.Errorf("stored order = %s, lines %+v", stored.Status, stored.Items)
+	}
+}
+
+func TestConfirmPick(t *testing.T) {
+	tests := []struct {
+		name      string
+		picked    []int
+		status    string
+		cancelled []int
+		total     float32
+	}{
+		{"full pick", []int{2, 1}, StatusPicked, []int{0, 0}, 25},
+		{"short pick", []int{1, 1}, StatusPicked, []int{1, 0}, 15},
+		{"a line not found", []int{2, 0}, StatusPicked, []int{0, 1}, 20},
+		{"nothing found", []int{0, 0}, StatusCancelled, []int{2, 1}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders := NewMemoryOrders()
+			order := storedOrder(t, orders, OrderEntry{ClientID: 1, Status: StatusPicking, Items: []OrderItem{
+				{ProductID: "a", ProductPrice: 10, Quantity: 2, Allocated: 2},
+				{ProductID: "b", ProductPrice: 5, Quantity: 1, Allocated: 1},
+			}})
+
+			var lines []PickLine
+			for i, n := range tt.picked {
+				lines = append(lines, PickLine{OrderID: order.ID, Line: i, Picked: n})
+			}
+
+			cancelled, err := order.ConfirmPick(lines, pickTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := orders.Update(context.Background(), *order); err != nil {
+				t.Fatal(err)
+			}
+
+			stored, _ := orders.GetOne(context.Background(), order.ID)
+			if stored.Status != tt.status || stored.TotalPrice != tt.total {
+				t.Errorf("order = %s at %v, want %s at %v", stored.Status, stored.TotalPrice, tt.status, tt.total)
+			}
+
+			short := 0
+			for i, item := range stored.Items {
+				if item.Picked != tt.picked[i] || item.CancelledQuantity != tt.cancelled[i] || item.Allocated != 0 {
+					t.Errorf("line %d = %+v", i, item)
+				}
+				if tt.cancelled[i] > 0 {
+					short++
+				}
+			}
+
+			// short units leave with the picked ones, there is nothing to release
+			if len(cancelled) != short || len(stored.Cancellations) != short {
+				t.Fatalf("cancelled %+v, stored %+v, want %d", cancelled, stored.Cancellations, short)
+			}
+			for _, c := range stored.Cancellations {
+				if c.Reason != ShortPickReason || !c.Released {
+					t.Errorf("cancellation = %+v", c)
+				}
+			}
+		})
+	}
+
+	order := OrderEntry{Status: StatusAllocated, Items: []OrderItem{{ProductID: "a", Quantity: 1}}}
+	if _, err := order.ConfirmPick(nil, pickTime); !errors.Is(err, ErrStatus) {
+		t.Errorf("confirming an order that isn't being picked: %v, want ErrStatus", err)
+	}
+}
+
+func TestNewPickList(t *testing.T) {
+	orders := []*OrderEntry{
+		{ID: "o1", Status: StatusAllocated, Items: []OrderItem{
+			{ProductID: "b", Quantity: 1, Location: "B-02"},
+			{ProductID: "a", Quantity: 2, Location: "A-01"},
+			{ProductID: "c", Quantity: 1, CancelledQuantity: 1, Location: "A-01"},
+		}},
+		{ID: "o2", Status: StatusAllocated, Items: []OrderItem{
+			{ProductID: "a", Quantity: 3, Backordered: 1, Location: "B-02"},
+		}},
+	}
+
+	list, err := NewPickList(orders, pickTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PickStop{
+		{Location: "A-01", Lines: []PickLine{{OrderID: "o1", Line: 1, ProductID: "a", Quantity: 2}}},
+		{Location: "B-02", Lines: []PickLine{
+			{OrderID: "o2", Line: 0, ProductID: "a", Quantity: 2},
+			{OrderID: "o1", Line: 0, ProductID: "b", Quantity: 1},
+		}},
+	}
+
+	if list.Status != PickListOpen || len(list.Orders) != 2 || len(list.Stops) != len(want) {
+		t.Fatalf("pick list = %+v", list)
+	}
+	for i := range want {
+		if list.Stops[i].Location != want[i].Location || len(list.Stops[i].Lines) != len(want[i].Lines) {
+			t.Fatalf("stop %d = %+v, want %+v", i, list.Stops[i], want[i])
+		}
+		for j := range want[i].Lines {
+			if list.Stops[i].Lines[j] != want[i].Lines[j] {
+				t.Errorf("stop %d line %d = %+v, want %+v", i, j, list.Stops[i].Lines[j], want[i].Lines[j])
+			}
+		}
+	}
+
+	if _, err := NewPickList(nil, pickTime); !errors.Is(err, ErrInvalid) {
+		t.Errorf("empty pick list: %v, want ErrInvalid", err)
+	}
+
+	pending := []*OrderEntry{{ID: "o3", Status: StatusPending, Items: []OrderItem{{ProductID: "a", Quantity: 1}}}}
+	if _, err := NewPickList(pending, pickTime); !errors.Is(err, ErrStatus) {
+		t.Errorf("pick list of a pending order: %v, want ErrStatus", err)
+	}
+}
+
+func TestPickListConfirm(t *testing.T) {
+	newList := func() PickList {
+		return PickList{
+			Status: PickListOpen,
+			Stops: []PickStop{
+				{Location: "A-01", Lines: []PickLine{{OrderID: "o1", Line: 0, Quantity: 2}}},
+				{Location: "B-02", Lines: []PickLine{{OrderID: "o1", Line: 1, Quantity: 1}, {OrderID: "o2", Line: 0, Quantity: 3}}},
+			},
+			Orders: []PickListOrder{{OrderID: "o1"}, {OrderID: "o2"}},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		confirmations []PickConfirmation
+		want          error
+		picked        map[string]int
+	}{
+		{"lines left out are picked in full", nil, nil, map[string]int{"o1/0": 2, "o1/1": 1, "o2/0": 3}},
+		{"short lines", []PickConfirmation{{"o1", 0, 1}, {"o2", 0, 0}}, nil, map[string]int{"o1/0": 1, "o1/1": 1, "o2/0": 0}},
+		{"a line twice", []PickConfirmation{{"o1", 0, 1}, {"o1", 0, 2}}, ErrInvalid, nil},
+		{"an unknown line", []PickConfirmation{{"o2", 1, 1}}, ErrInvalid, nil},
+		{"an unknown order", []PickConfirmation{{"o3", 0, 1}}, ErrInvalid, nil},
+		{"more than listed", []PickConfirmation{{"o1", 0, 3}}, ErrInvalid, nil},
+		{"negative", []PickConfirmation{{"o1", 0, -1}}, ErrInvalid, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := newList()
+
+			err := list.Confirm(tt.confirmations, pickTime)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("confirm: %v, want %v", err, tt.want)
+			}
+			if tt.want != nil {
+				if list.Status != PickListOpen {
+					t.Errorf("a refused confirmation left the list %s", list.Status)
+				}
+				return
+			}
+
+			if list.Status != PickListConfirmed || list.ConfirmedAt == nil {
+				t.Errorf("pick list is %s", list.Status)
+			}
+			for _, stop := range list.Stops {
+				for _, line := range stop.Lines {
+					key := fmt.Sprintf("%s/%d", line.OrderID, line.Line)
+					if line.Picked != tt.picked[key] {
+						t.Errorf("%s picked %d, want %d", key, line.Picked, tt.picked[key])
+					}
+				}
+			}
+		})
+	}
+
+	list := newList()
+	list.Status = PickListConfirmed
+	if err := list.Confirm(nil, pickTime); !errors.Is(err, ErrStatus) {
+		t.Errorf("confirming twice: %v, want ErrStatus", err)
+	}
+}
+
+func TestPickListPosted(t *testing.T) {
+	list := PickList{
+		Status: PickListConfirmed,
+		Stops: []PickStop{
+			{Location: "A-01", Lines: []PickLine{{OrderID: "o1", Line: 0, Quantity: 2}, {OrderID: "o2", Line: 0, Quantity: 1}}},
+			{Location: "B-02", Lines: []PickLine{{OrderID: "o1", Line: 1, Quantity: 1}}},
+		},
+		Orders: []PickListOrder{{OrderID: "o1"}, {OrderID: "o2"}},
+	}
+
+	if lines := list.OrderLines("o1"); len(lines) != 2 || lines[0].Line != 0 || lines[1].Line != 1 {
+		t.Errorf("lines of o1 = %+v", lines)
+	}
+
+	list.Posted("o1", pickTime)
+	if list.Status != PickListConfirmed {
+		t.Errorf("list is %s with an order still to post", list.Status)
+	}
+
+	list.Posted("o2", pickTime)
+	if list.Status != PickListCompleted || list.CompletedAt == nil {
+		t.Errorf("list is %s once every order is posted", list.Status)
+	}
+}
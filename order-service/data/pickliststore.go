@@ -0,0 +1,207 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PickListRepository stores pick lists. The id of a pick list is chosen before it is
+// inserted, since its orders are claimed for it first. Like orders, a pick list is only
+// updated when it hasn't changed since it was read; otherwise ErrConflict is returned.
+type PickListRepository interface {
+	Insert(ctx context.Context, list PickList) error
+	GetOne(ctx context.Context, id string) (*PickList, error)
+	Update(ctx context.Context, list PickList) error
+}
+
+// NewPickListID returns an id for a pick list about to be built
+func NewPickListID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// MongoPickLists stores pick lists in the pick_lists collection
+type MongoPickLists struct {
+	collection *mongo.Collection
+}
+
+func NewMongoPickLists(db *mongo.Database) *MongoPickLists {
+	return &MongoPickLists{collection: db.Collection("pick_lists")}
+}
+
+func (m *MongoPickLists) Insert(ctx context.Context, list PickList) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(list.ID)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	// store the id as an object id like every other collection does
+	raw, err := bson.Marshal(list)
+	if err != nil {
+		return err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	doc["_id"] = docID
+
+	start := time.Now()
+	_, err = m.collection.InsertOne(ctx, doc)
+	observe("pick_lists", "insert", start, err)
+
+	return wrapErr(err)
+}
+
+func (m *MongoPickLists) GetOne(ctx context.Context, id string) (*PickList, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrPickListNotFound
+	}
+
+	var list PickList
+	start := time.Now()
+	err = m.collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&list)
+	observe("pick_lists", "find_one", start, err)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrPickListNotFound
+	}
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &list, nil
+}
+
+func (m *MongoPickLists) Update(ctx context.Context, list PickList) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(list.ID)
+	if err != nil {
+		return ErrPickListNotFound
+	}
+
+	start := time.Now()
+	result, err := m.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": docID, "updated_at": list.UpdatedAt},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: list.Status},
+			{Key: "stops", Value: list.Stops},
+			{Key: "orders", Value: list.Orders},
+			{Key: "confirmed_at", Value: list.ConfirmedAt},
+			{Key: "completed_at", Value: list.CompletedAt},
+			{Key: "updated_at", Value: time.Now()},
+		}}},
+	)
+	observe("pick_lists", "update", start, err)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	if result.MatchedCount == 0 {
+		n, err := m.collection.CountDocuments(ctx, bson.M{"_id": docID})
+		if err != nil {
+			return wrapErr(err)
+		}
+		if n == 0 {
+			return ErrPickListNotFound
+		}
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// MemoryPickLists keeps pick lists in a map and hands out copies
+type MemoryPickLists struct {
+	mu    sync.RWMutex
+	lists map[string]PickList
+}
+
+func NewMemoryPickLists() *MemoryPickLists {
+	return &MemoryPickLists{lists: make(map[string]PickList)}
+}
+
+func (m *MemoryPickLists) Insert(ctx context.Context, list PickList) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.lists[list.ID]; ok {
+		return ErrConflict
+	}
+
+	m.lists[list.ID] = *copyPickList(list)
+
+	return nil
+}
+
+func (m *MemoryPickLists) GetOne(ctx context.Context, id string) (*PickList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list, ok := m.lists[id]
+	if !ok {
+		return nil, ErrPickListNotFound
+	}
+
+	return copyPickList(list), nil
+}
+
+func (m *MemoryPickLists) Update(ctx context.Context, list PickList) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.lists[list.ID]
+	if !ok {
+		return ErrPickListNotFound
+	}
+	if !stored.UpdatedAt.Equal(list.UpdatedAt) {
+		return ErrConflict
+	}
+
+	updated := copyPickList(list)
+	updated.RequestID = stored.RequestID
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = time.Now()
+
+	m.lists[list.ID] = *updated
+
+	return nil
+}
+
+// copyPickList copies the stops deeply, so that callers can't change stored lines
+func copyPickList(list PickList) *PickList {
+	stops := make([]PickStop, len(list.Stops))
+	for i, stop := range list.Stops {
+		stops[i] = PickStop{Location: stop.Location, Lines: append([]PickLine(nil), stop.Lines...)}
+	}
+	list.Stops = stops
+	list.Orders = append([]PickListOrder(nil), list.Orders...)
+
+	return &list
+}
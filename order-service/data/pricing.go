@@ -0,0 +1,62 @@
+package data
+
+import (
+	"order-service/pricing"
+)
+
+// PricingOrder is what the pricing engine needs to know about the order
+func (o *OrderEntry) PricingOrder() pricing.Order {
+	order := pricing.Order{
+		ClientID:    o.ClientID,
+		Destination: o.Destination,
+		Codes:       o.PromotionCodes,
+	}
+
+	for _, item := range o.Items {
+		order.Lines = append(order.Lines, pricing.Line{
+			ProductID: item.ProductID,
+			Category:  item.Category,
+			UnitPrice: float64(item.ProductPrice),
+			Quantity:  item.Quantity,
+		})
+	}
+
+	return order
+}
+
+// Priced records the breakdown the order was priced with and takes its total
+func (o *OrderEntry) Priced(breakdown pricing.Breakdown) {
+	o.Pricing = &breakdown
+	o.TotalPrice = breakdown.Total
+}
+
+// LinePrice is the price of units of one line. Orders placed before orders were priced
+// have no discounts, and are taxed at rate.
+func (o *OrderEntry) LinePrice(line, units int, rate float64) pricing.LinePrice {
+	if o.Pricing != nil && line < len(o.Pricing.Lines) {
+		return o.Pricing.Lines[line].Share(units)
+	}
+
+	net := cents(float64(o.Items[line].ProductPrice) * float64(units))
+	tax := cents(float64(net) * rate)
+
+	return pricing.LinePrice{
+		Line:     line,
+		Quantity: units,
+		Subtotal: net,
+		Net:      net,
+		TaxRate:  rate,
+		Tax:      tax,
+		Total:    net + tax,
+	}
+}
+
+// UnitPaid is what the client paid for one unit of the line, after discounts and with tax
+func (o *OrderEntry) UnitPaid(line int) float32 {
+	if o.Pricing != nil && line < len(o.Pricing.Lines) && o.Pricing.Lines[line].Quantity > 0 {
+		price := o.Pricing.Lines[line]
+		return price.Total / float32(price.Quantity)
+	}
+
+	return o.Items[line].ProductPrice
+}
@@ -0,0 +1,185 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// OrderFilter narrows down a search for orders. Zero fields don't filter; From is
+// inclusive and To exclusive. Page counts from 1.
+type OrderFilter struct {
+	ClientID int32
+	Status   string
+	// ProductID keeps the orders with a line of the product
+	ProductID string
+	From      time.Time
+	To        time.Time
+	Page      int
+	PageSize  int
+	// Oldest sorts the oldest order date first instead of the newest
+	Oldest bool
+}
+
+// OrderPage is one page of a search, newest order date first unless the filter asked
+// for the oldest
+type OrderPage struct {
+	Orders   []*OrderEntry `json:"orders"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Total    int64         `json:"total"`
+}
+
+// normalize fills in the default page and clamps the page size
+func (f OrderFilter) normalize() OrderFilter {
+	if f.Page < 1 {
+		f.Page = 1
+	}
+
+	switch {
+	case f.PageSize < 1:
+		f.PageSize = DefaultPageSize
+	case f.PageSize > MaxPageSize:
+		f.PageSize = MaxPageSize
+	}
+
+	return f
+}
+
+// query turns the filter into a mongo query, which the client_id+order_date, status,
+// status+product and order_date indexes can serve
+func (f OrderFilter) query() bson.D {
+	q := bson.D{}
+
+	if f.ClientID != 0 {
+		q = append(q, bson.E{Key: "client_id", Value: f.ClientID})
+	}
+
+	if f.Status != "" {
+		q = append(q, bson.E{Key: "status", Value: f.Status})
+	}
+
+	if f.ProductID != "" {
+		q = append(q, bson.E{Key: "items.product_id", Value: f.ProductID})
+	}
+
+	date := bson.D{}
+	if !f.From.IsZero() {
+		date = append(date, bson.E{Key: "$gte", Value: f.From})
+	}
+	if !f.To.IsZero() {
+		date = append(date, bson.E{Key: "$lt", Value: f.To})
+	}
+	if len(date) > 0 {
+		q = append(q, bson.E{Key: "order_date", Value: date})
+	}
+
+	return q
+}
+
+// matches is query for orders held in memory
+func (f OrderFilter) matches(order OrderEntry) bool {
+	switch {
+	case f.ClientID != 0 && order.ClientID != f.ClientID:
+		return false
+	case f.Status != "" && order.Status != f.Status:
+		return false
+	case f.ProductID != "" && !order.hasProduct(f.ProductID):
+		return false
+	case !f.From.IsZero() && order.OrderDate.Before(f.From):
+		return false
+	case !f.To.IsZero() && !order.OrderDate.Before(f.To):
+		return false
+	}
+
+	return true
+}
+
+// Find returns one page of the orders matching filter and how many match in total
+func (m *MongoOrders) Find(ctx context.Context, filter OrderFilter) (OrderPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	filter = filter.normalize()
+	page := OrderPage{Orders: []*OrderEntry{}, Page: filter.Page, PageSize: filter.PageSize}
+	query := filter.query()
+
+	start := time.Now()
+	total, err := m.collection.CountDocuments(ctx, query)
+	observe("orders", "count", start, err)
+	if err != nil {
+		return page, wrapErr(err)
+	}
+	page.Total = total
+
+	direction := -1
+	if filter.Oldest {
+		direction = 1
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "order_date", Value: direction}, {Key: "_id", Value: direction}}).
+		SetSkip(int64((filter.Page - 1) * filter.PageSize)).
+		SetLimit(int64(filter.PageSize))
+
+	start = time.Now()
+	cursor, err := m.collection.Find(ctx, query, opts)
+	observe("orders", "find", start, err)
+	if err != nil {
+		return page, wrapErr(err)
+	}
+
+	if err := cursor.All(ctx, &page.Orders); err != nil {
+		return page, wrapErr(err)
+	}
+
+	return page, nil
+}
+
+// Find returns one page of the orders matching filter and how many match in total
+func (m *MemoryOrders) Find(ctx context.Context, filter OrderFilter) (OrderPage, error) {
+	filter = filter.normalize()
+	page := OrderPage{Orders: []*OrderEntry{}, Page: filter.Page, PageSize: filter.PageSize}
+
+	if err := ctx.Err(); err != nil {
+		return page, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []*OrderEntry
+	for _, order := range m.orders {
+		if filter.matches(order) {
+			matched = append(matched, copyOrder(order))
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if filter.Oldest {
+			i, j = j, i
+		}
+		if matched[i].OrderDate.Equal(matched[j].OrderDate) {
+			return matched[i].ID > matched[j].ID
+		}
+		return matched[i].OrderDate.After(matched[j].OrderDate)
+	})
+
+	page.Total = int64(len(matched))
+
+	from := (filter.Page - 1) * filter.PageSize
+	if from < len(matched) {
+		to := min(from+filter.PageSize, len(matched))
+		page.Orders = matched[from:to]
+	}
+
+	return page, nil
+}
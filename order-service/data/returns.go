@@ -0,0 +1,255 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Return authorization statuses. A return is authorized against a shipped order, received
+// when the parcel arrives and inspected once every received unit has an outcome.
+const (
+	ReturnAuthorized = "authorized"
+	ReturnReceived   = "received"
+	ReturnInspected  = "inspected"
+)
+
+// ReturnEntry is a return authorization (RMA) for units of one order
+type ReturnEntry struct {
+	ID       string       `bson:"_id,omitempty" json:"id,omitempty"`
+	OrderID  string       `bson:"order_id" json:"order_id"`
+	ClientID int32        `bson:"client_id,omitempty" json:"client_id,omitempty"`
+	Status   string       `bson:"status" json:"status"`
+	Reason   string       `bson:"reason" json:"reason"`
+	Lines    []ReturnLine `bson:"lines" json:"lines"`
+	// RefundAmount is known once the return is inspected
+	RefundAmount float32 `bson:"refund_amount" json:"refund_amount"`
+	// StockReturned is set once the restocked units were added back to the inventory
+	StockReturned bool       `bson:"stock_returned" json:"stock_returned"`
+	RequestID     string     `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	ReceivedAt    *time.Time `bson:"received_at,omitempty" json:"received_at,omitempty"`
+	InspectedAt   *time.Time `bson:"inspected_at,omitempty" json:"inspected_at,omitempty"`
+	CreatedAt     time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time  `bson:"updated_at" json:"updated_at"`
+}
+
+// ReturnLine follows the units of one order line through the return. UnitPrice is what
+// the client paid per unit, after discounts and with tax. Restocked, Refurbished and
+// Scrapped are the inspection outcomes and add up to Received.
+type ReturnLine struct {
+	Line        int     `bson:"line" json:"line"`
+	ProductID   string  `bson:"product_id" json:"product_id"`
+	ProductName string  `bson:"product_name" json:"product_name"`
+	UnitPrice   float32 `bson:"unit_price" json:"unit_price"`
+	Authorized  int     `bson:"authorized" json:"authorized"`
+	Received    int     `bson:"received" json:"received"`
+	Restocked   int     `bson:"restocked" json:"restocked"`
+	Refurbished int     `bson:"refurbished" json:"refurbished"`
+	Scrapped    int     `bson:"scrapped" json:"scrapped"`
+	Refund      float32 `bson:"refund" json:"refund"`
+}
+
+// ReturnQuantity is a number of units of one order line
+type ReturnQuantity struct {
+	Line     int `json:"line"`
+	Quantity int `json:"quantity"`
+}
+
+// Inspection is the outcome for the received units of one order line
+type Inspection struct {
+	Line      int `json:"line"`
+	Restock   int `json:"restock"`
+	Refurbish int `json:"refurbish"`
+	Scrap     int `json:"scrap"`
+}
+
+// RefundPolicy sets the share of the unit price refunded for each inspection outcome.
+// Restocked units are always refunded in full.
+type RefundPolicy struct {
+	Refurbish float64
+	Scrap     float64
+}
+
+// NewReturn authorizes the return of units of order. Only goods that left the warehouse
+// can come back, and no line can have more units on returns than it has open units;
+// others are the order's earlier returns. An earlier return holds the units it was
+// authorized for until it is received, and only the units that arrived after that.
+func NewReturn(order *OrderEntry, others []*ReturnEntry, reason string, quantities []ReturnQuantity, now time.Time) (ReturnEntry, error) {
+	if order.Status != StatusShipped && order.Status != StatusDelivered {
+		return ReturnEntry{}, fmt.Errorf("%w: only shipped or delivered orders can be returned, the order is %s", ErrStatus, order.Status)
+	}
+
+	if err := checkReason(reason); err != nil {
+		return ReturnEntry{}, err
+	}
+
+	if len(quantities) == 0 {
+		return ReturnEntry{}, fmt.Errorf("%w: a return needs at least one line", ErrInvalid)
+	}
+
+	returned := make(map[int]int)
+	for _, other := range others {
+		for _, line := range other.Lines {
+			if other.Status == ReturnAuthorized {
+				returned[line.Line] += line.Authorized
+			} else {
+				returned[line.Line] += line.Received
+			}
+		}
+	}
+
+	ret := ReturnEntry{
+		OrderID:   order.ID,
+		ClientID:  order.ClientID,
+		Status:    ReturnAuthorized,
+		Reason:    reason,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	seen := make(map[int]bool, len(quantities))
+	for _, q := range quantities {
+		if q.Line < 0 || q.Line >= len(order.Items) {
+			return ReturnEntry{}, fmt.Errorf("%w: the order has no line %d", ErrInvalid, q.Line)
+		}
+		if seen[q.Line] {
+			return ReturnEntry{}, fmt.Errorf("%w: line %d is listed twice", ErrInvalid, q.Line)
+		}
+		seen[q.Line] = true
+
+		item := order.Items[q.Line]
+		left := item.Open() - returned[q.Line]
+		if q.Quantity < 1 || q.Quantity > left {
+			return ReturnEntry{}, fmt.Errorf("%w: line %d has %d units that can be returned, can't return %d", ErrInvalid, q.Line, left, q.Quantity)
+		}
+
+		ret.Lines = append(ret.Lines, ReturnLine{
+			Line:        q.Line,
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			UnitPrice:   order.UnitPaid(q.Line),
+			Authorized:  q.Quantity,
+		})
+	}
+
+	return ret, nil
+}
+
+// Receive records the units that arrived. Lines left out arrived empty, but something
+// must have arrived.
+func (r *ReturnEntry) Receive(quantities []ReturnQuantity, now time.Time) error {
+	if r.Status != ReturnAuthorized {
+		return fmt.Errorf("%w: the return is already %s", ErrStatus, r.Status)
+	}
+
+	received := make(map[int]int, len(quantities))
+	total := 0
+	for _, q := range quantities {
+		line := r.line(q.Line)
+		if line == nil {
+			return fmt.Errorf("%w: the return has no line %d", ErrInvalid, q.Line)
+		}
+		if q.Quantity < 0 || received[q.Line]+q.Quantity > line.Authorized {
+			return fmt.Errorf("%w: line %d was authorized for %d units", ErrInvalid, q.Line, line.Authorized)
+		}
+		received[q.Line] += q.Quantity
+		total += q.Quantity
+	}
+
+	if total == 0 {
+		return fmt.Errorf("%w: no units were received", ErrInvalid)
+	}
+
+	for i := range r.Lines {
+		r.Lines[i].Received = received[r.Lines[i].Line]
+	}
+
+	r.Status = ReturnReceived
+	r.ReceivedAt = &now
+
+	return nil
+}
+
+// Inspect records what becomes of every received unit and works out the refund
+func (r *ReturnEntry) Inspect(inspections []Inspection, policy RefundPolicy, now time.Time) error {
+	if r.Status != ReturnReceived {
+		return fmt.Errorf("%w: only received returns can be inspected, the return is %s", ErrStatus, r.Status)
+	}
+
+	outcomes := make(map[int]Inspection, len(inspections))
+	for _, in := range inspections {
+		line := r.line(in.Line)
+		switch {
+		case line == nil:
+			return fmt.Errorf("%w: the return has no line %d", ErrInvalid, in.Line)
+		case in.Restock < 0 || in.Refurbish < 0 || in.Scrap < 0:
+			return fmt.Errorf("%w: line %d has a negative outcome", ErrInvalid, in.Line)
+		}
+		if _, ok := outcomes[in.Line]; ok {
+			return fmt.Errorf("%w: line %d is listed twice", ErrInvalid, in.Line)
+		}
+		outcomes[in.Line] = in
+	}
+
+	for _, line := range r.Lines {
+		in := outcomes[line.Line]
+		if in.Restock+in.Refurbish+in.Scrap != line.Received {
+			return fmt.Errorf("%w: line %d received %d units, every one needs an outcome", ErrInvalid, line.Line, line.Received)
+		}
+	}
+
+	var total float32
+	for i := range r.Lines {
+		line := &r.Lines[i]
+		in := outcomes[line.Line]
+
+		line.Restocked = in.Restock
+		line.Refurbished = in.Refurbish
+		line.Scrapped = in.Scrap
+		line.Refund = policy.refund(*line)
+
+		total += line.Refund
+	}
+
+	r.RefundAmount = total
+	// with nothing to restock there is nothing to hand back to the inventory
+	r.StockReturned = len(r.Restocked()) == 0
+	r.Status = ReturnInspected
+	r.InspectedAt = &now
+
+	return nil
+}
+
+// Restocked returns the lines with units going back on the shelf
+func (r *ReturnEntry) Restocked() []ReturnLine {
+	var lines []ReturnLine
+	for _, line := range r.Lines {
+		if line.Restocked > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+func (r *ReturnEntry) line(index int) *ReturnLine {
+	for i := range r.Lines {
+		if r.Lines[i].Line == index {
+			return &r.Lines[i]
+		}
+	}
+
+	return nil
+}
+
+func (p RefundPolicy) refund(line ReturnLine) float32 {
+	units := float64(line.Restocked) + float64(line.Refurbished)*p.Refurbish + float64(line.Scrapped)*p.Scrap
+
+	// the price is taken at its decimal value: float32(9.99) widens to 9.98999977, and
+	// half of it would round down to 4.99 instead of up to 5
+	price, _ := strconv.ParseFloat(strconv.FormatFloat(float64(line.UnitPrice), 'g', -1, 32), 64)
+
+	// refunds are paid in cents
+	return float32(math.Round(units*price*100) / 100)
+}
@@ -0,0 +1,217 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var returnTime = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func shippedOrder() *OrderEntry {
+	return &OrderEntry{
+		ID:       "o1",
+		ClientID: 1,
+		Status:   StatusShipped,
+		Items: []OrderItem{
+			{ProductID: "a", ProductName: "Notebook", ProductPrice: 10, Quantity: 3},
+			{ProductID: "b", ProductName: "Monitor", ProductPrice: 5, Quantity: 2, CancelledQuantity: 1},
+		},
+	}
+}
+
+func TestNewReturn(t *testing.T) {
+	authorized := &ReturnEntry{Status: ReturnAuthorized, Lines: []ReturnLine{{Line: 0, Authorized: 2}}}
+	// two units were authorized, one arrived
+	received := &ReturnEntry{Status: ReturnReceived, Lines: []ReturnLine{{Line: 0, Authorized: 2, Received: 1}}}
+	inspected := &ReturnEntry{Status: ReturnInspected, Lines: []ReturnLine{{Line: 0, Authorized: 2, Received: 1, Restocked: 1}}}
+
+	tests := []struct {
+		name       string
+		status     string
+		others     []*ReturnEntry
+		reason     string
+		quantities []ReturnQuantity
+		want       error
+	}{
+		{"every open unit", StatusShipped, nil, "damaged", []ReturnQuantity{{0, 3}, {1, 1}}, nil},
+		{"a delivered order", StatusDelivered, nil, "damaged", []ReturnQuantity{{0, 1}}, nil},
+		{"an order that wasn't shipped", StatusPicked, nil, "damaged", []ReturnQuantity{{0, 1}}, ErrStatus},
+		{"no reason", StatusShipped, nil, "", []ReturnQuantity{{0, 1}}, ErrInvalid},
+		{"no lines", StatusShipped, nil, "damaged", nil, ErrInvalid},
+		{"a missing line", StatusShipped, nil, "damaged", []ReturnQuantity{{2, 1}}, ErrInvalid},
+		{"a line twice", StatusShipped, nil, "damaged", []ReturnQuantity{{0, 1}, {0, 1}}, ErrInvalid},
+		{"no units", StatusShipped, nil, "damaged", []ReturnQuantity{{0, 0}}, ErrInvalid},
+		{"cancelled units", StatusShipped, nil, "damaged", []ReturnQuantity{{1, 2}}, ErrInvalid},
+		{"units an authorized return holds", StatusShipped, []*ReturnEntry{authorized}, "damaged", []ReturnQuantity{{0, 2}}, ErrInvalid},
+		{"the units an authorized return leaves", StatusShipped, []*ReturnEntry{authorized}, "damaged", []ReturnQuantity{{0, 1}}, nil},
+		{"units a received return didn't get", StatusShipped, []*ReturnEntry{received}, "damaged", []ReturnQuantity{{0, 2}}, nil},
+		{"units an inspected return got", StatusShipped, []*ReturnEntry{inspected}, "damaged", []ReturnQuantity{{0, 3}}, ErrInvalid},
+		{"several returns add up", StatusShipped, []*ReturnEntry{authorized, inspected}, "damaged", []ReturnQuantity{{0, 1}}, ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := shippedOrder()
+			order.Status = tt.status
+
+			ret, err := NewReturn(order, tt.others, tt.reason, tt.quantities, returnTime)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+
+			if ret.Status != ReturnAuthorized || ret.OrderID != order.ID || ret.ClientID != order.ClientID || len(ret.Lines) != len(tt.quantities) {
+				t.Fatalf("return = %+v", ret)
+			}
+			for i, q := range tt.quantities {
+				line := ret.Lines[i]
+				if line.Line != q.Line || line.Authorized != q.Quantity || line.ProductID != order.Items[q.Line].ProductID {
+					t.Errorf("line %d = %+v", i, line)
+				}
+			}
+		})
+	}
+}
+
+func TestNewReturnPaysWhatWasPaid(t *testing.T) {
+	order := shippedOrder()
+
+	ret, err := NewReturn(order, nil, "damaged", []ReturnQuantity{{0, 1}}, returnTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Lines[0].UnitPrice != 10 {
+		t.Errorf("unit price without pricing = %v, want the product price", ret.Lines[0].UnitPrice)
+	}
+}
+
+func TestReturnReceive(t *testing.T) {
+	tests := []struct {
+		name       string
+		quantities []ReturnQuantity
+		want       error
+		received   []int
+	}{
+		{"everything", []ReturnQuantity{{0, 2}, {1, 1}}, nil, []int{2, 1}},
+		{"lines left out arrived empty", []ReturnQuantity{{0, 1}}, nil, []int{1, 0}},
+		{"a line in parts", []ReturnQuantity{{0, 1}, {0, 1}}, nil, []int{2, 0}},
+		{"more than authorized", []ReturnQuantity{{0, 3}}, ErrInvalid, nil},
+		{"more than authorized in parts", []ReturnQuantity{{0, 2}, {0, 1}}, ErrInvalid, nil},
+		{"a line that isn't returned", []ReturnQuantity{{2, 1}}, ErrInvalid, nil},
+		{"negative", []ReturnQuantity{{0, -1}}, ErrInvalid, nil},
+		{"nothing", []ReturnQuantity{{0, 0}}, ErrInvalid, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ret := ReturnEntry{Status: ReturnAuthorized, Lines: []ReturnLine{{Line: 0, Authorized: 2}, {Line: 1, Authorized: 1}}}
+
+			err := ret.Receive(tt.quantities, returnTime)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				if ret.Status != ReturnAuthorized || ret.Lines[0].Received != 0 {
+					t.Errorf("a refused receipt changed the return: %+v", ret)
+				}
+				return
+			}
+
+			if ret.Status != ReturnReceived || ret.ReceivedAt == nil {
+				t.Errorf("return is %s", ret.Status)
+			}
+			for i, want := range tt.received {
+				if ret.Lines[i].Received != want {
+					t.Errorf("line %d received %d, want %d", i, ret.Lines[i].Received, want)
+				}
+			}
+		})
+	}
+
+	ret := ReturnEntry{Status: ReturnReceived, Lines: []ReturnLine{{Line: 0, Authorized: 1}}}
+	if err := ret.Receive([]ReturnQuantity{{0, 1}}, returnTime); !errors.Is(err, ErrStatus) {
+		t.Errorf("receiving twice: %v, want ErrStatus", err)
+	}
+}
+
+func TestReturnInspect(t *testing.T) {
+	policy := RefundPolicy{Refurbish: 0.5, Scrap: 0}
+
+	tests := []struct {
+		name        string
+		inspections []Inspection
+		want        error
+		refunds     []float32
+		total       float32
+		returned    bool
+	}{
+		{"everything restocked", []Inspection{{Line: 0, Restock: 2}, {Line: 1, Restock: 1}}, nil, []float32{19.98, 3.33}, 23.31, false},
+		{"mixed outcomes", []Inspection{{Line: 0, Restock: 1, Refurbish: 1}, {Line: 1, Scrap: 1}}, nil, []float32{14.99, 0}, 14.99, false},
+		{"nothing restocked", []Inspection{{Line: 0, Refurbish: 2}, {Line: 1, Scrap: 1}}, nil, []float32{9.99, 0}, 9.99, true},
+		{"a unit without an outcome", []Inspection{{Line: 0, Restock: 1}, {Line: 1, Restock: 1}}, ErrInvalid, nil, 0, false},
+		{"a line left out", []Inspection{{Line: 0, Restock: 2}}, ErrInvalid, nil, 0, false},
+		{"more outcomes than units", []Inspection{{Line: 0, Restock: 3}, {Line: 1, Restock: 1}}, ErrInvalid, nil, 0, false},
+		{"a negative outcome", []Inspection{{Line: 0, Restock: 3, Scrap: -1}, {Line: 1, Restock: 1}}, ErrInvalid, nil, 0, false},
+		{"a line twice", []Inspection{{Line: 0, Restock: 2}, {Line: 0, Restock: 2}, {Line: 1, Restock: 1}}, ErrInvalid, nil, 0, false},
+		{"a line that isn't returned", []Inspection{{Line: 2, Restock: 1}}, ErrInvalid, nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ret := ReturnEntry{Status: ReturnReceived, Lines: []ReturnLine{
+				{Line: 0, UnitPrice: 9.99, Authorized: 2, Received: 2},
+				{Line: 1, UnitPrice: 3.33, Authorized: 2, Received: 1},
+			}}
+
+			err := ret.Inspect(tt.inspections, policy, returnTime)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				if ret.Status != ReturnReceived || ret.RefundAmount != 0 {
+					t.Errorf("a refused inspection changed the return: %+v", ret)
+				}
+				return
+			}
+
+			for i, want := range tt.refunds {
+				if ret.Lines[i].Refund != want {
+					t.Errorf("line %d refund = %v, want %v", i, ret.Lines[i].Refund, want)
+				}
+			}
+			if ret.RefundAmount != tt.total || ret.StockReturned != tt.returned || ret.Status != ReturnInspected {
+				t.Errorf("refund %v, stock returned %v, status %s", ret.RefundAmount, ret.StockReturned, ret.Status)
+			}
+		})
+	}
+
+	ret := ReturnEntry{Status: ReturnAuthorized, Lines: []ReturnLine{{Line: 0, Authorized: 1}}}
+	if err := ret.Inspect(nil, policy, returnTime); !errors.Is(err, ErrStatus) {
+		t.Errorf("inspecting before receiving: %v, want ErrStatus", err)
+	}
+}
+
+func TestRefundRounding(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RefundPolicy
+		line   ReturnLine
+		want   float32
+	}{
+		{"full units", RefundPolicy{}, ReturnLine{UnitPrice: 19.99, Restocked: 3}, 59.97},
+		{"half a cent rounds up", RefundPolicy{Refurbish: 0.5}, ReturnLine{UnitPrice: 0.05, Refurbished: 1}, 0.03},
+		{"shares of a third", RefundPolicy{Refurbish: 1.0 / 3}, ReturnLine{UnitPrice: 10, Refurbished: 1}, 3.33},
+		{"outcomes add up before rounding", RefundPolicy{Refurbish: 0.5, Scrap: 0.25}, ReturnLine{UnitPrice: 0.01, Refurbished: 1, Scrapped: 2}, 0.01},
+		{"a unit price shared out of a discounted line", RefundPolicy{}, ReturnLine{UnitPrice: 33.333332, Restocked: 2}, 66.67},
+		{"scrapped for nothing", RefundPolicy{Refurbish: 0.5}, ReturnLine{UnitPrice: 10, Scrapped: 4}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.refund(tt.line); got != tt.want {
+			t.Errorf("%s: refund = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReturnRepository stores return authorizations. Like orders, a return is only updated
+// when it hasn't changed since it was read; otherwise ErrConflict is returned.
+type ReturnRepository interface {
+	Insert(ctx context.Context, entry ReturnEntry) (string, error)
+	GetOne(ctx context.Context, id string) (*ReturnEntry, error)
+	ByOrder(ctx context.Context, orderID string) ([]*ReturnEntry, error)
+	Update(ctx context.Context, entry ReturnEntry) error
+}
+
+// MongoReturns stores return authorizations in the returns collection
+type MongoReturns struct {
+	collection *mongo.Collection
+}
+
+func NewMongoReturns(db *mongo.Database) *MongoReturns {
+	return &MongoReturns{collection: db.Collection("returns")}
+}
+
+func (m *MongoReturns) Insert(ctx context.Context, entry ReturnEntry) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	entry.ID = ""
+
+	start := time.Now()
+	result, err := m.collection.InsertOne(ctx, entry)
+	observe("returns", "insert", start, err)
+	if err != nil {
+		return "", wrapErr(err)
+	}
+
+	id, _ := result.InsertedID.(primitive.ObjectID)
+
+	return id.Hex(), nil
+}
+
+func (m *MongoReturns) GetOne(ctx context.Context, id string) (*ReturnEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrReturnNotFound
+	}
+
+	var entry ReturnEntry
+	start := time.Now()
+	err = m.collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&entry)
+	observe("returns", "find_one", start, err)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrReturnNotFound
+	}
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &entry, nil
+}
+
+// ByOrder returns the returns of an order, oldest first
+func (m *MongoReturns) ByOrder(ctx context.Context, orderID string) ([]*ReturnEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	start := time.Now()
+	cursor, err := m.collection.Find(ctx, bson.M{"order_id": orderID}, opts)
+	observe("returns", "find_by_order", start, err)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	returns := []*ReturnEntry{}
+	if err := cursor.All(ctx, &returns); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return returns, nil
+}
+
+func (m *MongoReturns) Update(ctx context.Context, entry ReturnEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(entry.ID)
+	if err != nil {
+		return ErrReturnNotFound
+	}
+
+	start := time.Now()
+	result, err := m.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": docID, "updated_at": entry.UpdatedAt},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: entry.Status},
+			{Key: "lines", Value: entry.Lines},
+			{Key: "refund_amount", Value: entry.RefundAmount},
+			{Key: "stock_returned", Value: entry.StockReturned},
+			{Key: "received_at", Value: entry.ReceivedAt},
+			{Key: "inspected_at", Value: entry.InspectedAt},
+			{Key: "updated_at", Value: time.Now()},
+		}}},
+	)
+	observe("returns", "update", start, err)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	if result.MatchedCount == 0 {
+		n, err := m.collection.CountDocuments(ctx, bson.M{"_id": docID})
+		if err != nil {
+			return wrapErr(err)
+		}
+		if n == 0 {
+			return ErrReturnNotFound
+		}
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// MemoryReturns keeps return authorizations in a map and hands out copies
+type MemoryReturns struct {
+	mu      sync.RWMutex
+	returns map[string]ReturnEntry
+}
+
+func NewMemoryReturns() *MemoryReturns {
+	return &MemoryReturns{returns: make(map[string]ReturnEntry)}
+}
+
+func (m *MemoryReturns) Insert(ctx context.Context, entry ReturnEntry) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.ID = primitive.NewObjectID().Hex()
+	entry.Lines = append([]ReturnLine(nil), entry.Lines...)
+
+	m.returns[entry.ID] = entry
+
+	return entry.ID, nil
+}
+
+func (m *MemoryReturns) GetOne(ctx context.Context, id string) (*ReturnEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.returns[id]
+	if !ok {
+		return nil, ErrReturnNotFound
+	}
+
+	return copyReturn(entry), nil
+}
+
+func (m *MemoryReturns) ByOrder(ctx context.Context, orderID string) ([]*ReturnEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	returns := []*ReturnEntry{}
+	for _, entry := range m.returns {
+		if entry.OrderID == orderID {
+			returns = append(returns, copyReturn(entry))
+		}
+	}
+
+	sort.Slice(returns, func(i, j int) bool {
+		if returns[i].CreatedAt.Equal(returns[j].CreatedAt) {
+			return returns[i].ID < returns[j].ID
+		}
+		return returns[i].CreatedAt.Before(returns[j].CreatedAt)
+	})
+
+	return returns, nil
+}
+
+func (m *MemoryReturns) Update(ctx context.Context, entry ReturnEntry) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.returns[entry.ID]
+	if !ok {
+		return ErrReturnNotFound
+	}
+	if !stored.UpdatedAt.Equal(entry.UpdatedAt) {
+		return ErrConflict
+	}
+
+	stored.Status = entry.Status
+	stored.Lines = append([]ReturnLine(nil), entry.Lines...)
+	stored.RefundAmount = entry.RefundAmount
+	stored.StockReturned = entry.StockReturned
+	stored.ReceivedAt = entry.ReceivedAt
+	stored.InspectedAt = entry.InspectedAt
+	stored.UpdatedAt = time.Now()
+
+	m.returns[entry.ID] = stored
+
+	return nil
+}
+
+func copyReturn(entry ReturnEntry) *ReturnEntry {
+	entry.Lines = append([]ReturnLine(nil), entry.Lines...)
+	return &entry
+}
@@ -0,0 +1,247 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Shipment statuses. A shipment is packed once its packages are made up, shipped when a
+// carrier labelled every package and delivered when every package arrived. A packed
+// shipment is voided when its order changes before it leaves, and packed again.
+const (
+	ShipmentPacked    = "packed"
+	ShipmentShipped   = "shipped"
+	ShipmentDelivered = "delivered"
+	ShipmentVoided    = "voided"
+)
+
+// Package limits; anything bigger goes as freight, which the service doesn't handle
+const (
+	MaxPackageWeightKg = 70
+	MaxPackageSideCm   = 300
+)
+
+// ShipmentEntry is the packed units of one order on their way to the client
+type ShipmentEntry struct {
+	ID       string    `bson:"_id,omitempty" json:"id,omitempty"`
+	OrderID  string    `bson:"order_id" json:"order_id"`
+	ClientID int32     `bson:"client_id,omitempty" json:"client_id,omitempty"`
+	Status   string    `bson:"status" json:"status"`
+	Packages []Package `bson:"packages" json:"packages"`
+	// Carrier and Service are known once the shipment is being shipped
+	Carrier     string          `bson:"carrier,omitempty" json:"carrier,omitempty"`
+	Service     string          `bson:"service,omitempty" json:"service,omitempty"`
+	Events      []TrackingEvent `bson:"events,omitempty" json:"events,omitempty"`
+	RequestID   string          `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	ShippedAt   *time.Time      `bson:"shipped_at,omitempty" json:"shipped_at,omitempty"`
+	DeliveredAt *time.Time      `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+	CreatedAt   time.Time       `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time       `bson:"updated_at" json:"updated_at"`
+}
+
+// Package is one box of a shipment. The label is served on its own, so it is left out
+// of the shipment's json.
+type Package struct {
+	Number         int           `bson:"number" json:"number"`
+	WeightKg       float64       `bson:"weight_kg" json:"weight_kg"`
+	LengthCm       float64       `bson:"length_cm" json:"length_cm"`
+	WidthCm        float64       `bson:"width_cm" json:"width_cm"`
+	HeightCm       float64       `bson:"height_cm" json:"height_cm"`
+	Lines          []PackageLine `bson:"lines" json:"lines"`
+	TrackingNumber string        `bson:"tracking_number,omitempty" json:"tracking_number,omitempty"`
+	LabelType      string        `bson:"label_type,omitempty" json:"label_type,omitempty"`
+	Label          []byte        `bson:"label,omitempty" json:"-"`
+	Delivered      bool          `bson:"delivered" json:"delivered"`
+}
+
+// PackageLine is a number of units of one order line in a package
+type PackageLine struct {
+	Line      int    `bson:"line" json:"line"`
+	ProductID string `bson:"product_id" json:"product_id"`
+	Quantity  int    `bson:"quantity" json:"quantity"`
+}
+
+// PackageSpec describes a package as the packer made it up
+type PackageSpec struct {
+	WeightKg float64          `json:"weight_kg"`
+	LengthCm float64          `json:"length_cm"`
+	WidthCm  float64          `json:"width_cm"`
+	HeightCm float64          `json:"height_cm"`
+	Lines    []ReturnQuantity `json:"lines"`
+}
+
+// TrackingEvent is one step of a package on its way, as its carrier reported it
+type TrackingEvent struct {
+	TrackingNumber string    `bson:"tracking_number" json:"tracking_number"`
+	Code           string    `bson:"code" json:"code"`
+	Description    string    `bson:"description" json:"description"`
+	Location       string    `bson:"location,omitempty" json:"location,omitempty"`
+	At             time.Time `bson:"at" json:"at"`
+}
+
+// NewShipment packs every open unit of a picked order into packages. An order that is
+// already packed can be packed again; its earlier shipment must be voided.
+func NewShipment(order *OrderEntry, specs []PackageSpec, now time.Time) (ShipmentEntry, error) {
+	if order.Status != StatusPicked && order.Status != StatusPacked {
+		return ShipmentEntry{}, fmt.Errorf("%w: only picked orders can be packed, the order is %s", ErrStatus, order.Status)
+	}
+
+	if len(specs) == 0 {
+		return ShipmentEntry{}, fmt.Errorf("%w: a shipment needs at least one package", ErrInvalid)
+	}
+
+	shipment := ShipmentEntry{
+		OrderID:   order.ID,
+		ClientID:  order.ClientID,
+		Status:    ShipmentPacked,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	packed := make(map[int]int)
+	for i, spec := range specs {
+		number := i + 1
+
+		switch {
+		case spec.WeightKg <= 0 || spec.WeightKg > MaxPackageWeightKg:
+			return ShipmentEntry{}, fmt.Errorf("%w: package %d must weigh more than 0 and at most %d kg", ErrInvalid, number, MaxPackageWeightKg)
+		case !side(spec.LengthCm) || !side(spec.WidthCm) || !side(spec.HeightCm):
+			return ShipmentEntry{}, fmt.Errorf("%w: every side of package %d must be more than 0 and at most %d cm", ErrInvalid, number, MaxPackageSideCm)
+		case len(spec.Lines) == 0:
+			return ShipmentEntry{}, fmt.Errorf("%w: package %d is empty", ErrInvalid, number)
+		}
+
+		pkg := Package{
+			Number:   number,
+			WeightKg: spec.WeightKg,
+			LengthCm: spec.LengthCm,
+			WidthCm:  spec.WidthCm,
+			HeightCm: spec.HeightCm,
+		}
+
+		for _, q := range spec.Lines {
+			if q.Line < 0 || q.Line >= len(order.Items) {
+				return ShipmentEntry{}, fmt.Errorf("%w: the order has no line %d", ErrInvalid, q.Line)
+			}
+			if q.Quantity < 1 {
+				return ShipmentEntry{}, fmt.Errorf("%w: package %d has no units of line %d", ErrInvalid, number, q.Line)
+			}
+
+			packed[q.Line] += q.Quantity
+			pkg.Lines = append(pkg.Lines, PackageLine{Line: q.Line, ProductID: order.Items[q.Line].ProductID, Quantity: q.Quantity})
+		}
+
+		shipment.Packages = append(shipment.Packages, pkg)
+	}
+
+	if err := shipment.covers(order, packed); err != nil {
+		return ShipmentEntry{}, err
+	}
+
+	return shipment, nil
+}
+
+// Matches reports whether the shipment still holds exactly the open units of order,
+// which cancelling units after packing breaks
+func (s *ShipmentEntry) Matches(order *OrderEntry) error {
+	packed := make(map[int]int)
+	for _, pkg := range s.Packages {
+		for _, line := range pkg.Lines {
+			packed[line.Line] += line.Quantity
+		}
+	}
+
+	if err := s.covers(order, packed); err != nil {
+		return fmt.Errorf("%w: the order changed since it was packed, pack it again", ErrStatus)
+	}
+
+	return nil
+}
+
+// Labelled reports whether every package has a label
+func (s *ShipmentEntry) Labelled() bool {
+	for _, pkg := range s.Packages {
+		if pkg.TrackingNumber == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Booked reports whether any package has a label, which ties the shipment to a carrier
+func (s *ShipmentEntry) Booked() bool {
+	for _, pkg := range s.Packages {
+		if pkg.TrackingNumber != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Ship marks a shipment whose packages all have labels as shipped
+func (s *ShipmentEntry) Ship(now time.Time) error {
+	if s.Status != ShipmentPacked {
+		return fmt.Errorf("%w: the shipment is %s", ErrStatus, s.Status)
+	}
+	if !s.Labelled() {
+		return fmt.Errorf("%w: every package needs a label first", ErrStatus)
+	}
+
+	s.Status = ShipmentShipped
+	s.ShippedAt = &now
+
+	return nil
+}
+
+// Track merges new events of a package into the shipment's events. The shipment is
+// delivered once every package is; Track reports whether this call delivered it.
+func (s *ShipmentEntry) Track(trackingNumber string, events []TrackingEvent, delivered bool, now time.Time) bool {
+	seen := make(map[string]bool, len(s.Events))
+	for _, e := range s.Events {
+		seen[e.TrackingNumber+"/"+e.Code+"/"+e.At.String()] = true
+	}
+
+	for _, e := range events {
+		if !seen[e.TrackingNumber+"/"+e.Code+"/"+e.At.String()] {
+			s.Events = append(s.Events, e)
+		}
+	}
+
+	sort.SliceStable(s.Events, func(i, j int) bool {
+		return s.Events[i].At.Before(s.Events[j].At)
+	})
+
+	all := true
+	for i := range s.Packages {
+		if s.Packages[i].TrackingNumber == trackingNumber && delivered {
+			s.Packages[i].Delivered = true
+		}
+		all = all && s.Packages[i].Delivered
+	}
+
+	if all && s.Status == ShipmentShipped {
+		s.Status = ShipmentDelivered
+		s.DeliveredAt = &now
+		return true
+	}
+
+	return false
+}
+
+// covers checks that packed holds exactly the open units of every line of order
+func (s *ShipmentEntry) covers(order *OrderEntry, packed map[int]int) error {
+	for i, item := range order.Items {
+		if packed[i] != item.Open() {
+			return fmt.Errorf("%w: line %d has %d open units, %d are packed", ErrInvalid, i, item.Open(), packed[i])
+		}
+	}
+
+	return nil
+}
+
+func side(cm float64) bool {
+	return cm > 0 && cm <= MaxPackageSideCm
+}
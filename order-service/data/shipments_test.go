@@ -0,0 +1,227 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var shipTime = time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+func pickedOrder() *OrderEntry {
+	return &OrderEntry{
+		ID:       "o1",
+		ClientID: 1,
+		Status:   StatusPicked,
+		Items: []OrderItem{
+			{ProductID: "a", Quantity: 3},
+			{ProductID: "b", Quantity: 2, CancelledQuantity: 1},
+		},
+	}
+}
+
+func box(lines ...ReturnQuantity) PackageSpec {
+	return PackageSpec{WeightKg: 2, LengthCm: 30, WidthCm: 20, HeightCm: 10, Lines: lines}
+}
+
+func TestNewShipment(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		specs  []PackageSpec
+		want   error
+	}{
+		{"one package", StatusPicked, []PackageSpec{box(ReturnQuantity{0, 3}, ReturnQuantity{1, 1})}, nil},
+		{"a line over two packages", StatusPicked, []PackageSpec{box(ReturnQuantity{0, 2}), box(ReturnQuantity{0, 1}, ReturnQuantity{1, 1})}, nil},
+		{"packed again", StatusPacked, []PackageSpec{box(ReturnQuantity{0, 3}, ReturnQuantity{1, 1})}, nil},
+		{"not picked yet", StatusAllocated, []PackageSpec{box(ReturnQuantity{0, 3}, ReturnQuantity{1, 1})}, ErrStatus},
+		{"no packages", StatusPicked, nil, ErrInvalid},
+		{"an empty package", StatusPicked, []PackageSpec{box(ReturnQuantity{0, 3}, ReturnQuantity{1, 1}), box()}, ErrInvalid},
+		{"units left out", StatusPicked, []PackageSpec{box(ReturnQuantity{0, 2}, ReturnQuantity{1, 1})}, ErrInvalid},
+		{"cancelled units packed", StatusPicked, []PackageSpec{box(ReturnQuantity{0, 3}, ReturnQuantity{1, 2})}, ErrInvalid},
+		{"a missing line", StatusPicked, []PackageSpec{box(ReturnQuantity{0, 3}, ReturnQuantity{1, 1}, ReturnQuantity{2, 1})}, ErrInvalid},
+		{"no units of a line", StatusPicked, []PackageSpec{box(ReturnQuantity{0, 3}, ReturnQuantity{1, 1}, ReturnQuantity{1, 0})}, ErrInvalid},
+		{"too heavy", StatusPicked, []PackageSpec{{WeightKg: MaxPackageWeightKg + 1, LengthCm: 1, WidthCm: 1, HeightCm: 1, Lines: []ReturnQuantity{{0, 3}, {1, 1}}}}, ErrInvalid},
+		{"weightless", StatusPicked, []PackageSpec{{LengthCm: 1, WidthCm: 1, HeightCm: 1, Lines: []ReturnQuantity{{0, 3}, {1, 1}}}}, ErrInvalid},
+		{"too long", StatusPicked, []PackageSpec{{WeightKg: 1, LengthCm: MaxPackageSideCm + 1, WidthCm: 1, HeightCm: 1, Lines: []ReturnQuantity{{0, 3}, {1, 1}}}}, ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := pickedOrder()
+			order.Status = tt.status
+
+			shipment, err := NewShipment(order, tt.specs, shipTime)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+
+			if shipment.Status != ShipmentPacked || shipment.OrderID != order.ID || len(shipment.Packages) != len(tt.specs) {
+				t.Fatalf("shipment = %+v", shipment)
+			}
+			for i, pkg := range shipment.Packages {
+				if pkg.Number != i+1 {
+					t.Errorf("package %d is numbered %d", i, pkg.Number)
+				}
+			}
+			if err := shipment.Matches(order); err != nil {
+				t.Errorf("a new shipment doesn't match its order: %v", err)
+			}
+		})
+	}
+}
+
+func TestShipmentMatches(t *testing.T) {
+	order := pickedOrder()
+	shipment, err := NewShipment(order, []PackageSpec{box(ReturnQuantity{0, 3}, ReturnQuantity{1, 1})}, shipTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order.Items[0].CancelledQuantity = 1
+	if err := shipment.Matches(order); !errors.Is(err, ErrStatus) {
+		t.Errorf("after a cancellation: %v, want ErrStatus", err)
+	}
+}
+
+func TestShipmentShip(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		tracking []string
+		want     error
+	}{
+		{"every package labelled", ShipmentPacked, []string{"T1", "T2"}, nil},
+		{"a package without a label", ShipmentPacked, []string{"T1", ""}, ErrStatus},
+		{"shipped already", ShipmentShipped, []string{"T1", "T2"}, ErrStatus},
+		{"voided", ShipmentVoided, []string{"T1", "T2"}, ErrStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shipment := ShipmentEntry{Status: tt.status}
+			for i, number := range tt.tracking {
+				shipment.Packages = append(shipment.Packages, Package{Number: i + 1, TrackingNumber: number})
+			}
+
+			if !shipment.Booked() {
+				t.Errorf("a shipment with labels isn't booked")
+			}
+
+			err := shipment.Ship(shipTime)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if err == nil && (shipment.Status != ShipmentShipped || shipment.ShippedAt == nil) {
+				t.Errorf("shipment is %s", shipment.Status)
+			}
+		})
+	}
+
+	if (&ShipmentEntry{Packages: []Package{{Number: 1}}}).Booked() {
+		t.Errorf("a shipment without labels is booked")
+	}
+}
+
+func TestShipmentTrack(t *testing.T) {
+	at := func(hours int) time.Time { return shipTime.Add(time.Duration(hours) * time.Hour) }
+	event := func(number, code string, hours int) TrackingEvent {
+		return TrackingEvent{TrackingNumber: number, Code: code, At: at(hours)}
+	}
+
+	shipment := ShipmentEntry{
+		Status:   ShipmentShipped,
+		Packages: []Package{{Number: 1, TrackingNumber: "T1"}, {Number: 2, TrackingNumber: "T2"}},
+	}
+
+	steps := []struct {
+		number    string
+		events    []TrackingEvent
+		delivered bool
+		done      bool
+		codes     []string
+	}{
+		{"T2", []TrackingEvent{event("T2", "label_created", 0), event("T2", "picked_up", 2)}, false, false,
+			[]string{"label_created", "picked_up"}},
+		// events come back in full every time; the ones seen before aren't added again
+		{"T1", []TrackingEvent{event("T1", "label_created", 1), event("T1", "delivered", 3)}, true, false,
+			[]string{"label_created", "label_created", "picked_up", "delivered"}},
+		{"T2", []TrackingEvent{event("T2", "label_created", 0), event("T2", "picked_up", 2), event("T2", "delivered", 4)}, true, true,
+			[]string{"label_created", "label_created", "picked_up", "delivered", "delivered"}},
+		// delivered already: nothing changes
+		{"T2", []TrackingEvent{event("T2", "delivered", 4)}, true, false,
+			[]string{"label_created", "label_created", "picked_up", "delivered", "delivered"}},
+	}
+
+	for i, step := range steps {
+		done := shipment.Track(step.number, step.events, step.delivered, at(10+i))
+		if done != step.done {
+			t.Errorf("step %d: delivered the shipment = %v, want %v", i, done, step.done)
+		}
+
+		if len(shipment.Events) != len(step.codes) {
+			t.Fatalf("step %d: events %+v, want %v", i, shipment.Events, step.codes)
+		}
+		for j, e := range shipment.Events {
+			if e.Code != step.codes[j] {
+				t.Errorf("step %d: event %d = %s, want %s", i, j, e.Code, step.codes[j])
+			}
+			if j > 0 && e.At.Before(shipment.Events[j-1].At) {
+				t.Errorf("step %d: events are out of order", i)
+			}
+		}
+	}
+
+	if shipment.Status != ShipmentDelivered || shipment.DeliveredAt == nil || !shipment.DeliveredAt.Equal(at(12)) {
+		t.Errorf("shipment is %s, delivered at %v", shipment.Status, shipment.DeliveredAt)
+	}
+}
+
+func TestShipmentEncoding(t *testing.T) {
+	// carriers report times in whole seconds or finer; mongo keeps milliseconds
+	created := TrackingEvent{TrackingNumber: "T1", Code: "label_created", At: shipTime.Add(1500 * time.Millisecond)}
+	shipment := ShipmentEntry{
+		Status:   ShipmentShipped,
+		Packages: []Package{{Number: 1, TrackingNumber: "T1", LabelType: "application/zpl", Label: []byte("^XA^XZ")}},
+	}
+	shipment.Track("T1", []TrackingEvent{created}, false, shipTime)
+
+	doc, err := bson.Marshal(shipment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored ShipmentEntry
+	if err := bson.Unmarshal(doc, &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := stored.Packages[0]
+	if pkg.TrackingNumber != "T1" || string(pkg.Label) != "^XA^XZ" || pkg.LabelType != "application/zpl" {
+		t.Errorf("stored package = %+v", pkg)
+	}
+	if len(stored.Events) != 1 || !stored.Events[0].At.Equal(created.At) {
+		t.Fatalf("stored events = %+v", stored.Events)
+	}
+
+	// the events the carrier reports again match the stored ones
+	stored.Track("T1", []TrackingEvent{created}, false, shipTime)
+	if len(stored.Events) != 1 {
+		t.Errorf("events reported again were added again: %+v", stored.Events)
+	}
+
+	// labels are served on their own
+	body, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "XA") || !strings.Contains(string(body), `"tracking_number":"T1"`) {
+		t.Errorf("json = %s", body)
+	}
+}
@@ -0,0 +1,245 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ShipmentRepository stores shipments. Like orders, a shipment is only updated
+// when it hasn't changed since it was read; otherwise ErrConflict is returned.
+type ShipmentRepository interface {
+	Insert(ctx context.Context, entry ShipmentEntry) (string, error)
+	GetOne(ctx context.Context, id string) (*ShipmentEntry, error)
+	ByOrder(ctx context.Context, orderID string) ([]*ShipmentEntry, error)
+	Update(ctx context.Context, entry ShipmentEntry) error
+}
+
+// MongoShipments stores shipments in the shipments collection
+type MongoShipments struct {
+	collection *mongo.Collection
+}
+
+func NewMongoShipments(db *mongo.Database) *MongoShipments {
+	return &MongoShipments{collection: db.Collection("shipments")}
+}
+
+func (m *MongoShipments) Insert(ctx context.Context, entry ShipmentEntry) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	entry.ID = ""
+
+	start := time.Now()
+	result, err := m.collection.InsertOne(ctx, entry)
+	observe("shipments", "insert", start, err)
+	if err != nil {
+		return "", wrapErr(err)
+	}
+
+	id, _ := result.InsertedID.(primitive.ObjectID)
+
+	return id.Hex(), nil
+}
+
+func (m *MongoShipments) GetOne(ctx context.Context, id string) (*ShipmentEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrShipmentNotFound
+	}
+
+	var entry ShipmentEntry
+	start := time.Now()
+	err = m.collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&entry)
+	observe("shipments", "find_one", start, err)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrShipmentNotFound
+	}
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &entry, nil
+}
+
+// ByOrder returns the shipments of an order, oldest first
+func (m *MongoShipments) ByOrder(ctx context.Context, orderID string) ([]*ShipmentEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	start := time.Now()
+	cursor, err := m.collection.Find(ctx, bson.M{"order_id": orderID}, opts)
+	observe("shipments", "find_by_order", start, err)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	shipments := []*ShipmentEntry{}
+	if err := cursor.All(ctx, &shipments); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return shipments, nil
+}
+
+func (m *MongoShipments) Update(ctx context.Context, entry ShipmentEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	docID, err := primitive.ObjectIDFromHex(entry.ID)
+	if err != nil {
+		return ErrShipmentNotFound
+	}
+
+	start := time.Now()
+	result, err := m.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": docID, "updated_at": entry.UpdatedAt},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: entry.Status},
+			{Key: "packages", Value: entry.Packages},
+			{Key: "carrier", Value: entry.Carrier},
+			{Key: "service", Value: entry.Service},
+			{Key: "events", Value: entry.Events},
+			{Key: "shipped_at", Value: entry.ShippedAt},
+			{Key: "delivered_at", Value: entry.DeliveredAt},
+			{Key: "updated_at", Value: time.Now()},
+		}}},
+	)
+	observe("shipments", "update", start, err)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	if result.MatchedCount == 0 {
+		n, err := m.collection.CountDocuments(ctx, bson.M{"_id": docID})
+		if err != nil {
+			return wrapErr(err)
+		}
+		if n == 0 {
+			return ErrShipmentNotFound
+		}
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// MemoryShipments keeps shipments in a map and hands out copies
+type MemoryShipments struct {
+	mu        sync.RWMutex
+	shipments map[string]ShipmentEntry
+}
+
+func NewMemoryShipments() *MemoryShipments {
+	return &MemoryShipments{shipments: make(map[string]ShipmentEntry)}
+}
+
+func (m *MemoryShipments) Insert(ctx context.Context, entry ShipmentEntry) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.ID = primitive.NewObjectID().Hex()
+
+	m.shipments[entry.ID] = *copyShipment(entry)
+
+	return entry.ID, nil
+}
+
+func (m *MemoryShipments) GetOne(ctx context.Context, id string) (*ShipmentEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.shipments[id]
+	if !ok {
+		return nil, ErrShipmentNotFound
+	}
+
+	return copyShipment(entry), nil
+}
+
+func (m *MemoryShipments) ByOrder(ctx context.Context, orderID string) ([]*ShipmentEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	shipments := []*ShipmentEntry{}
+	for _, entry := range m.shipments {
+		if entry.OrderID == orderID {
+			shipments = append(shipments, copyShipment(entry))
+		}
+	}
+
+	sort.Slice(shipments, func(i, j int) bool {
+		if shipments[i].CreatedAt.Equal(shipments[j].CreatedAt) {
+			return shipments[i].ID < shipments[j].ID
+		}
+		return shipments[i].CreatedAt.Before(shipments[j].CreatedAt)
+	})
+
+	return shipments, nil
+}
+
+func (m *MemoryShipments) Update(ctx context.Context, entry ShipmentEntry) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErr(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.shipments[entry.ID]
+	if !ok {
+		return ErrShipmentNotFound
+	}
+	if !stored.UpdatedAt.Equal(entry.UpdatedAt) {
+		return ErrConflict
+	}
+
+	updated := copyShipment(entry)
+	updated.OrderID = stored.OrderID
+	updated.ClientID = stored.ClientID
+	updated.RequestID = stored.RequestID
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = time.Now()
+
+	m.shipments[entry.ID] = *updated
+
+	return nil
+}
+
+// copyShipment copies the packages deeply, so that callers can't change stored lines
+func copyShipment(entry ShipmentEntry) *ShipmentEntry {
+	packages := make([]Package, len(entry.Packages))
+	for i, pkg := range entry.Packages {
+		pkg.Lines = append([]PackageLine(nil), pkg.Lines...)
+		packages[i] = pkg
+	}
+	entry.Packages = packages
+	entry.Events = append([]TrackingEvent(nil), entry.Events...)
+
+	return &entry
+}
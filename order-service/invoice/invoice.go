@@ -0,0 +1,119 @@
+// Package invoice renders invoices as the documents sent to clients: an HTML page and a
+// PDF. Rendering only depends on the invoice, so a stored invoice renders the same again.
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"order-service/data"
+	"strings"
+)
+
+// Content types of the rendered documents
+const (
+	HTMLType = "text/html; charset=utf-8"
+	PDFType  = "application/pdf"
+)
+
+// dateLayout is how the issue date is printed on both documents
+const dateLayout = "2 January 2006"
+
+var page = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money":   money,
+	"percent": percent,
+	"inc":     func(i int) int { return i + 1 },
+	"taxID":   taxID,
+	"date":    func(inv *data.InvoiceEntry) string { return inv.IssuedAt.Format(dateLayout) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; margin-bottom: 0.2em; }
+table { border-collapse: collapse; width: 100%; margin-top: 1.5em; }
+th, td { padding: 0.4em 0.6em; border-bottom: 1px solid #ddd; text-align: left; }
+th.n, td.n { text-align: right; }
+tfoot td { border-bottom: none; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Number}}</h1>
+<p>{{.Issuer}}</p>
+<p>Issued {{date .}}<br>
+Order {{.OrderID}}{{if .ClientID}}<br>
+Client {{.ClientID}}{{end}}</p>
+{{- with .BillTo}}
+<p><strong>Bill to</strong><br>
+{{- range .Lines}}
+{{.}}<br>
+{{- end}}
+{{- range .TaxIDs}}
+{{taxID .}}<br>
+{{- end}}</p>
+{{- end}}
+<table>
+<thead>
+<tr><th>#</th><th>Product</th><th class="n">Quantity</th><th class="n">Unit price</th><th class="n">Discount</th><th class="n">Net</th><th class="n">Tax rate</th><th class="n">Tax</th><th class="n">Total</th></tr>
+</thead>
+<tbody>
+{{- range $i, $line := .Lines}}
+<tr><td>{{inc $i}}</td><td>{{$line.ProductName}}</td><td class="n">{{$line.Quantity}}</td><td class="n">{{money $line.UnitPrice}}</td><td class="n">{{money $line.Discount}}</td><td class="n">{{money $line.Net}}</td><td class="n">{{percent $line.TaxRate}}</td><td class="n">{{money $line.Tax}}</td><td class="n">{{money $line.Total}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot>
+<tr><td colspan="8" class="n">Discount</td><td class="n">{{money .Discount}}</td></tr>
+<tr><td colspan="8" class="n">Net</td><td class="n">{{money .Net}}</td></tr>
+<tr><td colspan="8" class="n">Tax</td><td class="n">{{money .Tax}}</td></tr>
+<tr><td colspan="8" class="n">Total {{.Currency}}</td><td class="n">{{money .Total}}</td></tr>
+</tfoot>
+</table>
+</body>
+</html>
+`))
+
+// Render fills in the documents of a numbered invoice, in every format
+func Render(inv *data.InvoiceEntry) error {
+	html, err := HTML(inv)
+	if err != nil {
+		return err
+	}
+
+	inv.Documents = []data.Document{
+		{Format: data.InvoiceHTML, ContentType: HTMLType, Data: html},
+		{Format: data.InvoicePDF, ContentType: PDFType, Data: PDF(inv)},
+	}
+
+	return nil
+}
+
+// HTML renders the invoice as a standalone page
+func HTML(inv *data.InvoiceEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, inv); err != nil {
+		return nil, fmt.Errorf("rendering invoice %s: %w", inv.Number, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func money(amount float32) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+func percent(rate float64) string {
+	return fmt.Sprintf("%g%%", math.Round(rate*10000)/100)
+}
+
+// taxID prints a tax identifier like "VAT DE123456789 (DE)"
+func taxID(id data.TaxID) string {
+	text := strings.ToUpper(strings.ReplaceAll(id.Type, "_", " ")) + " " + id.Value
+	if id.Country != "" {
+		text += " (" + id.Country + ")"
+	}
+
+	return text
+}
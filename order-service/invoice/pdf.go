@@ -0,0 +1,212 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"order-service/data"
+	"strconv"
+	"strings"
+)
+
+// Page layout in points, on A4
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 50
+	bodySize   = 8
+	titleSize  = 18
+	leading    = 12
+	nameColumn = 24
+)
+
+// row lays out a table row in Courier, whose glyphs are all as wide, so that columns line
+// up by padding alone
+const row = "%3s %-24s %5s %11s %10s %11s %7s %10s %11s"
+
+// totalRow right aligns a label and an amount under the total column
+const totalRow = "%88s %11s"
+
+// pdfText is one line of text placed on a page
+type pdfText struct {
+	font string
+	size int
+	x, y int
+	text string
+}
+
+// PDF renders the invoice as a PDF of A4 pages. It only uses fonts every PDF reader has
+// built in, so nothing is embedded: Helvetica-Bold for the title, Courier for the rest.
+func PDF(inv *data.InvoiceEntry) []byte {
+	header := []string{
+		inv.Issuer,
+		"Issued " + inv.IssuedAt.Format(dateLayout),
+		"Order " + inv.OrderID,
+	}
+	if inv.ClientID != 0 {
+		header = append(header, "Client "+strconv.Itoa(int(inv.ClientID)))
+	}
+	if inv.BillTo != nil {
+		header = append(header, "", "Bill to")
+		header = append(header, inv.BillTo.Lines...)
+		for _, id := range inv.BillTo.TaxIDs {
+			header = append(header, taxID(id))
+		}
+	}
+
+	tableHead := fmt.Sprintf(row, "#", "Product", "Qty", "Unit price", "Discount", "Net", "Rate", "Tax", "Total")
+
+	var body []string
+	for i, line := range inv.Lines {
+		name := wrap(line.ProductName, nameColumn)
+		body = append(body, fmt.Sprintf(row, strconv.Itoa(i+1), name[0], strconv.Itoa(line.Quantity), money(line.UnitPrice),
+			money(line.Discount), money(line.Net), percent(line.TaxRate), money(line.Tax), money(line.Total)))
+		for _, more := range name[1:] {
+			body = append(body, strings.TrimRight(fmt.Sprintf(row, "", more, "", "", "", "", "", "", ""), " "))
+		}
+	}
+
+	body = append(body, "",
+		fmt.Sprintf(totalRow, "Discount", money(inv.Discount)),
+		fmt.Sprintf(totalRow, "Net", money(inv.Net)),
+		fmt.Sprintf(totalRow, "Tax", money(inv.Tax)),
+		fmt.Sprintf(totalRow, "Total "+inv.Currency, money(inv.Total)),
+	)
+
+	// the first page starts with the title and the header, every page with the table head
+	var pages [][]pdfText
+	var texts []pdfText
+	y := pageHeight - margin - titleSize
+
+	texts = append(texts, pdfText{font: "F2", size: titleSize, x: margin, y: y, text: "Invoice " + inv.Number})
+	y -= 2 * leading
+	for _, line := range header {
+		texts = append(texts, pdfText{font: "F1", size: bodySize + 1, x: margin, y: y, text: line})
+		y -= leading
+	}
+	y -= leading
+
+	for len(body) > 0 {
+		texts = append(texts, pdfText{font: "F1", size: bodySize, x: margin, y: y, text: tableHead})
+		y -= leading + leading/2
+
+		for len(body) > 0 && y > margin+leading {
+			texts = append(texts, pdfText{font: "F1", size: bodySize, x: margin, y: y, text: body[0]})
+			body = body[1:]
+			y -= leading
+		}
+
+		pages = append(pages, texts)
+		texts = nil
+		y = pageHeight - margin - bodySize
+	}
+
+	for i := range pages {
+		footer := fmt.Sprintf("Invoice %s, page %d of %d", inv.Number, i+1, len(pages))
+		pages[i] = append(pages[i], pdfText{font: "F1", size: bodySize, x: margin, y: margin / 2, text: footer})
+	}
+
+	return writePDF(pages, inv)
+}
+
+// writePDF lays out the objects of the document: the catalog, the page tree, the two
+// fonts, a page and its content stream per page and the document information
+func writePDF(pages [][]pdfText, inv *data.InvoiceEntry) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// binary bytes in the comment tell transfer tools the file isn't text
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	const firstPage = 5
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, texts := range pages {
+		var content strings.Builder
+		for _, t := range texts {
+			if t.text == "" {
+				continue
+			}
+			fmt.Fprintf(&content, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", t.font, t.size, t.x, t.y, pdfString(t.text))
+		}
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	object(fmt.Sprintf("<< /Title (%s) /Author (%s) /CreationDate (D:%s) >>",
+		pdfString("Invoice "+inv.Number), pdfString(inv.Issuer), inv.IssuedAt.UTC().Format("20060102150405")+"Z"))
+	info := len(offsets)
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, info, xref)
+
+	return buf.Bytes()
+}
+
+// pdfString escapes text for a PDF string in WinAnsiEncoding. Latin-1 characters are
+// written as octal escapes; anything the built-in fonts can't show becomes a question mark.
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+
+	return b.String()
+}
+
+// wrap splits text into pieces of at most width characters, breaking at spaces where it can
+func wrap(text string, width int) []string {
+	var lines []string
+	line := ""
+
+	for _, word := range strings.Fields(text) {
+		for len([]rune(word)) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, string([]rune(word)[:width]))
+			word = string([]rune(word)[width:])
+		}
+
+		switch {
+		case line == "":
+			line = word
+		case len([]rune(line))+1+len([]rune(word)) <= width:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+
+	return append(lines, line)
+}
@@ -0,0 +1,239 @@
+// Package pricing works out what an order costs: the discounts of the promotions that fit
+// it and the tax of every line, by the line's category and where the order goes. Prices
+// are net of tax. Every amount is rounded to cents per line, and totals add up the rounded
+// amounts.
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrInvalid is returned for an order the engine can't price
+	ErrInvalid = errors.New("invalid order")
+	// ErrUnknownCode is returned when an order presents a promotion code nobody issued
+	ErrUnknownCode = errors.New("unknown promotion code")
+)
+
+// Order is what pricing needs to know about an order
+type Order struct {
+	ClientID    int32
+	Destination Destination
+	Codes       []string
+	Lines       []Line
+}
+
+// Line is one order line. UnitPrice is net of tax.
+type Line struct {
+	ProductID string
+	Category  string
+	UnitPrice float64
+	Quantity  int
+}
+
+// Breakdown is how the price of an order came about, line by line, as it was ordered
+type Breakdown struct {
+	Lines      []LinePrice `bson:"lines" json:"lines"`
+	Promotions []Applied   `bson:"promotions,omitempty" json:"promotions,omitempty"`
+	Subtotal   float32     `bson:"subtotal" json:"subtotal"`
+	Discount   float32     `bson:"discount" json:"discount"`
+	Net        float32     `bson:"net" json:"net"`
+	Tax        float32     `bson:"tax" json:"tax"`
+	Total      float32     `bson:"total" json:"total"`
+}
+
+// LinePrice is the price of one order line. Subtotal is the undiscounted price of its
+// units, Net what is left after discounts and Total adds the tax.
+type LinePrice struct {
+	Line     int     `bson:"line" json:"line"`
+	Quantity int     `bson:"quantity" json:"quantity"`
+	Subtotal float32 `bson:"subtotal" json:"subtotal"`
+	Discount float32 `bson:"discount" json:"discount"`
+	Net      float32 `bson:"net" json:"net"`
+	TaxRate  float64 `bson:"tax_rate" json:"tax_rate"`
+	Tax      float32 `bson:"tax" json:"tax"`
+	Total    float32 `bson:"total" json:"total"`
+}
+
+// Share is the price of some of the line's units. Discounts and tax are shared out
+// evenly, so a line keeps the price its units were ordered at when some are cancelled.
+func (l LinePrice) Share(units int) LinePrice {
+	if units == l.Quantity || l.Quantity == 0 {
+		return l
+	}
+
+	part := float64(units) / float64(l.Quantity)
+	share := LinePrice{
+		Line:     l.Line,
+		Quantity: units,
+		Subtotal: float32(cents(float64(l.Subtotal) * part)),
+		Discount: float32(cents(float64(l.Discount) * part)),
+		TaxRate:  l.TaxRate,
+		Tax:      float32(cents(float64(l.Tax) * part)),
+	}
+	share.Net = float32(cents(float64(share.Subtotal - share.Discount)))
+	share.Total = float32(cents(float64(share.Net + share.Tax)))
+
+	return share
+}
+
+// Engine prices orders by a fixed set of tax rules and promotions
+type Engine struct {
+	rules       []TaxRule
+	promotions  []Promotion
+	codes       map[string]bool
+	defaultRate float64
+}
+
+// New checks the rules and promotions and returns an engine applying them. defaultRate
+// taxes the lines no rule matches.
+func New(defaultRate float64, rules []TaxRule, promotions []Promotion) (*Engine, error) {
+	var errs []error
+
+	if defaultRate < 0 || defaultRate > 1 {
+		errs = append(errs, fmt.Errorf("default tax rate %g must be between 0 and 1", defaultRate))
+	}
+
+	for i, rule := range rules {
+		if err := rule.check(); err != nil {
+			errs = append(errs, fmt.Errorf("tax rule %d: %w", i, err))
+		}
+	}
+
+	ids := make(map[string]bool, len(promotions))
+	codes := make(map[string]bool)
+	for i, promo := range promotions {
+		if err := promo.check(); err != nil {
+			errs = append(errs, fmt.Errorf("promotion %d: %w", i, err))
+			continue
+		}
+		if ids[promo.ID] {
+			errs = append(errs, fmt.Errorf("promotion %d: id %q is used twice", i, promo.ID))
+		}
+		ids[promo.ID] = true
+
+		if promo.Code != "" {
+			code := normalizeCode(promo.Code)
+			if codes[code] {
+				errs = append(errs, fmt.Errorf("promotion %d: code %q is used twice", i, promo.Code))
+			}
+			codes[code] = true
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	// promotions apply kind by kind, in the order they are listed within a kind
+	ordered := append([]Promotion(nil), promotions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return stage(ordered[i].Kind) < stage(ordered[j].Kind)
+	})
+
+	return &Engine{
+		rules:       append([]TaxRule(nil), rules...),
+		promotions:  ordered,
+		codes:       codes,
+		defaultRate: defaultRate,
+	}, nil
+}
+
+// Price works out the breakdown of the order as it would be placed at now
+func (e *Engine) Price(order Order, now time.Time) (Breakdown, error) {
+	if err := CheckDestination(order.Destination); err != nil {
+		return Breakdown{}, err
+	}
+
+	codes := make(map[string]bool, len(order.Codes))
+	for _, code := range order.Codes {
+		code = normalizeCode(code)
+		if !e.codes[code] {
+			return Breakdown{}, fmt.Errorf("%w: %s", ErrUnknownCode, code)
+		}
+		codes[code] = true
+	}
+
+	left := make([]float64, len(order.Lines))
+	var subtotal float64
+	for i, line := range order.Lines {
+		if line.Quantity < 1 || line.UnitPrice < 0 {
+			return Breakdown{}, fmt.Errorf("%w: line %d needs a quantity and a price that isn't negative", ErrInvalid, i)
+		}
+		left[i] = cents(line.UnitPrice * float64(line.Quantity))
+		subtotal += left[i]
+	}
+
+	var breakdown Breakdown
+	discounts := make([]float64, len(order.Lines))
+
+	for _, promo := range e.promotions {
+		if !promo.fits(order, codes, subtotal, now) {
+			continue
+		}
+
+		var amount float64
+		for i, off := range promo.discounts(order.Lines, left) {
+			discounts[i] += off
+			left[i] = cents(left[i] - off)
+			amount += off
+		}
+
+		if amount > 0 {
+			breakdown.Promotions = append(breakdown.Promotions, Applied{
+				ID:     promo.ID,
+				Name:   promo.Name,
+				Kind:   promo.Kind,
+				Code:   promo.Code,
+				Amount: float32(cents(amount)),
+			})
+		}
+	}
+
+	var discount, net, tax float64
+	for i, line := range order.Lines {
+		rate := e.rate(line.Category, order.Destination)
+		lineTax := cents(left[i] * rate)
+
+		breakdown.Lines = append(breakdown.Lines, LinePrice{
+			Line:     i,
+			Quantity: line.Quantity,
+			Subtotal: float32(cents(line.UnitPrice * float64(line.Quantity))),
+			Discount: float32(cents(discounts[i])),
+			Net:      float32(left[i]),
+			TaxRate:  rate,
+			Tax:      float32(lineTax),
+			Total:    float32(cents(left[i] + lineTax)),
+		})
+
+		discount += discounts[i]
+		net += left[i]
+		tax += lineTax
+	}
+
+	breakdown.Subtotal = float32(cents(subtotal))
+	breakdown.Discount = float32(cents(discount))
+	breakdown.Net = float32(cents(net))
+	breakdown.Tax = float32(cents(tax))
+	breakdown.Total = float32(cents(net + tax))
+
+	return breakdown, nil
+}
+
+func stage(kind string) int {
+	for i, k := range stages {
+		if k == kind {
+			return i
+		}
+	}
+
+	return len(stages)
+}
+
+func cents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
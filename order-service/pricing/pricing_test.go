@@ -0,0 +1,288 @@
+package pricing
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// same compares amounts to the cent
+func same(got float32, want float64) bool {
+	return math.Abs(float64(got)-want) < 0.005
+}
+
+func TestPrice(t *testing.T) {
+	tests := []struct {
+		name   string
+		promos []Promotion
+		order  Order
+		// discounts are per line; applied lists the promotions in the order they applied
+		discounts []float64
+		applied   []string
+		net, tax  float64
+		total     float64
+	}{
+		{
+			name: "promotions stack by kind whatever order they are listed in",
+			promos: []Promotion{
+				{ID: "five-off", Kind: KindFixed, Amount: 5},
+				{ID: "ten-percent", Kind: KindPercent, Percent: 10},
+				{ID: "three-for-two", Kind: KindBuyXGetY, Buy: 2, Get: 1},
+			},
+			order: Order{ClientID: 1, Lines: []Line{
+				{ProductID: "a", UnitPrice: 10, Quantity: 3},
+				{ProductID: "b", UnitPrice: 20, Quantity: 1},
+			}},
+			// a: 30 - 10 free - 2 (10% of 20) - 2.50; b: 20 - 2 (10%) - 2.50
+			discounts: []float64{14.5, 4.5},
+			applied:   []string{"three-for-two", "ten-percent", "five-off"},
+			net:       31,
+			tax:       6.2,
+			total:     37.2,
+		},
+		{
+			name:      "a fixed discount takes no more than the order is worth",
+			promos:    []Promotion{{ID: "ten-off", Kind: KindFixed, Amount: 10}},
+			order:     Order{ClientID: 1, Lines: []Line{{ProductID: "a", UnitPrice: 3, Quantity: 2}}},
+			discounts: []float64{6},
+			applied:   []string{"ten-off"},
+		},
+		{
+			name:   "a fixed discount is shared out by value",
+			promos: []Promotion{{ID: "three-off", Kind: KindFixed, Amount: 3}},
+			order: Order{ClientID: 1, Lines: []Line{
+				{ProductID: "a", UnitPrice: 10, Quantity: 1},
+				{ProductID: "b", UnitPrice: 20, Quantity: 1},
+			}},
+			discounts: []float64{1, 2},
+			applied:   []string{"three-off"},
+			net:       27,
+			tax:       5.4,
+			total:     32.4,
+		},
+		{
+			name:      "a client's promotion applies to their orders",
+			promos:    []Promotion{{ID: "vip", Kind: KindPercent, Percent: 50, Clients: []int32{7}}},
+			order:     Order{ClientID: 7, Lines: []Line{{ProductID: "a", UnitPrice: 10, Quantity: 1}}},
+			discounts: []float64{5},
+			applied:   []string{"vip"},
+			net:       5,
+			tax:       1,
+			total:     6,
+		},
+		{
+			name:      "a client's promotion skips other clients",
+			promos:    []Promotion{{ID: "vip", Kind: KindPercent, Percent: 50, Clients: []int32{7}}},
+			order:     Order{ClientID: 8, Lines: []Line{{ProductID: "a", UnitPrice: 10, Quantity: 1}}},
+			discounts: []float64{0},
+			net:       10,
+			tax:       2,
+			total:     12,
+		},
+		{
+			name:   "a promotion only discounts the categories it names",
+			promos: []Promotion{{ID: "books", Kind: KindPercent, Percent: 25, Categories: []string{"books"}}},
+			order: Order{ClientID: 1, Lines: []Line{
+				{ProductID: "a", Category: "books", UnitPrice: 8, Quantity: 1},
+				{ProductID: "b", Category: "tools", UnitPrice: 8, Quantity: 1},
+			}},
+			discounts: []float64{2, 0},
+			applied:   []string{"books"},
+			net:       14,
+			tax:       2.8,
+			total:     16.8,
+		},
+		{
+			name:      "a coded promotion needs its code",
+			promos:    []Promotion{{ID: "spring", Kind: KindFixed, Amount: 1, Code: "SPRING"}},
+			order:     Order{ClientID: 1, Lines: []Line{{ProductID: "a", UnitPrice: 10, Quantity: 1}}},
+			discounts: []float64{0},
+			net:       10,
+			tax:       2,
+			total:     12,
+		},
+		{
+			name:      "codes are matched whatever their case",
+			promos:    []Promotion{{ID: "spring", Kind: KindFixed, Amount: 1, Code: "SPRING"}},
+			order:     Order{ClientID: 1, Codes: []string{" spring "}, Lines: []Line{{ProductID: "a", UnitPrice: 10, Quantity: 1}}},
+			discounts: []float64{1},
+			applied:   []string{"spring"},
+			net:       9,
+			tax:       1.8,
+			total:     10.8,
+		},
+		{
+			name:      "amounts are rounded to cents per line",
+			order:     Order{ClientID: 1, Lines: []Line{{ProductID: "a", UnitPrice: 19.99, Quantity: 3}, {ProductID: "b", UnitPrice: 0.07, Quantity: 1}}},
+			discounts: []float64{0, 0},
+			// 59.97 * 0.2 = 11.994 and 0.07 * 0.2 = 0.014, each rounded on its own
+			net:   60.04,
+			tax:   12,
+			total: 72.04,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := New(0.2, nil, tt.promos)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := engine.Price(tt.order, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, want := range tt.discounts {
+				if !same(b.Lines[i].Discount, want) {
+					t.Errorf("line %d discount = %v, want %v", i, b.Lines[i].Discount, want)
+				}
+			}
+
+			var applied []string
+			for _, a := range b.Promotions {
+				applied = append(applied, a.ID)
+			}
+			if len(applied) != len(tt.applied) {
+				t.Fatalf("applied %v, want %v", applied, tt.applied)
+			}
+			for i := range applied {
+				if applied[i] != tt.applied[i] {
+					t.Errorf("applied %v, want %v", applied, tt.applied)
+				}
+			}
+
+			if !same(b.Net, tt.net) || !same(b.Tax, tt.tax) || !same(b.Total, tt.total) {
+				t.Errorf("net %v tax %v total %v, want %v %v %v", b.Net, b.Tax, b.Total, tt.net, tt.tax, tt.total)
+			}
+		})
+	}
+}
+
+func TestBuyXGetY(t *testing.T) {
+	engine, err := New(0, nil, []Promotion{{ID: "three-for-two", Kind: KindBuyXGetY, Buy: 2, Get: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		quantity int
+		free     int
+	}{
+		{1, 0},
+		{2, 0},
+		{3, 1},
+		{5, 1},
+		{6, 2},
+		{7, 2},
+		{9, 3},
+	}
+
+	for _, tt := range tests {
+		b, err := engine.Price(Order{Lines: []Line{{ProductID: "a", UnitPrice: 1.5, Quantity: tt.quantity}}}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := float64(tt.free) * 1.5; !same(b.Lines[0].Discount, want) {
+			t.Errorf("%d units: discount %v, want %v", tt.quantity, b.Lines[0].Discount, want)
+		}
+	}
+}
+
+func TestTaxRuleSpecificity(t *testing.T) {
+	rules := []TaxRule{
+		{Country: "DE", Rate: 0.19},
+		{Country: "DE", Region: "BY", Rate: 0.1},
+		{Category: "books", Rate: 0.07},
+		{Category: "books", Country: "DE", Rate: 0.05},
+		// as specific as the first rule, which is listed earlier and wins
+		{Country: "DE", Rate: 0.5},
+	}
+
+	engine, err := New(0.2, rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		category string
+		to       Destination
+		rate     float64
+	}{
+		{"region beats country", "tools", Destination{Country: "DE", Region: "BY"}, 0.1},
+		{"first of equally specific rules", "tools", Destination{Country: "DE"}, 0.19},
+		{"a category rule applies anywhere", "books", Destination{Country: "FR"}, 0.07},
+		{"category and country beat the rest", "books", Destination{Country: "DE", Region: "BY"}, 0.05},
+		{"no rule matches", "tools", Destination{Country: "FR"}, 0.2},
+		{"no destination", "tools", Destination{}, 0.2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := Order{Destination: tt.to, Lines: []Line{{ProductID: "a", Category: tt.category, UnitPrice: 100, Quantity: 1}}}
+
+			b, err := engine.Price(order, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if b.Lines[0].TaxRate != tt.rate || !same(b.Lines[0].Tax, 100*tt.rate) {
+				t.Errorf("rate %v tax %v, want %v", b.Lines[0].TaxRate, b.Lines[0].Tax, tt.rate)
+			}
+		})
+	}
+}
+
+func TestPriceRejects(t *testing.T) {
+	engine, err := New(0.2, nil, []Promotion{{ID: "spring", Kind: KindFixed, Amount: 1, Code: "SPRING"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := Line{ProductID: "a", UnitPrice: 1, Quantity: 1}
+
+	tests := []struct {
+		name  string
+		order Order
+		want  error
+	}{
+		{"unknown code", Order{Codes: []string{"WINTER"}, Lines: []Line{line}}, ErrUnknownCode},
+		{"no quantity", Order{Lines: []Line{{ProductID: "a", UnitPrice: 1}}}, ErrInvalid},
+		{"negative price", Order{Lines: []Line{{ProductID: "a", UnitPrice: -1, Quantity: 1}}}, ErrInvalid},
+		{"bad country", Order{Destination: Destination{Country: "Germany"}, Lines: []Line{line}}, ErrInvalid},
+		{"region without country", Order{Destination: Destination{Region: "BY"}, Lines: []Line{line}}, ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		if _, err := engine.Price(tt.order, now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      []TaxRule
+		promotions []Promotion
+	}{
+		{"rate above one", []TaxRule{{Rate: 1.5}}, nil},
+		{"region without country", []TaxRule{{Region: "BY", Rate: 0.1}}, nil},
+		{"unknown kind", nil, []Promotion{{ID: "x", Kind: "bogo"}}},
+		{"percent over 100", nil, []Promotion{{ID: "x", Kind: KindPercent, Percent: 120}}},
+		{"same id twice", nil, []Promotion{{ID: "x", Kind: KindFixed, Amount: 1}, {ID: "x", Kind: KindFixed, Amount: 2}}},
+		{"same code twice", nil, []Promotion{{ID: "x", Kind: KindFixed, Amount: 1, Code: "a"}, {ID: "y", Kind: KindFixed, Amount: 2, Code: "A"}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := New(0.2, tt.rules, tt.promotions); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+}
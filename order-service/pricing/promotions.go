@@ -0,0 +1,186 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Promotion kinds. Buy-X-get-Y promotions apply first, then percentages off what is left
+// of each line, then fixed amounts off the order.
+const (
+	KindBuyXGetY = "buy_x_get_y"
+	KindPercent  = "percent"
+	KindFixed    = "fixed"
+)
+
+// stages orders the kinds as they apply
+var stages = []string{KindBuyXGetY, KindPercent, KindFixed}
+
+// Promotion is a discount the engine applies to every order it fits. A promotion with a
+// code only applies to orders that present the code; one with clients only to their orders.
+type Promotion struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	Code string `json:"code,omitempty"`
+	// Percent is taken off the lines of percent promotions
+	Percent float64 `json:"percent,omitempty"`
+	// Amount is taken off the order by fixed promotions, shared out over the lines by value
+	Amount float64 `json:"amount,omitempty"`
+	// Buy and Get make every Buy+Get units of a line cost Buy, for buy_x_get_y promotions
+	Buy int `json:"buy,omitempty"`
+	Get int `json:"get,omitempty"`
+	// Products and Categories limit the lines the promotion discounts; Clients the orders
+	Products    []string   `json:"products,omitempty"`
+	Categories  []string   `json:"categories,omitempty"`
+	Clients     []int32    `json:"clients,omitempty"`
+	MinSubtotal float64    `json:"min_subtotal,omitempty"`
+	StartsAt    *time.Time `json:"starts_at,omitempty"`
+	EndsAt      *time.Time `json:"ends_at,omitempty"`
+}
+
+// Applied is a promotion as it applied to an order
+type Applied struct {
+	ID     string  `bson:"id" json:"id"`
+	Name   string  `bson:"name" json:"name"`
+	Kind   string  `bson:"kind" json:"kind"`
+	Code   string  `bson:"code,omitempty" json:"code,omitempty"`
+	Amount float32 `bson:"amount" json:"amount"`
+}
+
+func (p Promotion) check() error {
+	switch {
+	case p.ID == "":
+		return errors.New("id is required")
+	case p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt):
+		return errors.New("ends_at must be after starts_at")
+	case p.MinSubtotal < 0:
+		return errors.New("min_subtotal can't be negative")
+	}
+
+	switch p.Kind {
+	case KindPercent:
+		if p.Percent <= 0 || p.Percent > 100 {
+			return fmt.Errorf("percent %g must be more than 0 and at most 100", p.Percent)
+		}
+	case KindFixed:
+		if p.Amount <= 0 {
+			return fmt.Errorf("amount %g must be positive", p.Amount)
+		}
+	case KindBuyXGetY:
+		if p.Buy < 1 || p.Get < 1 {
+			return errors.New("buy and get must be at least 1")
+		}
+	default:
+		return fmt.Errorf("kind %q must be %s, %s or %s", p.Kind, KindPercent, KindFixed, KindBuyXGetY)
+	}
+
+	return nil
+}
+
+// fits reports whether the promotion applies to the order as a whole
+func (p Promotion) fits(order Order, codes map[string]bool, subtotal float64, now time.Time) bool {
+	switch {
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return false
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return false
+	case p.Code != "" && !codes[normalizeCode(p.Code)]:
+		return false
+	case subtotal < p.MinSubtotal:
+		return false
+	}
+
+	if len(p.Clients) == 0 {
+		return true
+	}
+	for _, client := range p.Clients {
+		if client == order.ClientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// covers reports whether the promotion discounts the line
+func (p Promotion) covers(line Line) bool {
+	if len(p.Products) > 0 && !contains(p.Products, line.ProductID) {
+		return false
+	}
+	if len(p.Categories) > 0 && !contains(p.Categories, line.Category) {
+		return false
+	}
+
+	return true
+}
+
+// discounts works out what the promotion takes off each line, given what is left of them
+func (p Promotion) discounts(lines []Line, left []float64) []float64 {
+	off := make([]float64, len(lines))
+
+	switch p.Kind {
+	case KindBuyXGetY:
+		for i, line := range lines {
+			if !p.covers(line) {
+				continue
+			}
+			free := line.Quantity / (p.Buy + p.Get) * p.Get
+			off[i] = math.Min(cents(float64(free)*line.UnitPrice), left[i])
+		}
+
+	case KindPercent:
+		for i, line := range lines {
+			if p.covers(line) {
+				off[i] = cents(left[i] * p.Percent / 100)
+			}
+		}
+
+	case KindFixed:
+		var base float64
+		var last = -1
+		for i, line := range lines {
+			if p.covers(line) && left[i] > 0 {
+				base += left[i]
+				last = i
+			}
+		}
+		if last < 0 {
+			return off
+		}
+
+		// shared out by value; the last line takes what rounding leaves over
+		amount := cents(math.Min(p.Amount, base))
+		rest := amount
+		for i, line := range lines {
+			if !p.covers(line) || left[i] <= 0 {
+				continue
+			}
+			if i == last {
+				off[i] = math.Min(cents(rest), left[i])
+				break
+			}
+			off[i] = cents(amount * left[i] / base)
+			rest -= off[i]
+		}
+	}
+
+	return off
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
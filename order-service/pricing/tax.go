@@ -0,0 +1,91 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// country matches an ISO 3166-1 alpha-2 code
+var country = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// TaxRule sets the tax rate of the lines it matches. Empty fields match anything; when
+// several rules match a line the most specific wins: the category counts more than the
+// country, and the country more than the region.
+type TaxRule struct {
+	Category string  `json:"category,omitempty"`
+	Country  string  `json:"country,omitempty"`
+	Region   string  `json:"region,omitempty"`
+	Rate     float64 `json:"rate"`
+}
+
+// Destination is where an order is shipped to. Country is an ISO 3166-1 alpha-2 code;
+// Region is a state or province, as the tax rules name it.
+type Destination struct {
+	Country string `bson:"country,omitempty" json:"country,omitempty"`
+	Region  string `bson:"region,omitempty" json:"region,omitempty"`
+}
+
+func (r TaxRule) check() error {
+	switch {
+	case r.Rate < 0 || r.Rate > 1:
+		return fmt.Errorf("rate %g must be between 0 and 1", r.Rate)
+	case r.Country != "" && !country.MatchString(r.Country):
+		return fmt.Errorf("country %q must be an ISO 3166-1 alpha-2 code", r.Country)
+	case r.Region != "" && r.Country == "":
+		return errors.New("a region needs a country")
+	}
+
+	return nil
+}
+
+// specificity scores how closely the rule matches a line, or -1 when it doesn't
+func (r TaxRule) specificity(category string, to Destination) int {
+	score := 0
+
+	if r.Category != "" {
+		if r.Category != category {
+			return -1
+		}
+		score += 4
+	}
+	if r.Country != "" {
+		if r.Country != to.Country {
+			return -1
+		}
+		score += 2
+	}
+	if r.Region != "" {
+		if r.Region != to.Region {
+			return -1
+		}
+		score++
+	}
+
+	return score
+}
+
+// CheckDestination reports a destination the tax rules couldn't match
+func CheckDestination(to Destination) error {
+	if to.Country != "" && !country.MatchString(to.Country) {
+		return fmt.Errorf("%w: country %q must be an ISO 3166-1 alpha-2 code", ErrInvalid, to.Country)
+	}
+	if to.Region != "" && to.Country == "" {
+		return fmt.Errorf("%w: a region needs a country", ErrInvalid)
+	}
+
+	return nil
+}
+
+// rate returns the rate of the most specific rule matching the line, or the default rate
+// when none does. Of equally specific rules the first one listed wins.
+func (e *Engine) rate(category string, to Destination) float64 {
+	best, rate := -1, e.defaultRate
+	for _, rule := range e.rules {
+		if score := rule.specificity(category, to); score > best {
+			best, rate = score, rule.Rate
+		}
+	}
+
+	return rate
+}